@@ -0,0 +1,217 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+// AlarmsService handles communication with the alarm related methods of
+// the Onntrack API.
+type AlarmsService service
+
+// Alarm represents an alarm raised by a device, such as SOS, low battery,
+// overspeed or leaving a geofence.
+type Alarm struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"deviceId"`
+	IMEI     string `json:"imei"`
+
+	// Type is the platform's alarm code and Name its description.
+	Type string `json:"alarmType"`
+	Name string `json:"alarmName"`
+
+	// Lat and Lng are where the device was when the alarm was raised.
+	Lat   float64   `json:"lat"`
+	Lng   float64   `json:"lng"`
+	Datum geo.Datum `json:"datum"`
+
+	// Time is when the device raised the alarm.
+	Time Timestamp `json:"alarmTime"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Like positions,
+// the datum is reported as a map type.
+func (a *Alarm) UnmarshalJSON(data []byte) error {
+	type alias Alarm
+	aux := struct {
+		*alias
+		MapType string `json:"mapType"`
+	}{alias: (*alias)(a)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if a.Datum == "" {
+		a.Datum = datumForMapType(aux.MapType)
+	}
+
+	return nil
+}
+
+// AlarmListOptions specifies the optional parameters to the
+// AlarmsService.List method.
+type AlarmListOptions struct {
+	// Only return alarms of these devices
+	DeviceIDs []string
+
+	// Only return alarms raised at or after From
+	From time.Time
+
+	// Only return alarms raised before To
+	To time.Time
+
+	// Filter by alarm type
+	Type string
+
+	// Page number for pagination
+	Page int
+
+	// Number of results per page
+	PerPage int
+}
+
+// List returns the alarms raised by devices, newest first.
+//
+// Endpoint: alarms
+func (s *AlarmsService) List(ctx context.Context, opts *AlarmListOptions) ([]*Alarm, *http.Response, error) {
+	u := "alarms"
+	if opts != nil {
+		params := url.Values{}
+		if len(opts.DeviceIDs) > 0 {
+			params.Set("deviceIds", strings.Join(opts.DeviceIDs, ","))
+		}
+		if !opts.From.IsZero() {
+			params.Set("startTime", opts.From.UTC().Format(TimeLayout))
+		}
+		if !opts.To.IsZero() {
+			params.Set("endTime", opts.To.UTC().Format(TimeLayout))
+		}
+		if opts.Type != "" {
+			params.Set("alarmType", opts.Type)
+		}
+		if opts.Page > 0 {
+			params.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PerPage > 0 {
+			params.Set("pageSize", strconv.Itoa(opts.PerPage))
+		}
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+	}
+
+	req, err := s.client.NewRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var alarms []*Alarm
+	resp, err := s.client.doData(req, &alarms)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if s.client.positionDatum != "" {
+		for _, a := range alarms {
+			lat, lng, err := geo.Convert(a.Lat, a.Lng, a.Datum, s.client.positionDatum)
+			if err != nil {
+				return nil, resp, err
+			}
+			a.Lat, a.Lng, a.Datum = lat, lng, s.client.positionDatum
+		}
+	}
+
+	return alarms, resp, nil
+}
+
+// DefaultAlarmLookback is the lookback an AlarmPoller uses when none is set.
+const DefaultAlarmLookback = 10 * time.Minute
+
+// alarmPageSize is the page size AlarmPoller fetches alarms with.
+const alarmPageSize = 500
+
+// AlarmPoller lists the alarms raised since its previous poll, for commands
+// that turn alarms into events or counters. Every poll also fetches the
+// Lookback before the previous one, to catch alarms that reach the platform
+// late, and recognises alarms it has already handed out by ID, so each
+// alarm is handled once. An AlarmPoller must not be copied or polled from
+// several goroutines at once.
+type AlarmPoller struct {
+	Client *Client
+
+	// Since is the time the first poll lists alarms from.
+	Since time.Time
+
+	// Lookback is how far before the previous poll alarms are fetched
+	// again. Defaults to DefaultAlarmLookback.
+	Lookback time.Duration
+
+	// seen is the time of every alarm handled within the lookback.
+	seen map[string]time.Time
+}
+
+// Poll lists the alarms of the given devices, or of all devices if none are
+// given, and calls fn with each alarm that was not handled before, in the
+// order raised. now is the time of the poll.
+//
+// An alarm counts as handled once fn returns nil for it. Poll stops at the
+// first error from fn and returns it; that alarm and the ones after it are
+// passed to fn again by the next poll.
+func (p *AlarmPoller) Poll(ctx context.Context, now time.Time, deviceIDs []string, fn func(*Alarm) error) error {
+	if p.seen == nil {
+		p.seen = make(map[string]time.Time)
+	}
+	lookback := p.Lookback
+	if lookback <= 0 {
+		lookback = DefaultAlarmLookback
+	}
+
+	opts := &AlarmListOptions{DeviceIDs: deviceIDs, From: p.Since, Page: 1, PerPage: alarmPageSize}
+	var all []*Alarm
+	for {
+		alarms, _, err := p.Client.Alarms.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		all = append(all, alarms...)
+		if len(alarms) < opts.PerPage {
+			break
+		}
+		opts.Page++
+	}
+
+	// Alarms are listed newest first
+	for i := len(all) - 1; i >= 0; i-- {
+		a := all[i]
+		if _, ok := p.seen[a.ID]; ok {
+			continue
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+		at := a.Time.Time
+		if at.IsZero() {
+			at = now
+		}
+		p.seen[a.ID] = at
+	}
+
+	// Forget alarms that can no longer be fetched again
+	p.Since = now.Add(-lookback)
+	for id, at := range p.seen {
+		if at.Before(p.Since) {
+			delete(p.seen, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package onntrackclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+func TestAlarmsService_List(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/alarms" {
+			t.Errorf("Expected request to '/alarms', got '%s'", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("deviceIds"); got != "device-1,device-2" {
+			t.Errorf("Expected deviceIds 'device-1,device-2', got '%s'", got)
+		}
+		if got := r.URL.Query().Get("startTime"); got != "2024-05-01 00:00:00" {
+			t.Errorf("Expected startTime '2024-05-01 00:00:00', got '%s'", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": true, "code": 0, "data": [
+			{"id": "alarm-1", "deviceId": "device-1", "alarmType": "sos", "alarmName": "SOS",
+			 "lat": 52.1, "lng": 4.1, "alarmTime": "2024-05-01 10:00:00"},
+			{"id": "alarm-2", "deviceId": "device-2", "alarmType": "lowBattery",
+			 "lat": 31.23, "lng": 121.47, "mapType": "AMAP", "alarmTime": "2024-05-01 09:00:00"}
+		]}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL), WithPositionDatum(geo.WGS84))
+
+	alarms, _, err := client.Alarms.List(context.Background(), &AlarmListOptions{
+		DeviceIDs: []string{"device-1", "device-2"},
+		From:      time.Date(2024, 5, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	})
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+
+	if len(alarms) != 2 {
+		t.Fatalf("List returned %d alarms, want 2", len(alarms))
+	}
+	if alarms[0].Type != "sos" || alarms[0].Time.Hour() != 10 {
+		t.Errorf("Alarm = %+v, want an sos alarm at 10:00", alarms[0])
+	}
+
+	// The GCJ-02 alarm is converted to WGS-84
+	if alarms[1].Datum != geo.WGS84 || alarms[1].Lat == 31.23 {
+		t.Errorf("Alarm datum = %v at %v, %v, want converted to WGS-84", alarms[1].Datum, alarms[1].Lat, alarms[1].Lng)
+	}
+}
+
+func TestAlarmPoller(t *testing.T) {
+	var alarms, startTime string
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime = r.URL.Query().Get("startTime")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true, "data": ` + alarms + `}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	poller := &AlarmPoller{Client: client, Since: now.Add(-time.Hour)}
+	var handled []string
+	handle := func(a *Alarm) error {
+		handled = append(handled, a.ID)
+		return nil
+	}
+
+	alarms = `[{"id": "alarm-1", "alarmTime": "2024-05-01 11:55:00"}]`
+	if err := poller.Poll(context.Background(), now, nil, handle); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	if startTime != "2024-05-01 11:00:00" {
+		t.Errorf("first poll startTime = %q, want Since", startTime)
+	}
+
+	// The lookback returns alarm-1 again, which is skipped
+	alarms = `[
+		{"id": "alarm-3", "alarmTime": "2024-05-01 12:00:40"},
+		{"id": "alarm-2", "alarmTime": "2024-05-01 12:00:30"},
+		{"id": "alarm-1", "alarmTime": "2024-05-01 11:55:00"}
+	]`
+	if err := poller.Poll(context.Background(), now.Add(time.Minute), nil, handle); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	if startTime != "2024-05-01 11:50:00" {
+		t.Errorf("second poll startTime = %q, want the lookback before the first poll", startTime)
+	}
+	if want := []string{"alarm-1", "alarm-2", "alarm-3"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %v, want %v", handled, want)
+	}
+
+	// An alarm fn fails for is passed again by the next poll
+	alarms = `[{"id": "alarm-4", "alarmTime": "2024-05-01 12:01:30"}]`
+	failed := errors.New("broker down")
+	err := poller.Poll(context.Background(), now.Add(2*time.Minute), nil, func(a *Alarm) error { return failed })
+	if err != failed {
+		t.Errorf("Poll error = %v, want %v", err, failed)
+	}
+	handled = nil
+	poller.Poll(context.Background(), now.Add(3*time.Minute), nil, handle)
+	if want := []string{"alarm-4"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %v after a failure, want %v", handled, want)
+	}
+}
@@ -0,0 +1,270 @@
+package archive
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+// gridSize is the size in degrees of the cells of the spatial index, about
+// 11 km from north to south.
+const gridSize = 0.1
+
+// metresPerDegree is the length of a degree of latitude on the sphere
+// geo.Distance measures on.
+const metresPerDegree = 111195.0
+
+// BoundingBox is a rectangle of WGS-84 coordinates. Boxes that cross the
+// antimeridian are not supported.
+type BoundingBox struct {
+	MinLat, MinLng float64
+	MaxLat, MaxLng float64
+}
+
+func (b BoundingBox) contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// entry locates a stored position.
+type entry struct {
+	positionKey
+	segment int
+	offset  int64
+	length  int
+}
+
+// positionKey identifies a position of a device by its time and place.
+type positionKey struct {
+	at       int64   // Unix time in seconds
+	lat, lng float64 // WGS-84
+}
+
+func keyOf(p *onntrackclient.Position) positionKey {
+	lat, lng, err := geo.Convert(p.Lat, p.Lng, p.Datum, geo.WGS84)
+	if err != nil {
+		// Index positions in an unknown datum as they are
+		lat, lng = p.Lat, p.Lng
+	}
+	return positionKey{at: p.Time.Unix(), lat: lat, lng: lng}
+}
+
+func (e *entry) between(from, to time.Time) bool {
+	return (from.IsZero() || e.at >= from.Unix()) && (to.IsZero() || e.at < to.Unix())
+}
+
+type cell struct {
+	lat, lng int
+}
+
+func cellOf(lat, lng float64) cell {
+	return cell{int(math.Floor(lat / gridSize)), int(math.Floor(lng / gridSize))}
+}
+
+// index is the in-memory index of a FileStore: the positions of every
+// device in time order and the positions in every cell of a coarse grid.
+type index struct {
+	devices map[string][]*entry
+	grid    map[cell][]*entry
+}
+
+func newIndex() *index {
+	return &index{devices: make(map[string][]*entry), grid: make(map[cell][]*entry)}
+}
+
+// add indexes a position. The positions of a device are kept in time
+// order; positions with the same time stay in the order they were added.
+func (ix *index) add(p *onntrackclient.Position, segment int, offset int64, length int) {
+	e := &entry{positionKey: keyOf(p), segment: segment, offset: offset, length: length}
+
+	entries := ix.devices[p.DeviceID]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].at > e.at })
+	ix.devices[p.DeviceID] = slices.Insert(entries, i, e)
+
+	c := cellOf(e.lat, e.lng)
+	ix.grid[c] = append(ix.grid[c], e)
+}
+
+// contains reports whether a position with the given key is indexed for a
+// device.
+func (ix *index) contains(deviceID string, key positionKey) bool {
+	entries := ix.devices[deviceID]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].at >= key.at })
+	for ; i < len(entries) && entries[i].at == key.at; i++ {
+		if entries[i].positionKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// buildIndex indexes all segments if that has not been done yet. The
+// caller must hold s.mu.
+func (s *FileStore) buildIndex() error {
+	if s.index != nil {
+		return nil
+	}
+
+	numbers, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	ix := newIndex()
+	for _, number := range numbers {
+		_, err := scanSegment(s.segmentPath(number), 0, func(p *onntrackclient.Position, offset int64, length int) error {
+			ix.add(p, number, offset, length)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.index, s.recent = ix, nil
+	return nil
+}
+
+// Range returns the stored positions of a device recorded at or after from
+// and before to, oldest first. A zero from or to leaves that end open.
+func (s *FileStore) Range(deviceID string, from, to time.Time) ([]*onntrackclient.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	entries := s.index.devices[deviceID]
+	lo, hi := 0, len(entries)
+	if !from.IsZero() {
+		lo = sort.Search(len(entries), func(i int) bool { return entries[i].at >= from.Unix() })
+	}
+	if !to.IsZero() {
+		hi = sort.Search(len(entries), func(i int) bool { return entries[i].at >= to.Unix() })
+	}
+	if lo >= hi {
+		return nil, nil
+	}
+
+	return s.read(entries[lo:hi])
+}
+
+// Within returns the stored positions inside a bounding box recorded at or
+// after from and before to, ordered by time. A zero from or to leaves that
+// end open.
+func (s *FileStore) Within(box BoundingBox, from, to time.Time) ([]*onntrackclient.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.search(box, from, to, nil)
+}
+
+// Near returns the stored positions within radius metres of a WGS-84
+// coordinate recorded at or after from and before to, ordered by time. Use
+// DeviceIDs to find out who was there.
+func (s *FileStore) Near(lat, lng, radius float64, from, to time.Time) ([]*onntrackclient.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Search the box around the circle and then the circle itself
+	dLat := radius / metresPerDegree
+	dLng := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0 {
+		dLng = math.Min(dLat/cos, 180)
+	}
+	box := BoundingBox{MinLat: lat - dLat, MinLng: lng - dLng, MaxLat: lat + dLat, MaxLng: lng + dLng}
+
+	return s.search(box, from, to, func(e *entry) bool {
+		return geo.Distance(lat, lng, e.lat, e.lng) <= radius
+	})
+}
+
+// search returns the positions in box and the time range that match, if
+// not nil, the filter. The caller must hold s.mu.
+func (s *FileStore) search(box BoundingBox, from, to time.Time, match func(*entry) bool) ([]*onntrackclient.Position, error) {
+	if err := s.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	var matches []*entry
+	visit := func(entries []*entry) {
+		for _, e := range entries {
+			if box.contains(e.lat, e.lng) && e.between(from, to) && (match == nil || match(e)) {
+				matches = append(matches, e)
+			}
+		}
+	}
+
+	// Walk the cells of the box, or all occupied cells when there are fewer
+	lo, hi := cellOf(box.MinLat, box.MinLng), cellOf(box.MaxLat, box.MaxLng)
+	if cells := (hi.lat - lo.lat + 1) * (hi.lng - lo.lng + 1); cells > len(s.index.grid) {
+		for c, entries := range s.index.grid {
+			if c.lat >= lo.lat && c.lat <= hi.lat && c.lng >= lo.lng && c.lng <= hi.lng {
+				visit(entries)
+			}
+		}
+	} else {
+		for cLat := lo.lat; cLat <= hi.lat; cLat++ {
+			for cLng := lo.lng; cLng <= hi.lng; cLng++ {
+				visit(s.index.grid[cell{cLat, cLng}])
+			}
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b *entry) int {
+		return cmp.Or(cmp.Compare(a.at, b.at), cmp.Compare(a.segment, b.segment), cmp.Compare(a.offset, b.offset))
+	})
+	return s.read(matches)
+}
+
+// read reads the positions at the given entries.
+func (s *FileStore) read(entries []*entry) ([]*onntrackclient.Position, error) {
+	files := make(map[int]*os.File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	positions := make([]*onntrackclient.Position, 0, len(entries))
+	for _, e := range entries {
+		f, ok := files[e.segment]
+		if !ok {
+			var err error
+			if f, err = os.Open(s.segmentPath(e.segment)); err != nil {
+				return nil, err
+			}
+			files[e.segment] = f
+		}
+
+		buf := make([]byte, e.length)
+		if _, err := f.ReadAt(buf, e.offset); err != nil {
+			return nil, err
+		}
+		var p onntrackclient.Position
+		if err := json.Unmarshal(buf, &p); err != nil {
+			return nil, err
+		}
+		positions = append(positions, &p)
+	}
+
+	return positions, nil
+}
+
+// DeviceIDs returns the IDs of the devices positions belong to, sorted and
+// without duplicates.
+func DeviceIDs(positions []*onntrackclient.Position) []string {
+	ids := make([]string, 0, len(positions))
+	for _, p := range positions {
+		ids = append(ids, p.DeviceID)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+func TestFileStore_Query(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int, lat, lng float64) *onntrackclient.Position {
+		return &onntrackclient.Position{Lat: lat, Lng: lng, Datum: geo.WGS84, Time: onntrackclient.Timestamp{Time: start.Add(time.Duration(minutes) * time.Minute)}}
+	}
+
+	store, err := OpenFileStore(t.TempDir(), WithSegmentSize(300))
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	defer store.Close()
+
+	// Device 1 drives from Amsterdam Centraal to Dam Square, device 2 stays
+	// in Rotterdam and device 3 passes Dam Square later
+	store.Append("1", []*onntrackclient.Position{at(0, 52.3791, 4.9003), at(10, 52.3752, 4.8940), at(20, 52.3731, 4.8926)})
+	store.Append("2", []*onntrackclient.Position{at(0, 51.9249, 4.4690), at(30, 51.9250, 4.4691)})
+
+	// Range
+	got, err := store.Range("1", start.Add(10*time.Minute), start.Add(20*time.Minute))
+	if err != nil {
+		t.Fatalf("Range returned unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Lat != 52.3752 || got[0].DeviceID != "1" {
+		t.Errorf("Range = %+v, want the position at 12:10", got)
+	}
+	if got, _ := store.Range("1", time.Time{}, time.Time{}); len(got) != 3 {
+		t.Errorf("open Range returned %d positions, want 3", len(got))
+	}
+
+	// Positions appended after the index was built are found too
+	store.Append("3", []*onntrackclient.Position{at(60, 52.3732, 4.8925)})
+
+	// Bounding box around Amsterdam
+	amsterdam := BoundingBox{MinLat: 52.3, MinLng: 4.7, MaxLat: 52.45, MaxLng: 5.0}
+	got, err = store.Within(amsterdam, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Within returned unexpected error: %v", err)
+	}
+	if ids := DeviceIDs(got); !slices.Equal(ids, []string{"1", "3"}) {
+		t.Errorf("Within devices = %v, want [1 3]", ids)
+	}
+	if len(got) != 4 || !slices.IsSortedFunc(got, func(a, b *onntrackclient.Position) int { return a.Time.Compare(b.Time.Time) }) {
+		t.Errorf("Within = %+v, want 4 positions ordered by time", got)
+	}
+
+	// Who was within 100 metres of Dam Square in the first half hour
+	got, err = store.Near(52.3731, 4.8926, 100, start, start.Add(30*time.Minute))
+	if err != nil {
+		t.Fatalf("Near returned unexpected error: %v", err)
+	}
+	if ids := DeviceIDs(got); !slices.Equal(ids, []string{"1"}) {
+		t.Errorf("Near devices = %v, want [1]", ids)
+	}
+	if len(got) != 1 {
+		t.Errorf("Near returned %d positions, want 1", len(got))
+	}
+
+	// And at any time
+	got, _ = store.Near(52.3731, 4.8926, 100, time.Time{}, time.Time{})
+	if ids := DeviceIDs(got); !slices.Equal(ids, []string{"1", "3"}) {
+		t.Errorf("Near devices = %v, want [1 3]", ids)
+	}
+}
@@ -0,0 +1,470 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// Store stores the positions of devices.
+type Store interface {
+	// Append stores positions of one device, oldest first. Positions that
+	// are already stored, with the same time and coordinates, are skipped,
+	// so appending the same positions twice stores them once. Positions
+	// older than the newest stored one are stored too, for devices that
+	// upload late. It returns the number of positions stored.
+	Append(deviceID string, positions []*onntrackclient.Position) (int, error)
+
+	// Last returns the time of the newest stored position of a device. The
+	// second result is false when nothing is stored for the device.
+	Last(deviceID string) (time.Time, bool, error)
+}
+
+// DefaultSegmentSize is the size at which a FileStore starts a new segment.
+const DefaultSegmentSize = 64 << 20
+
+// checkpointFile is the name of the checkpoint in a FileStore directory.
+const checkpointFile = "checkpoint.json"
+
+// FileStore is an append-only Store in a directory. Positions are written
+// as JSON lines to numbered segment files, and every append is synced to
+// disk before it returns.
+//
+// A checkpoint records how far the segments have been read, the newest
+// position of every device and the newest position in every segment, so
+// opening the store only reads what was written after it. A record that was cut off by a crash is removed when
+// the store is opened; the positions in it are fetched again by the next
+// sync.
+//
+// Appended positions that are not newer than the newest stored position of
+// their device are looked up to skip duplicates. Only the segments with
+// positions at least as new as the oldest of them are read for that, once,
+// so a sync that looks back a day reads the last segments instead of all.
+type FileStore struct {
+	dir         string
+	segmentSize int64
+
+	mu      sync.Mutex
+	segment *os.File
+	number  int
+	size    int64
+	last    map[string]time.Time
+
+	// newest is the time of the newest position in every segment. A segment
+	// without one was written before it was recorded.
+	newest map[int]time.Time
+
+	// index is built by the first query and kept up to date by Append.
+	index *index
+
+	// recent indexes the segments with positions at or after recentSince,
+	// for the lookups of Append until index is built. It is kept up to date
+	// by Append.
+	recent      *index
+	recentSince time.Time
+}
+
+// record is a position about to be written at an offset in a segment.
+type record struct {
+	position *onntrackclient.Position
+	offset   int64
+	length   int
+}
+
+// FileStoreOption configures a FileStore.
+type FileStoreOption func(*FileStore)
+
+// WithSegmentSize sets the size at which a new segment is started.
+func WithSegmentSize(size int64) FileStoreOption {
+	return func(s *FileStore) {
+		s.segmentSize = size
+	}
+}
+
+// checkpoint is the content of the checkpoint file.
+type checkpoint struct {
+	Segment int                  `json:"segment"`
+	Offset  int64                `json:"offset"`
+	Last    map[string]time.Time `json:"last"`
+	Newest  map[int]time.Time    `json:"newest,omitempty"`
+}
+
+// OpenFileStore opens the store in dir, creating the directory if needed.
+func OpenFileStore(dir string, opts ...FileStoreOption) (*FileStore, error) {
+	s := &FileStore{dir: dir, segmentSize: DefaultSegmentSize}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	cp, err := s.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	s.last, s.newest = cp.Last, cp.Newest
+
+	numbers, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	// Recover what was written after the checkpoint
+	for i, number := range numbers {
+		if number < cp.Segment {
+			continue
+		}
+		offset := int64(0)
+		if number == cp.Segment {
+			offset = cp.Offset
+		}
+		// The newest position of a segment only read in part stays unknown
+		_, known := s.newest[number]
+		known = known || offset == 0
+		end, err := scanSegment(s.segmentPath(number), offset, func(p *onntrackclient.Position, _ int64, _ int) error {
+			if p.Time.After(s.last[p.DeviceID]) {
+				s.last[p.DeviceID] = p.Time.Time
+			}
+			if known && p.Time.After(s.newest[number]) {
+				s.newest[number] = p.Time.Time
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if i == len(numbers)-1 {
+			if err := os.Truncate(s.segmentPath(number), end); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	number := 1
+	if len(numbers) > 0 {
+		number = numbers[len(numbers)-1]
+	}
+	if err := s.openSegment(number); err != nil {
+		return nil, err
+	}
+	if err := s.saveCheckpoint(); err != nil {
+		s.segment.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Last implements Store.
+func (s *FileStore) Last(deviceID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.last[deviceID]
+	return last, ok, nil
+}
+
+// Append implements Store. Positions without a device ID are stored under
+// deviceID; positions of another device are an error.
+func (s *FileStore) Append(deviceID string, positions []*onntrackclient.Position) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.segment == nil {
+		return 0, errors.New("archive: store is closed")
+	}
+
+	last, seen := s.last[deviceID]
+	lookup, err := s.lookupIndex(deviceID, positions)
+	if err != nil {
+		return 0, err
+	}
+
+	appended := make(map[positionKey]bool)
+	var buf bytes.Buffer
+	var records []record
+	for _, p := range positions {
+		if p.DeviceID != "" && p.DeviceID != deviceID {
+			return 0, fmt.Errorf("archive: position of device %s appended to device %s", p.DeviceID, deviceID)
+		}
+		key := keyOf(p)
+		if appended[key] {
+			continue
+		}
+		if lookup != nil && lookup.contains(deviceID, key) {
+			continue
+		}
+		appended[key] = true
+
+		pos := *p
+		pos.DeviceID = deviceID
+
+		line, err := json.Marshal(&pos)
+		if err != nil {
+			return 0, err
+		}
+		records = append(records, record{position: &pos, offset: int64(buf.Len()), length: len(line) + 1})
+		buf.Write(line)
+		buf.WriteByte('\n')
+
+		if !seen || p.Time.After(last) {
+			last, seen = p.Time.Time, true
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	if s.size > 0 && s.size+int64(buf.Len()) > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.segment.Write(buf.Bytes())
+	s.size += int64(n)
+	if err == nil {
+		err = s.segment.Sync()
+	}
+	if err != nil {
+		// Drop what was written so the segment does not end in a partial record
+		s.segment.Truncate(s.size - int64(n))
+		s.size -= int64(n)
+		return 0, err
+	}
+
+	s.last[deviceID] = last
+	start := s.size - int64(n)
+	if newest, ok := s.newest[s.number]; ok || start == 0 {
+		for _, r := range records {
+			if r.position.Time.After(newest) {
+				newest = r.position.Time.Time
+			}
+		}
+		s.newest[s.number] = newest
+	}
+	for _, ix := range []*index{s.index, s.recent} {
+		if ix == nil {
+			continue
+		}
+		for _, r := range records {
+			ix.add(r.position, s.number, start+r.offset, r.length)
+		}
+	}
+
+	if err := s.saveCheckpoint(); err != nil {
+		return len(records), err
+	}
+	return len(records), nil
+}
+
+// lookupIndex returns an index with every stored position of a device that
+// the positions about to be appended may duplicate: the ones at or after
+// the oldest position that is not newer than the newest stored one. It
+// returns nil when there are no such positions. The caller must hold s.mu.
+func (s *FileStore) lookupIndex(deviceID string, positions []*onntrackclient.Position) (*index, error) {
+	last, ok := s.last[deviceID]
+	if !ok {
+		return nil, nil
+	}
+
+	var since time.Time
+	for _, p := range positions {
+		if !p.Time.After(last) && (since.IsZero() || p.Time.Before(since)) {
+			since = p.Time.Time
+		}
+	}
+	if since.IsZero() {
+		return nil, nil
+	}
+	if s.index != nil {
+		return s.index, nil
+	}
+
+	// Positions are looked up by the second they were recorded in
+	since = since.Truncate(time.Second)
+	if s.recent != nil && !since.Before(s.recentSince) {
+		return s.recent, nil
+	}
+
+	numbers, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	ix := newIndex()
+	for _, number := range numbers {
+		if newest, ok := s.newest[number]; ok && newest.Before(since) {
+			continue
+		}
+		_, err := scanSegment(s.segmentPath(number), 0, func(p *onntrackclient.Position, offset int64, length int) error {
+			ix.add(p, number, offset, length)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.recent, s.recentSince = ix, since
+	return ix, nil
+}
+
+// Close closes the store.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.segment == nil {
+		return nil
+	}
+	err := s.segment.Close()
+	s.segment = nil
+	return err
+}
+
+func (s *FileStore) segmentPath(number int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("positions-%08d.jsonl", number))
+}
+
+// segments returns the numbers of the segment files, in order.
+func (s *FileStore) segments() ([]int, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "positions-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, match := range matches {
+		var number int
+		if _, err := fmt.Sscanf(filepath.Base(match), "positions-%08d.jsonl", &number); err == nil {
+			numbers = append(numbers, number)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+func (s *FileStore) openSegment(number int) error {
+	f, err := os.OpenFile(s.segmentPath(number), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.segment, s.number, s.size = f, number, info.Size()
+	return nil
+}
+
+// rotate closes the current segment and starts the next one.
+func (s *FileStore) rotate() error {
+	if err := s.segment.Close(); err != nil {
+		return err
+	}
+	s.segment = nil
+	return s.openSegment(s.number + 1)
+}
+
+func (s *FileStore) loadCheckpoint() (*checkpoint, error) {
+	cp := &checkpoint{Segment: 1, Last: make(map[string]time.Time), Newest: make(map[int]time.Time)}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, checkpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("archive: reading checkpoint: %w", err)
+	}
+	if cp.Last == nil {
+		cp.Last = make(map[string]time.Time)
+	}
+	if cp.Newest == nil {
+		cp.Newest = make(map[int]time.Time)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint replaces the checkpoint with the current state. The file is
+// replaced atomically, so a crash never leaves a partial checkpoint behind.
+func (s *FileStore) saveCheckpoint() error {
+	data, err := json.Marshal(&checkpoint{Segment: s.number, Offset: s.size, Last: s.last, Newest: s.newest})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, checkpointFile)
+	tmp, err := os.CreateTemp(s.dir, checkpointFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// scanSegment calls fn with every complete record in a segment from offset
+// on, with its offset and length, and returns the offset after the last
+// one. Reading stops at a record that was cut off.
+func scanSegment(path string, offset int64, fn func(p *onntrackclient.Position, offset int64, length int) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Anything after the last newline was cut off
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var p onntrackclient.Position
+		if err := json.Unmarshal(line, &p); err != nil {
+			return 0, fmt.Errorf("archive: %s at offset %d: %w", filepath.Base(path), offset, err)
+		}
+		if err := fn(&p, offset, len(line)); err != nil {
+			return 0, err
+		}
+		offset += int64(len(line))
+	}
+}
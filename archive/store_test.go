@@ -0,0 +1,211 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+func position(deviceID string, at time.Time) *onntrackclient.Position {
+	return &onntrackclient.Position{DeviceID: deviceID, Lat: 52.1, Lng: 4.1, Time: onntrackclient.Timestamp{Time: at}}
+}
+
+// readAll returns the times of all stored positions by device.
+func readAll(t *testing.T, dir string) map[string][]time.Time {
+	t.Helper()
+
+	s := &FileStore{dir: dir}
+	numbers, err := s.segments()
+	if err != nil {
+		t.Fatalf("segments returned unexpected error: %v", err)
+	}
+
+	times := make(map[string][]time.Time)
+	for _, number := range numbers {
+		_, err := scanSegment(s.segmentPath(number), 0, func(p *onntrackclient.Position, _ int64, _ int) error {
+			times[p.DeviceID] = append(times[p.DeviceID], p.Time.Time)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("scanSegment returned unexpected error: %v", err)
+		}
+	}
+	return times
+}
+
+func TestFileStore_Append(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := OpenFileStore(dir, WithSegmentSize(200))
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+
+	n, err := store.Append("1", []*onntrackclient.Position{
+		position("", start),
+		position("", start.Add(time.Minute)),
+		position("", start.Add(time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Append returned unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Append stored %d positions, want 2", n)
+	}
+
+	// Positions that are already stored are skipped
+	n, _ = store.Append("1", []*onntrackclient.Position{
+		position("1", start.Add(time.Minute)),
+		position("1", start.Add(2*time.Minute)),
+	})
+	if n != 1 {
+		t.Errorf("Append stored %d positions, want 1", n)
+	}
+
+	// Late positions and positions that share a time with a stored one are
+	// stored too
+	moved := position("1", start.Add(time.Minute))
+	moved.Lat = 52.2
+	n, _ = store.Append("1", []*onntrackclient.Position{
+		position("1", start.Add(30*time.Second)),
+		moved,
+		position("1", start.Add(time.Minute)),
+	})
+	if n != 2 {
+		t.Errorf("Append stored %d positions, want 2", n)
+	}
+	got, err := store.Range("1", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Range returned unexpected error: %v", err)
+	}
+	wantTimes := []time.Time{start, start.Add(30 * time.Second), start.Add(time.Minute), start.Add(time.Minute), start.Add(2 * time.Minute)}
+	if len(got) != len(wantTimes) {
+		t.Fatalf("Range returned %d positions, want %d", len(got), len(wantTimes))
+	}
+	for i, p := range got {
+		if !p.Time.Equal(wantTimes[i]) {
+			t.Errorf("position %d time = %v, want %v", i, p.Time, wantTimes[i])
+		}
+	}
+
+	if _, err := store.Append("1", []*onntrackclient.Position{position("2", start)}); err == nil {
+		t.Error("Append of another device's position expected error, got nil")
+	}
+
+	last, ok, _ := store.Last("1")
+	if !ok || !last.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Last = %v, %v, want %v, true", last, ok, start.Add(2*time.Minute))
+	}
+	if _, ok, _ := store.Last("2"); ok {
+		t.Error("Last of an unknown device = true, want false")
+	}
+	store.Close()
+
+	// The small segment size starts a new segment for every append
+	if segments, _ := filepath.Glob(filepath.Join(dir, "positions-*.jsonl")); len(segments) != 3 {
+		t.Errorf("store has %d segments, want 3", len(segments))
+	}
+
+	// The last positions survive reopening
+	store, err = OpenFileStore(dir, WithSegmentSize(200))
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	defer store.Close()
+	if n, _ := store.Append("1", []*onntrackclient.Position{position("1", start.Add(2*time.Minute))}); n != 0 {
+		t.Errorf("Append after reopening stored %d positions, want 0", n)
+	}
+
+	if got := readAll(t, dir)["1"]; len(got) != 5 {
+		t.Errorf("stored %d positions, want 5: %v", len(got), got)
+	}
+}
+
+func TestFileStore_Append_Lookback(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := OpenFileStore(dir, WithSegmentSize(100))
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	for day := range 3 {
+		if _, err := store.Append("1", []*onntrackclient.Position{position("1", start.AddDate(0, 0, day))}); err != nil {
+			t.Fatalf("Append returned unexpected error: %v", err)
+		}
+	}
+	store.Close()
+
+	store, err = OpenFileStore(dir, WithSegmentSize(100))
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	defer store.Close()
+
+	// Looking back less than a day does not read the older segments
+	if err := os.WriteFile(filepath.Join(dir, "positions-00000001.jsonl"), []byte("not a position\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	n, err := store.Append("1", []*onntrackclient.Position{
+		position("1", start.AddDate(0, 0, 2).Add(-time.Hour)),
+		position("1", start.AddDate(0, 0, 2)),
+	})
+	if err != nil {
+		t.Fatalf("Append returned unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Append stored %d positions, want 1", n)
+	}
+}
+
+func TestFileStore_Recover(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	store.Append("1", []*onntrackclient.Position{position("1", start)})
+	store.Close()
+
+	// Simulate a crash after a record was written but before the
+	// checkpoint, followed by a record that was cut off
+	segment := filepath.Join(dir, "positions-00000001.jsonl")
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile returned unexpected error: %v", err)
+	}
+	f.WriteString(`{"deviceId":"1","lat":52.2,"lng":4.2,"gpsTime":"2024-05-01 12:01:00"}` + "\n")
+	f.WriteString(`{"deviceId":"1","lat":52.3,"lng":4.3,"gpsT`)
+	f.Close()
+
+	store, err = OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	defer store.Close()
+
+	last, _, _ := store.Last("1")
+	if want := start.Add(time.Minute); !last.Equal(want) {
+		t.Errorf("Last = %v, want %v", last, want)
+	}
+
+	// The cut-off record is gone and the position is stored again once
+	recovered := position("1", start.Add(time.Minute))
+	recovered.Lat, recovered.Lng = 52.2, 4.2
+	n, err := store.Append("1", []*onntrackclient.Position{recovered, position("1", start.Add(2*time.Minute))})
+	if err != nil {
+		t.Fatalf("Append returned unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Append stored %d positions, want 1", n)
+	}
+	if got := readAll(t, dir)["1"]; len(got) != 3 {
+		t.Errorf("stored %d positions, want 3: %v", len(got), got)
+	}
+}
@@ -0,0 +1,180 @@
+// Package archive keeps a local archive of the position history of Onntrack
+// devices, beyond the retention window of the platform.
+//
+// A Syncer pulls the history of every device incrementally, starting a
+// lookback before the newest position already in the Store, so it can be
+// stopped at any point and resumed without gaps or duplicate positions, and
+// positions that devices upload late are archived too:
+//
+//	store, err := archive.OpenFileStore("/var/lib/onntrack/archive")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer store.Close()
+//	syncer := &archive.Syncer{Client: client, Store: store}
+//	err = syncer.Run(ctx)
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// Defaults for Syncer.
+const (
+	DefaultInterval = 15 * time.Minute
+	DefaultWindow   = 24 * time.Hour
+	DefaultBackfill = 90 * 24 * time.Hour
+	DefaultLookback = 24 * time.Hour
+)
+
+// Syncer copies the position history of devices into a Store. A Syncer
+// must not be copied or synced from several goroutines at once.
+type Syncer struct {
+	Client *onntrackclient.Client
+	Store  Store
+
+	// Group limits the syncer to the devices in a group.
+	Group string
+
+	// Since is where the history of a device that has nothing in the
+	// store starts. Defaults to DefaultBackfill before the first sync.
+	Since time.Time
+
+	// Window is the time range requested from the platform at once.
+	// Defaults to DefaultWindow.
+	Window time.Duration
+
+	// Lookback is how far before the newest stored position of a device
+	// the history is fetched again, to archive positions that reached the
+	// platform late. Defaults to DefaultLookback.
+	Lookback time.Duration
+
+	// Interval is the time between syncs. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// Reauthenticate, if set, is called when the platform rejects the
+	// session, after which the sync is retried once.
+	Reauthenticate func(ctx context.Context) error
+
+	// Logger receives sync failures. Nothing is logged when it is nil.
+	Logger *slog.Logger
+}
+
+// Run syncs every Interval until ctx is done. Failed syncs are logged and
+// resumed at the next interval.
+func (s *Syncer) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := s.Sync(ctx)
+		if err != nil && s.Reauthenticate != nil && onntrackclient.IsAuthError(err) {
+			if err = s.Reauthenticate(ctx); err == nil {
+				_, err = s.Sync(ctx)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			s.logger().Warn("archive: sync failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync stores the positions every device recorded since its newest stored
+// position, and those that arrived late, and returns how many were stored.
+//
+// A device that fails is skipped until the next sync; the errors of all
+// devices are joined.
+func (s *Syncer) Sync(ctx context.Context) (int, error) {
+	if s.Since.IsZero() {
+		s.Since = time.Now().UTC().Add(-DefaultBackfill)
+	}
+
+	devices, _, err := s.Client.Devices.ListAll(ctx, &onntrackclient.DeviceListOptions{Group: s.Group})
+	if err != nil {
+		return 0, err
+	}
+
+	stored := 0
+	var errs []error
+	for _, d := range devices {
+		n, err := s.SyncDevice(ctx, d.ID)
+		stored += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", d.ID, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return stored, errors.Join(errs...)
+}
+
+// SyncDevice stores the positions a device recorded since Lookback before
+// its newest stored position, or since Since, and returns how many were
+// stored. Positions are stored page by page, so an interrupted sync keeps
+// what it fetched.
+func (s *Syncer) SyncDevice(ctx context.Context, deviceID string) (int, error) {
+	from, ok, err := s.Store.Last(deviceID)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		lookback := s.Lookback
+		if lookback <= 0 {
+			lookback = DefaultLookback
+		}
+		from = from.Add(-lookback)
+	} else {
+		from = s.Since
+		if from.IsZero() {
+			from = time.Now().UTC().Add(-DefaultBackfill)
+		}
+	}
+
+	window := s.Window
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	// The positions fetched again are skipped by the store
+	stored := 0
+	now := time.Now()
+	for start := from; start.Before(now); start = start.Add(window) {
+		opts := &onntrackclient.HistoryOptions{From: start, To: start.Add(window)}
+		err := s.Client.Positions.WalkHistory(ctx, deviceID, opts, func(page []*onntrackclient.Position) error {
+			n, err := s.Store.Append(deviceID, page)
+			stored += n
+			return err
+		})
+		if err != nil {
+			return stored, err
+		}
+	}
+
+	return stored, nil
+}
+
+func (s *Syncer) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return s.Logger
+}
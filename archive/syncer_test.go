@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+func TestSyncer_Sync(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	history := []time.Time{now.Add(-50 * time.Hour), now.Add(-26 * time.Hour), now.Add(-2 * time.Hour)}
+	failHistory := false
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices":
+			w.Write([]byte(`{"ok": true, "data": [{"id": "1"}]}`))
+		case "/positions/history":
+			if failHistory {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			from, _ := time.Parse(onntrackclient.TimeLayout, r.URL.Query().Get("startTime"))
+			to, _ := time.Parse(onntrackclient.TimeLayout, r.URL.Query().Get("endTime"))
+			var data []map[string]any
+			for _, at := range history {
+				if !at.Before(from) && at.Before(to) {
+					data = append(data, map[string]any{"lat": 52.1, "lng": 4.1, "gpsTime": at.Format(onntrackclient.TimeLayout)})
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": data})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	store, err := OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	defer store.Close()
+
+	syncer := &Syncer{Client: client, Store: store, Since: now.Add(-72 * time.Hour)}
+	sync := func(want int) {
+		t.Helper()
+		n, err := syncer.Sync(context.Background())
+		if err != nil {
+			t.Fatalf("Sync returned unexpected error: %v", err)
+		}
+		if n != want {
+			t.Errorf("Sync stored %d positions, want %d", n, want)
+		}
+	}
+
+	// The history is fetched a day at a time from Since
+	sync(3)
+	sync(0)
+
+	// A failing device is reported
+	failHistory = true
+	if _, err := syncer.Sync(context.Background()); err == nil {
+		t.Error("Sync with a failing history expected error, got nil")
+	}
+	failHistory = false
+
+	history = append(history, now.Add(-time.Hour))
+	sync(1)
+
+	// A position that reached the platform late is archived once
+	history = append(history, now.Add(-5*time.Hour))
+	sync(1)
+	sync(0)
+
+	last, _, _ := store.Last("1")
+	if want := now.Add(-time.Hour); !last.Equal(want) {
+		t.Errorf("Last = %v, want %v", last, want)
+	}
+}
+
+func TestSyncer_Sync_Pages(t *testing.T) {
+	// Create a test server with 101 devices, over two pages
+	synced := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices":
+			var devices []map[string]any
+			if r.URL.Query().Get("page") == "1" {
+				for i := 1; i <= 100; i++ {
+					devices = append(devices, map[string]any{"id": strconv.Itoa(i)})
+				}
+			} else {
+				devices = append(devices, map[string]any{"id": "101"})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": devices})
+		case "/positions/history":
+			synced[r.URL.Query().Get("deviceId")] = true
+			w.Write([]byte(`{"ok": true, "data": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	store, err := OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore returned unexpected error: %v", err)
+	}
+	defer store.Close()
+
+	syncer := &Syncer{Client: client, Store: store, Since: time.Now().Add(-time.Hour)}
+	if _, err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync returned unexpected error: %v", err)
+	}
+	if len(synced) != 101 || !synced["101"] {
+		t.Errorf("Sync fetched the history of %d devices, want all 101", len(synced))
+	}
+}
@@ -1,68 +1,26 @@
-package onntrackclient
+package onntrackclient_test
 
 import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"net/http/httptest"
 	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
 )
 
 func TestAuthService_Login(t *testing.T) {
-	// Create a test server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check request
-		if r.URL.Path != "/homepage/login" {
-			t.Errorf("Expected request to '/homepage/login', got '%s'", r.URL.Path)
-		}
-		if r.Method != http.MethodPost {
-			t.Errorf("Expected POST request, got '%s'", r.Method)
-		}
-		if r.Header.Get("Authorization") != "null" {
-			t.Errorf("Expected Authorization header 'null', got '%s'", r.Header.Get("Authorization"))
-		}
-		if r.Header.Get("must") != "true" {
-			t.Errorf("Expected must header 'true', got '%s'", r.Header.Get("must"))
-		}
-		if r.Header.Get("Content-Type") != "application/json" {
-			t.Errorf("Expected Content-Type header 'application/json', got '%s'", r.Header.Get("Content-Type"))
-		}
-
-		// Decode request body
-		var loginReq LoginRequest
-		if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-			t.Errorf("Failed to decode request body: %v", err)
-		}
-
-		// Check request body
-		if loginReq.Account != "test@example.com" {
-			t.Errorf("Expected account 'test@example.com', got '%s'", loginReq.Account)
-		}
-		if loginReq.Password != "password123" {
-			t.Errorf("Expected password 'password123', got '%s'", loginReq.Password)
-		}
-		if loginReq.Language != "en" {
-			t.Errorf("Expected language 'en', got '%s'", loginReq.Language)
-		}
-
-		// Return a mock response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"token":   "test-token-123",
-			"message": "Login successful",
-		})
-	}))
-	defer server.Close()
+	srv := onntracktest.NewServer()
+	defer srv.Close()
 
 	// Create a client that uses the test server
-	client, _ := NewClient(WithBaseURL(server.URL))
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(srv.URL))
 
 	// Create login request
-	loginReq := &LoginRequest{
-		Account:   "test@example.com",
-		Password:  "password123",
+	loginReq := &onntrackclient.LoginRequest{
+		Account:   onntracktest.DefaultAccount,
+		Password:  onntracktest.DefaultPassword,
 		Language:  "en",
 		ValidCode: "",
 		NodeID:    "",
@@ -82,18 +40,104 @@ func TestAuthService_Login(t *testing.T) {
 	}
 
 	// Check parsed data
-	if !loginResp.Success {
-		t.Errorf("Login success = %v, want %v", loginResp.Success, true)
-	}
-	if loginResp.Token != "test-token-123" {
-		t.Errorf("Login token = %v, want %v", loginResp.Token, "test-token-123")
+	if !loginResp.OK {
+		t.Errorf("Login ok = %v, want %v", loginResp.OK, true)
 	}
-	if loginResp.Message != "Login successful" {
-		t.Errorf("Login message = %v, want %v", loginResp.Message, "Login successful")
+	if loginResp.Data.Token == "" {
+		t.Error("Login token is empty")
 	}
 
 	// Check that the client's API key was updated
-	if client.APIKey != "test-token-123" {
-		t.Errorf("Client APIKey = %v, want %v", client.APIKey, "test-token-123")
+	if client.APIKey != loginResp.Data.Token {
+		t.Errorf("Client APIKey = %v, want %v", client.APIKey, loginResp.Data.Token)
+	}
+
+	// Check the request
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if req.Method != http.MethodPost || req.Path != "homepage/login" {
+		t.Errorf("request = %s %s, want POST homepage/login", req.Method, req.Path)
+	}
+	if req.Header.Get("must") != "true" {
+		t.Errorf("Expected must header 'true', got '%s'", req.Header.Get("must"))
+	}
+	if req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected Content-Type header 'application/json', got '%s'", req.Header.Get("Content-Type"))
+	}
+
+	var body onntrackclient.LoginRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("Failed to decode request body: %v", err)
+	}
+	if body.Language != "en" {
+		t.Errorf("Expected language 'en', got '%s'", body.Language)
+	}
+}
+
+func TestAuthService_Login_Failure(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(srv.URL))
+
+	loginResp, _, err := client.Auth.Login(context.Background(), &onntrackclient.LoginRequest{
+		Account:  onntracktest.DefaultAccount,
+		Password: "wrong",
+	})
+	if err != nil {
+		t.Fatalf("Login returned unexpected error: %v", err)
+	}
+	if loginResp.OK || loginResp.Code != onntracktest.CodeBadCredentials {
+		t.Errorf("Login = %+v, want code %d", loginResp, onntracktest.CodeBadCredentials)
+	}
+	if client.APIKey != "" {
+		t.Errorf("Client APIKey = %v, want it unchanged", client.APIKey)
+	}
+}
+
+func TestProfile_Login(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddAccount("ops@example.com", "secret")
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(srv.URL))
+	profile := &onntrackclient.Profile{Name: "default", Account: onntracktest.DefaultAccount}
+
+	// Without a password there is nothing to log in with
+	t.Setenv(onntrackclient.PasswordEnv, "")
+	if login := profile.Login(client); login != nil {
+		t.Error("Login without a password returned a function, want nil")
+	}
+
+	// The account in the environment wins over the profile's
+	t.Setenv(onntrackclient.PasswordEnv, "secret")
+	t.Setenv(onntrackclient.AccountEnv, "ops@example.com")
+	login := profile.Login(client)
+	if err := login(context.Background()); err != nil {
+		t.Fatalf("login returned unexpected error: %v", err)
+	}
+	if client.APIKey == "" {
+		t.Error("Client APIKey is empty after login")
+	}
+
+	// An expired session is an auth error until the next login
+	srv.ExpireTokens()
+	_, _, err := client.Devices.List(context.Background(), nil)
+	if !onntrackclient.IsAuthError(err) {
+		t.Errorf("IsAuthError(%v) = false, want true", err)
+	}
+	if err := login(context.Background()); err != nil {
+		t.Fatalf("login returned unexpected error: %v", err)
+	}
+	if _, _, err := client.Devices.List(context.Background(), nil); err != nil {
+		t.Errorf("List after a new login returned %v", err)
+	}
+
+	srv.FailLogins(onntracktest.CodeBadCredentials, "bad credentials")
+	if err := login(context.Background()); err == nil || onntrackclient.IsAuthError(err) {
+		t.Errorf("login error = %v, want a failed login", err)
 	}
 }
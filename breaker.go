@@ -0,0 +1,250 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests a CircuitBreaker rejects without
+// sending them.
+var ErrCircuitOpen = errors.New("onntrackclient: circuit open")
+
+// CircuitState is the state of a circuit.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through and counts failures.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects requests with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen lets trial requests through to find out whether the
+	// platform has recovered.
+	CircuitHalfOpen
+)
+
+// String returns "closed", "open" or "half-open".
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitScope selects what a circuit covers.
+type CircuitScope int
+
+const (
+	// PerHost keeps one circuit per platform host.
+	PerHost CircuitScope = iota
+
+	// PerEndpoint keeps one circuit per method and endpoint template, such
+	// as "GET devices/{id}".
+	PerEndpoint
+)
+
+// Defaults of BreakerConfig.
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// BreakerConfig configures a CircuitBreaker.
+type BreakerConfig struct {
+	// Scope selects whether circuits are kept per host or per endpoint.
+	Scope CircuitScope
+
+	// FailureThreshold is the number of consecutive failures that open a
+	// circuit. Failures are network errors, timeouts and responses with
+	// status 429 or 5xx. DefaultFailureThreshold is used when it is zero.
+	FailureThreshold int
+
+	// OpenTimeout is how long a circuit stays open before it lets a trial
+	// request through. DefaultOpenTimeout is used when it is zero.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of trial requests that must succeed
+	// to close a circuit again. At most this many are sent at a time; one
+	// is used when it is zero.
+	HalfOpenRequests int
+
+	// OnStateChange, if set, is called when a circuit changes state, with
+	// the host or endpoint the circuit covers. It is called from the
+	// goroutine of the request that caused the change and must be safe for
+	// concurrent use.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// CircuitBreaker stops sending requests to the platform while it keeps
+// failing, so callers fail fast with ErrCircuitOpen instead of waiting for
+// timeouts. It is safe for concurrent use. See WithCircuitBreaker.
+type CircuitBreaker struct {
+	config BreakerConfig
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of one host or endpoint.
+type circuit struct {
+	state     CircuitState
+	failures  int
+	successes int
+	trials    int
+	openedAt  time.Time
+}
+
+// NewCircuitBreaker returns a circuit breaker with all circuits closed.
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = DefaultOpenTimeout
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{config: config, circuits: make(map[string]*circuit)}
+}
+
+// WithCircuitBreaker returns a ClientOption that sends requests through a
+// circuit breaker. The breaker sits in the middleware chain after the
+// response cache and before retries, so cached responses are still served
+// while a circuit is open and a retried request counts as one outcome.
+func WithCircuitBreaker(breaker *CircuitBreaker) ClientOption {
+	return func(c *Client) error {
+		c.breaker = breaker
+		return nil
+	}
+}
+
+// State returns the state of the circuit for a host or endpoint. An open
+// circuit turns half-open with the first request after OpenTimeout.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[key]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// middleware returns the circuit breaker middleware for a client.
+func (b *CircuitBreaker) middleware(client *Client) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			key := req.URL.Host
+			if b.config.Scope == PerEndpoint {
+				key = req.Method + " " + client.endpoint(req.URL)
+			}
+
+			if !b.allow(key) {
+				return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+			}
+
+			resp, err := next.RoundTrip(req)
+			b.record(key, resp, err)
+			return resp, err
+		})
+	}
+}
+
+// allow reports whether a request may be sent, moving an open circuit
+// whose timeout has passed to half-open.
+func (b *CircuitBreaker) allow(key string) bool {
+	b.mu.Lock()
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	from := c.state
+	allowed := true
+	switch c.state {
+	case CircuitOpen:
+		if time.Since(c.openedAt) < b.config.OpenTimeout {
+			allowed = false
+			break
+		}
+		c.state, c.successes, c.trials = CircuitHalfOpen, 0, 1
+	case CircuitHalfOpen:
+		if c.trials >= b.config.HalfOpenRequests {
+			allowed = false
+			break
+		}
+		c.trials++
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.changed(key, from, to)
+	return allowed
+}
+
+// record counts the outcome of a request. Requests the caller gave up on
+// say nothing about the platform: they only give up their trial slot.
+func (b *CircuitBreaker) record(key string, resp *http.Response, err error) {
+	canceled := err != nil && errors.Is(err, context.Canceled)
+	failed := false
+	switch {
+	case err != nil:
+		failed = !canceled
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		failed = true
+	}
+
+	b.mu.Lock()
+	c := b.circuits[key]
+	from := c.state
+	switch c.state {
+	case CircuitClosed:
+		if canceled {
+			break
+		}
+		if !failed {
+			c.failures = 0
+			break
+		}
+		c.failures++
+		if c.failures >= b.config.FailureThreshold {
+			c.state, c.openedAt = CircuitOpen, time.Now()
+		}
+	case CircuitHalfOpen:
+		if c.trials > 0 {
+			c.trials--
+		}
+		if canceled {
+			break
+		}
+		if failed {
+			c.state, c.openedAt = CircuitOpen, time.Now()
+			break
+		}
+		c.successes++
+		if c.successes >= b.config.HalfOpenRequests {
+			c.state, c.failures = CircuitClosed, 0
+		}
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.changed(key, from, to)
+}
+
+func (b *CircuitBreaker) changed(key string, from, to CircuitState) {
+	if from != to && b.config.OnStateChange != nil {
+		b.config.OnStateChange(key, from, to)
+	}
+}
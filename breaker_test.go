@@ -0,0 +1,152 @@
+package onntrackclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	var mu sync.Mutex
+	var changes []string
+	breaker := onntrackclient.NewCircuitBreaker(onntrackclient.BreakerConfig{
+		FailureThreshold: 3,
+		OpenTimeout:      20 * time.Millisecond,
+		OnStateChange: func(key string, from, to onntrackclient.CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, from, to))
+		},
+	})
+	client := srv.Client(onntrackclient.WithCircuitBreaker(breaker))
+	ctx := context.Background()
+
+	// Consecutive failures open the circuit
+	srv.AddFault(onntracktest.Fault{Status: http.StatusServiceUnavailable})
+	for range 3 {
+		client.Devices.List(ctx, nil)
+	}
+	if state := breaker.State(u.Host); state != onntrackclient.CircuitOpen {
+		t.Fatalf("State = %v, want open", state)
+	}
+
+	// An open circuit fails fast, with the ID of the request
+	_, _, err := client.Devices.List(ctx, nil)
+	if !errors.Is(err, onntrackclient.ErrCircuitOpen) {
+		t.Errorf("List returned %v, want ErrCircuitOpen", err)
+	}
+	var reqErr *onntrackclient.RequestError
+	if !errors.As(err, &reqErr) || reqErr.RequestID == "" {
+		t.Errorf("List returned %v, want a RequestError with the request ID", err)
+	}
+	srv.AssertCalled(t, http.MethodGet, "devices", 3)
+
+	// A failed trial opens it again
+	time.Sleep(30 * time.Millisecond)
+	client.Devices.List(ctx, nil)
+	if state := breaker.State(u.Host); state != onntrackclient.CircuitOpen {
+		t.Errorf("State after a failed trial = %v, want open", state)
+	}
+
+	// A successful trial closes it
+	srv.ClearFaults()
+	time.Sleep(30 * time.Millisecond)
+	if _, _, err := client.Devices.List(ctx, nil); err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	if state := breaker.State(u.Host); state != onntrackclient.CircuitClosed {
+		t.Errorf("State = %v, want closed", state)
+	}
+
+	want := []string{
+		u.Host + ": closed -> open",
+		u.Host + ": open -> half-open",
+		u.Host + ": half-open -> open",
+		u.Host + ": open -> half-open",
+		u.Host + ": half-open -> closed",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("state changes = %v, want %v", changes, want)
+	}
+}
+
+func TestWithCircuitBreaker_Canceled(t *testing.T) {
+	// Create a transport that fails every request the caller did not cancel
+	transport := onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+	})
+	breaker := onntrackclient.NewCircuitBreaker(onntrackclient.BreakerConfig{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond})
+	client, _ := onntrackclient.NewClient(
+		onntrackclient.WithBaseURL("https://platform.example.com/"),
+		onntrackclient.WithHTTPClient(&http.Client{Transport: transport}),
+		onntrackclient.WithCircuitBreaker(breaker),
+	)
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	// A canceled request does not reset the failures
+	client.Devices.List(ctx, nil)
+	client.Devices.List(canceled, nil)
+	client.Devices.List(ctx, nil)
+	if state := breaker.State("platform.example.com"); state != onntrackclient.CircuitOpen {
+		t.Fatalf("State = %v, want open", state)
+	}
+
+	// A canceled trial neither closes the circuit nor keeps its slot
+	time.Sleep(30 * time.Millisecond)
+	client.Devices.List(canceled, nil)
+	if state := breaker.State("platform.example.com"); state != onntrackclient.CircuitHalfOpen {
+		t.Fatalf("State after a canceled trial = %v, want half-open", state)
+	}
+	if _, _, err := client.Devices.List(ctx, nil); errors.Is(err, onntrackclient.ErrCircuitOpen) {
+		t.Errorf("List after a canceled trial returned %v, want a trial request", err)
+	}
+	if state := breaker.State("platform.example.com"); state != onntrackclient.CircuitOpen {
+		t.Errorf("State after a failed trial = %v, want open", state)
+	}
+}
+
+func TestWithCircuitBreaker_PerEndpoint(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{ID: "1"})
+
+	breaker := onntrackclient.NewCircuitBreaker(onntrackclient.BreakerConfig{Scope: onntrackclient.PerEndpoint, FailureThreshold: 1})
+	client := srv.Client(onntrackclient.WithCircuitBreaker(breaker))
+	ctx := context.Background()
+
+	// Circuits are separate per endpoint, and platform errors in the
+	// envelope are no failures
+	srv.AddFault(onntracktest.Fault{Path: "positions/latest", Status: http.StatusGatewayTimeout, Times: 1})
+	client.Positions.Latest(ctx)
+	client.Devices.Get(ctx, "9")
+
+	if _, _, err := client.Positions.Latest(ctx); !errors.Is(err, onntrackclient.ErrCircuitOpen) {
+		t.Errorf("Latest returned %v, want ErrCircuitOpen", err)
+	}
+	if _, _, err := client.Devices.Get(ctx, "1"); err != nil {
+		t.Errorf("Get returned %v, want the devices/{id} circuit closed", err)
+	}
+	if state := breaker.State("GET positions/latest"); state != onntrackclient.CircuitOpen {
+		t.Errorf("State = %v, want open", state)
+	}
+}
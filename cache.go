@@ -0,0 +1,288 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of responses a Cache keeps when
+// CacheConfig.MaxEntries is zero.
+const DefaultCacheSize = 1000
+
+// CacheConfig configures a Cache.
+type CacheConfig struct {
+	// MaxEntries is the number of responses kept. The least recently used
+	// response is evicted to make room for a new one.
+	MaxEntries int
+
+	// TTL is how long responses are fresh, by endpoint template such as
+	// "devices/{id}". Only GET requests to the endpoints listed are cached.
+	TTL map[string]time.Duration
+}
+
+// CacheStats are the counters of a Cache.
+type CacheStats struct {
+	// Hits counts requests answered from the cache, including those
+	// revalidated with the platform.
+	Hits uint64
+
+	// Misses counts cacheable requests sent to the platform.
+	Misses uint64
+
+	// Revalidations counts stale responses the platform confirmed with
+	// 304 Not Modified.
+	Revalidations uint64
+
+	// Evictions counts responses dropped to stay within MaxEntries.
+	Evictions uint64
+
+	// Invalidations counts responses dropped because the resource changed.
+	Invalidations uint64
+
+	// Entries is the number of responses in the cache.
+	Entries int
+}
+
+// Cache is an LRU cache of successful GET responses. It is safe for
+// concurrent use and may be shared by clients. See WithCache.
+type Cache struct {
+	config CacheConfig
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key     string
+	path    string
+	header  http.Header
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// NewCache returns an empty cache.
+func NewCache(config CacheConfig) *Cache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCacheSize
+	}
+	return &Cache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// WithCache returns a ClientOption that answers GET requests from cache
+// while they are fresh. Stale responses with an ETag are revalidated with
+// If-None-Match. A successful PUT, POST or DELETE drops the cached
+// responses of its path and of the collection above it, so updating or
+// deleting a device invalidates the device and the device list.
+//
+// The cache sits in the middleware chain directly after the middleware of
+// WithMiddleware, so cache hits skip retries, authentication and logging.
+func WithCache(cache *Cache) ClientOption {
+	return func(c *Client) error {
+		c.cache = cache
+		return nil
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Purge drops all cached responses.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+}
+
+// middleware returns the cache middleware for a client.
+func (c *Cache) middleware(client *Client) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				resp, err := next.RoundTrip(req)
+				if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+					c.invalidate(req.URL.Path)
+				}
+				return resp, err
+			}
+
+			ttl := c.config.TTL[client.endpoint(req.URL)]
+			if req.Method != http.MethodGet || ttl <= 0 {
+				return next.RoundTrip(req)
+			}
+
+			key := cacheKey(req)
+			entry, fresh := c.lookup(key)
+			if fresh {
+				return entry.response(req), nil
+			}
+
+			out := req
+			if entry != nil && entry.etag != "" {
+				out = req.Clone(req.Context())
+				out.Header.Set("If-None-Match", entry.etag)
+			}
+			resp, err := next.RoundTrip(out)
+			if err != nil {
+				return nil, err
+			}
+
+			if resp.StatusCode == http.StatusNotModified && entry != nil {
+				resp.Body.Close()
+				c.revalidated(entry, ttl)
+				return entry.response(req), nil
+			}
+			if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+				return resp, nil
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Failures the platform reports in the envelope are not cached
+			var envelope struct {
+				OK *bool `json:"ok"`
+			}
+			if json.Unmarshal(body, &envelope) == nil && envelope.OK != nil && !*envelope.OK {
+				return resp, nil
+			}
+
+			c.store(&cacheEntry{
+				key:     key,
+				path:    req.URL.Path,
+				header:  resp.Header.Clone(),
+				body:    body,
+				etag:    resp.Header.Get("ETag"),
+				expires: time.Now().Add(ttl),
+			})
+			return resp, nil
+		})
+	}
+}
+
+// cacheKey returns the cache key of a request: its URL and a hash of its
+// Authorization header, so sessions do not share responses.
+func cacheKey(req *http.Request) string {
+	auth := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+	return req.URL.String() + " " + hex.EncodeToString(auth[:8])
+}
+
+// lookup returns the entry for a key and whether it is fresh. Fresh
+// entries count as hits; everything else counts as a miss.
+func (c *Cache) lookup(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().Before(entry.expires) {
+		c.lru.MoveToFront(el)
+		c.stats.Hits++
+		return entry, true
+	}
+	if entry.etag == "" {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	c.stats.Misses++
+	return entry, false
+}
+
+// revalidated renews an entry the platform confirmed.
+func (c *Cache) revalidated(entry *cacheEntry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The miss counted by lookup turned out to be a hit
+	c.stats.Misses--
+	c.stats.Hits++
+	c.stats.Revalidations++
+
+	if el, ok := c.entries[entry.key]; ok && el.Value == entry {
+		entry.expires = time.Now().Add(ttl)
+		c.lru.MoveToFront(el)
+	}
+}
+
+func (c *Cache) store(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[entry.key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.config.MaxEntries {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// invalidate drops the entries of a path and of the collection it is in.
+func (c *Cache) invalidate(p string) {
+	parent := path.Dir(strings.TrimSuffix(p, "/"))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if entryPath := el.Value.(*cacheEntry).path; entryPath == p || entryPath == parent {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// response returns a response for req with the cached content.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
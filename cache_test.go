@@ -0,0 +1,142 @@
+package onntrackclient_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+func TestWithCache(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{ID: "1", Name: "Van 1", IMEI: "490154203237518"})
+	srv.AddDevice(&onntrackclient.Device{ID: "2", Name: "Van 2", IMEI: "352099001761481"})
+
+	cache := onntrackclient.NewCache(onntrackclient.CacheConfig{
+		TTL: map[string]time.Duration{"devices/{id}": time.Hour, "devices": time.Hour},
+	})
+	client := srv.Client(onntrackclient.WithCache(cache))
+	ctx := context.Background()
+
+	// Repeated requests are answered from the cache
+	for range 3 {
+		device, _, err := client.Devices.Get(ctx, "1")
+		if err != nil {
+			t.Fatalf("Get returned unexpected error: %v", err)
+		}
+		if device.Name != "Van 1" {
+			t.Errorf("Get = %+v, want Van 1", device)
+		}
+	}
+	client.Devices.List(ctx, nil)
+	client.Devices.Get(ctx, "2")
+	srv.AssertCalled(t, http.MethodGet, "devices/1", 1)
+
+	// Endpoints without a TTL are not cached
+	client.Positions.Latest(ctx)
+	client.Positions.Latest(ctx)
+	srv.AssertCalled(t, http.MethodGet, "positions/latest", 2)
+
+	// Updating a device invalidates it and the device list, not other devices
+	if _, _, err := client.Devices.Update(ctx, "1", &onntrackclient.DeviceUpdateRequest{Name: "Van 1b"}); err != nil {
+		t.Fatalf("Update returned unexpected error: %v", err)
+	}
+	device, _, _ := client.Devices.Get(ctx, "1")
+	if device.Name != "Van 1b" {
+		t.Errorf("Get after Update = %+v, want Van 1b", device)
+	}
+	client.Devices.List(ctx, nil)
+	client.Devices.Get(ctx, "2")
+	srv.AssertCalled(t, http.MethodGet, "devices/1", 2)
+	srv.AssertCalled(t, http.MethodGet, "devices", 2)
+	srv.AssertCalled(t, http.MethodGet, "devices/2", 1)
+
+	// Platform failures are not cached
+	client.Devices.Get(ctx, "9")
+	client.Devices.Get(ctx, "9")
+	srv.AssertCalled(t, http.MethodGet, "devices/9", 2)
+
+	want := onntrackclient.CacheStats{Hits: 3, Misses: 7, Invalidations: 2, Entries: 3}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithCache_ETag(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.EnableETags()
+	srv.AddDevice(&onntrackclient.Device{ID: "1", Name: "Van 1"})
+
+	// Responses are stale right away and revalidated every time
+	cache := onntrackclient.NewCache(onntrackclient.CacheConfig{
+		TTL: map[string]time.Duration{"devices/{id}": time.Nanosecond},
+	})
+	client := srv.Client(onntrackclient.WithCache(cache))
+	ctx := context.Background()
+
+	for range 2 {
+		if device, _, err := client.Devices.Get(ctx, "1"); err != nil || device.Name != "Van 1" {
+			t.Fatalf("Get = %+v, %v, want Van 1", device, err)
+		}
+	}
+	requests := srv.Requests()
+	if len(requests) != 2 || requests[1].Header.Get("If-None-Match") == "" {
+		t.Fatalf("second request has no If-None-Match header")
+	}
+	if got := cache.Stats(); got.Hits != 1 || got.Revalidations != 1 || got.Misses != 1 {
+		t.Errorf("Stats = %+v, want 1 revalidated hit and 1 miss", got)
+	}
+
+	// A changed device is fetched again
+	client.Devices.Update(ctx, "1", &onntrackclient.DeviceUpdateRequest{Name: "Van 1b"})
+	if device, _, _ := client.Devices.Get(ctx, "1"); device.Name != "Van 1b" {
+		t.Errorf("Get after Update = %+v, want Van 1b", device)
+	}
+}
+
+func TestCache_Evictions(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	for _, id := range []string{"1", "2", "3"} {
+		srv.AddDevice(&onntrackclient.Device{ID: id})
+	}
+
+	cache := onntrackclient.NewCache(onntrackclient.CacheConfig{
+		MaxEntries: 2,
+		TTL:        map[string]time.Duration{"devices/{id}": time.Hour},
+	})
+	client := srv.Client(onntrackclient.WithCache(cache))
+	ctx := context.Background()
+
+	// Device 1 is used last before 3 comes in, so 2 is evicted
+	for _, id := range []string{"1", "2", "1", "3", "1", "2"} {
+		client.Devices.Get(ctx, id)
+	}
+	srv.AssertCalled(t, http.MethodGet, "devices/1", 1)
+	srv.AssertCalled(t, http.MethodGet, "devices/2", 2)
+	if got := cache.Stats(); got.Evictions != 2 || got.Entries != 2 {
+		t.Errorf("Stats = %+v, want 2 evictions and 2 entries", got)
+	}
+
+	// The cache is safe for concurrent use
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Devices.Get(ctx, []string{"1", "2", "3"}[i%3])
+		}()
+	}
+	wg.Wait()
+
+	cache.Purge()
+	if got := cache.Stats(); got.Entries != 0 {
+		t.Errorf("Stats after Purge = %+v, want no entries", got)
+	}
+}
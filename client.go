@@ -5,11 +5,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
+
+	"github.com/MaikelH/onntrackclient/geo"
 )
 
 const (
@@ -31,12 +35,35 @@ type Client struct {
 	// HTTPClient is the HTTP client used to communicate with the API.
 	HTTPClient *http.Client
 
+	// positionDatum is the datum returned positions are converted to.
+	// Positions are returned as reported when it is empty.
+	positionDatum geo.Datum
+
+	// geocoder fills in the address of returned positions when set.
+	geocoder ReverseGeocoder
+
+	// middleware, cache, breaker, retry and logging make up the middleware
+	// chain of requests. See WithMiddleware.
+	middleware []Middleware
+	cache      *Cache
+	breaker    *CircuitBreaker
+	retry      *RetryPolicy
+	logging    *LoggingTransport
+
+	// metrics and tracer observe every request sent by Do.
+	metrics Metrics
+	tracer  Tracer
+
 	// Common service fields
 	common service
 
 	// Services used for communicating with different parts of the Onntrack API.
-	Auth    *AuthService
-	Devices *DevicesService
+	Auth      *AuthService
+	Devices   *DevicesService
+	Shares    *SharesService
+	Media     *MediaService
+	Positions *PositionsService
+	Alarms    *AlarmsService
 }
 
 type service struct {
@@ -66,6 +93,10 @@ func NewClient(options ...ClientOption) (*Client, error) {
 	c.common.client = c
 	c.Auth = (*AuthService)(&c.common)
 	c.Devices = (*DevicesService)(&c.common)
+	c.Shares = (*SharesService)(&c.common)
+	c.Media = (*MediaService)(&c.common)
+	c.Positions = (*PositionsService)(&c.common)
+	c.Alarms = (*AlarmsService)(&c.common)
 
 	return c, nil
 }
@@ -124,14 +155,65 @@ func (c *Client) NewRequest(ctx context.Context, method, urlPath string, body in
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	if c.platformURL(u) {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	}
+
+	// Every request carries a correlation ID
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		id = newRequestID()
+	}
+	req.Header.Set(RequestIDHeader, id)
 
 	return req, nil
 }
 
-// Do sends an API request and returns the API response.
+// platformURL reports whether u points at the platform, so requests to it
+// may carry the API key. Media files can be hosted elsewhere.
+func (c *Client) platformURL(u *url.URL) bool {
+	return u.Scheme == c.BaseURL.Scheme && u.Host == c.BaseURL.Host
+}
+
+// Do sends an API request and returns the API response. Errors other than
+// an *ErrorResponse, such as transport errors, timeouts, ErrCircuitOpen and
+// decoding errors, are returned as a *RequestError.
 func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
-	resp, err := c.HTTPClient.Do(req)
+	if c.metrics == nil && c.tracer == nil {
+		resp, err := c.do(req, v)
+		return resp, requestError(req, err)
+	}
+
+	ctx := req.Context()
+	info := RequestInfo{Endpoint: c.endpoint(req.URL), Method: req.Method}
+	var span Span
+	if c.tracer != nil {
+		ctx, span = c.tracer.StartSpan(ctx, info.Endpoint, info.Method)
+	}
+	retries := new(int)
+	ctx = context.WithValue(ctx, retriesKey, retries)
+
+	start := time.Now()
+	resp, err := c.do(req.WithContext(ctx), v)
+	err = requestError(req, err)
+
+	info.Duration = time.Since(start)
+	info.Retries = *retries
+	info.Err = err
+	if resp != nil {
+		info.Status = resp.StatusCode
+	}
+	c.observe(ctx, span, info, v)
+
+	return resp, err
+}
+
+// do sends an API request through the middleware chain.
+func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
+	httpClient := *c.HTTPClient
+	httpClient.Transport = c.transport()
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +226,11 @@ func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 
 	if v != nil {
 		if w, ok := v.(io.Writer); ok {
+			if check, ok := w.(responseChecker); ok {
+				if err := check.checkResponse(resp); err != nil {
+					return resp, err
+				}
+			}
 			_, err = io.Copy(w, resp.Body)
 		} else {
 			err = json.NewDecoder(resp.Body).Decode(v)
@@ -153,6 +240,48 @@ func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 	return resp, err
 }
 
+// responseChecker is implemented by writers passed to Do that must see the
+// response before its body is copied into them.
+type responseChecker interface {
+	checkResponse(resp *http.Response) error
+}
+
+// apiResponse is the envelope the platform wraps around response data.
+type apiResponse struct {
+	OK   bool            `json:"ok"`
+	Data json.RawMessage `json:"data"`
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+}
+
+// doData sends an API request, unwraps the platform's response envelope and
+// decodes its data into v. A response with ok set to false is returned as an
+// *ErrorResponse carrying the platform code and message.
+func (c *Client) doData(req *http.Request, v interface{}) (*http.Response, error) {
+	envelope := new(apiResponse)
+	resp, err := c.Do(req, envelope)
+	if err != nil {
+		return resp, err
+	}
+
+	if !envelope.OK {
+		return resp, &ErrorResponse{
+			Response:  resp,
+			Message:   envelope.Msg,
+			Code:      strconv.Itoa(envelope.Code),
+			RequestID: req.Header.Get(RequestIDHeader),
+		}
+	}
+
+	if v != nil && len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, v); err != nil {
+			return resp, requestError(req, err)
+		}
+	}
+
+	return resp, nil
+}
+
 // CheckResponse checks the API response for errors.
 func CheckResponse(r *http.Response) error {
 	if c := r.StatusCode; c >= 200 && c <= 299 {
@@ -160,10 +289,17 @@ func CheckResponse(r *http.Response) error {
 	}
 
 	errorResponse := &ErrorResponse{Response: r}
+	if r.Request != nil {
+		errorResponse.RequestID = r.Request.Header.Get(RequestIDHeader)
+	}
 	data, err := io.ReadAll(r.Body)
 	if err == nil && len(data) > 0 {
-		err := json.Unmarshal(data, errorResponse)
-		if err != nil {
+		// Errors come in the platform envelope or as a message and code
+		envelope := new(apiResponse)
+		if json.Unmarshal(data, envelope) == nil && envelope.Msg != "" {
+			errorResponse.Message = envelope.Msg
+			errorResponse.Code = strconv.Itoa(envelope.Code)
+		} else if err := json.Unmarshal(data, errorResponse); err != nil {
 			errorResponse.Message = string(data)
 		}
 	}
@@ -176,10 +312,61 @@ type ErrorResponse struct {
 	Response *http.Response
 	Message  string `json:"message"`
 	Code     string `json:"code"`
+
+	// RequestID is the correlation ID the request was sent with.
+	RequestID string `json:"-"`
 }
 
 func (r *ErrorResponse) Error() string {
-	return fmt.Sprintf("%v %v: %d %v %v",
+	msg := fmt.Sprintf("%v %v: %d %v %v",
 		r.Response.Request.Method, r.Response.Request.URL,
 		r.Response.StatusCode, r.Message, r.Code)
+	if r.RequestID != "" {
+		msg += fmt.Sprintf(" (request %s)", r.RequestID)
+	}
+	return msg
+}
+
+// RequestError reports an error that occurred while sending an API request
+// or reading its response, such as a transport error, a timeout,
+// ErrCircuitOpen or a decoding error. Use errors.Is and errors.As to inspect
+// the underlying error.
+type RequestError struct {
+	// RequestID is the correlation ID the request was sent with.
+	RequestID string
+
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	if e.RequestID == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (request %s)", e.Err, e.RequestID)
+}
+
+// Unwrap returns the underlying error.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// requestError attaches the request ID of req to err. An *ErrorResponse
+// already carries it and is returned as is.
+func requestError(req *http.Request, err error) error {
+	var errResp *ErrorResponse
+	if err == nil || errors.As(err, &errResp) {
+		return err
+	}
+	return &RequestError{RequestID: req.Header.Get(RequestIDHeader), Err: err}
+}
+
+// IsAuthError reports whether err, or an error wrapped or joined in it, is
+// an *ErrorResponse with status 401, meaning the platform rejected the
+// session token and a new login is needed.
+func IsAuthError(err error) bool {
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	return errResp.Response.StatusCode == http.StatusUnauthorized
 }
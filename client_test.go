@@ -1,17 +1,19 @@
-package onntrackclient
+package onntrackclient_test
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"log/slog"
 	"net/http"
-	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
 )
 
 func TestNewClient(t *testing.T) {
-	client, err := NewClient("test-api-key")
+	client, err := onntrackclient.NewClient(onntrackclient.WithAPIKey("test-api-key"))
 	if err != nil {
 		t.Fatalf("NewClient returned unexpected error: %v", err)
 	}
@@ -20,8 +22,8 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("NewClient APIKey = %v, want %v", client.APIKey, "test-api-key")
 	}
 
-	if client.BaseURL.String() != DefaultBaseURL {
-		t.Errorf("NewClient BaseURL = %v, want %v", client.BaseURL.String(), DefaultBaseURL)
+	if client.BaseURL.String() != onntrackclient.DefaultBaseURL {
+		t.Errorf("NewClient BaseURL = %v, want %v", client.BaseURL.String(), onntrackclient.DefaultBaseURL)
 	}
 
 	if client.HTTPClient == nil {
@@ -30,7 +32,7 @@ func TestNewClient(t *testing.T) {
 }
 
 func TestWithBaseURL(t *testing.T) {
-	client, err := NewClient(WithBaseURL("https://custom-api.example.com"))
+	client, err := onntrackclient.NewClient(onntrackclient.WithBaseURL("https://custom-api.example.com"))
 	if err != nil {
 		t.Fatalf("NewClient returned unexpected error: %v", err)
 	}
@@ -41,28 +43,26 @@ func TestWithBaseURL(t *testing.T) {
 }
 
 func TestWithLogger(t *testing.T) {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	client, err := NewClient(WithLogger(logger))
-	if err != nil {
-		t.Fatalf("NewClient returned unexpected error: %v", err)
-	}
+	srv := onntracktest.NewServer()
+	defer srv.Close()
 
-	// Check that the transport is a LoggingTransport
-	transport, ok := client.HTTPClient.Transport.(*LoggingTransport)
-	if !ok {
-		t.Fatalf("WithLogger did not set LoggingTransport, got %T", client.HTTPClient.Transport)
-	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	// The logger stays in place when the HTTP client is replaced afterwards
+	client := srv.Client(onntrackclient.WithLogger(logger), onntrackclient.WithHTTPClient(&http.Client{}))
+	client.Devices.List(context.Background(), nil)
 
-	if transport.Logger != logger {
-		t.Errorf("WithLogger Logger = %v, want %v", transport.Logger, logger)
+	if got := strings.Count(buf.String(), "msg=\"API request\""); got != 1 {
+		t.Errorf("WithLogger logged %d requests, want 1:\n%s", got, buf.String())
 	}
 }
 
 func TestClient_NewRequest(t *testing.T) {
-	client, _ := NewClient("test-api-key")
+	client, _ := onntrackclient.NewClient(onntrackclient.WithAPIKey("test-api-key"))
 
-	inURL, outURL := "foo", DefaultBaseURL+"foo"
-	inBody, outBody := &DeviceCreateRequest{Name: "test-device"}, `{"name":"test-device","type":"","imei":""}`+"\n"
+	inURL, outURL := "foo", onntrackclient.DefaultBaseURL+"foo"
+	inBody, outBody := &onntrackclient.DeviceCreateRequest{Name: "test-device"}, `{"name":"test-device","type":"","imei":""}`+"\n"
 	req, _ := client.NewRequest(context.Background(), http.MethodPost, inURL, inBody)
 
 	// Test that the URL was correctly formed
@@ -90,41 +90,19 @@ func TestClient_NewRequest(t *testing.T) {
 }
 
 func TestClient_Do(t *testing.T) {
-	// Create a test server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/devices" {
-			t.Errorf("Expected request to '/devices', got '%s'", r.URL.Path)
-		}
-		if r.Method != http.MethodGet {
-			t.Errorf("Expected GET request, got '%s'", r.Method)
-		}
-		if r.Header.Get("Authorization") != "Bearer test-api-key" {
-			t.Errorf("Expected Authorization header 'Bearer test-api-key', got '%s'", r.Header.Get("Authorization"))
-		}
-
-		// Return a mock response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]*Device{
-			{
-				ID:          "device-1",
-				Name:        "Test Device 1",
-				Type:        "tracker",
-				IMEI:        "123456789012345",
-				Status:      "active",
-				LastUpdated: "2023-01-01T12:00:00Z",
-			},
-		})
-	}))
-	defer server.Close()
-
-	// Create a client that uses the test server
-	client, _ := NewClient(WithBaseURL(server.URL))
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{ID: "device-1", Name: "Test Device 1"})
+
+	client := srv.Client()
 
 	// Make a request
 	req, _ := client.NewRequest(context.Background(), http.MethodGet, "devices", nil)
-	var devices []*Device
-	resp, err := client.Do(req, &devices)
+	var envelope struct {
+		OK   bool                     `json:"ok"`
+		Data []*onntrackclient.Device `json:"data"`
+	}
+	resp, err := client.Do(req, &envelope)
 
 	// Check for errors
 	if err != nil {
@@ -137,53 +115,27 @@ func TestClient_Do(t *testing.T) {
 	}
 
 	// Check parsed data
-	if len(devices) != 1 {
-		t.Fatalf("Do returned %d devices, want 1", len(devices))
+	if !envelope.OK || len(envelope.Data) != 1 {
+		t.Fatalf("Do returned %+v, want one device", envelope)
 	}
-	if devices[0].ID != "device-1" {
-		t.Errorf("Device ID = %v, want %v", devices[0].ID, "device-1")
+	if envelope.Data[0].ID != "device-1" {
+		t.Errorf("Device ID = %v, want %v", envelope.Data[0].ID, "device-1")
 	}
-	if devices[0].Name != "Test Device 1" {
-		t.Errorf("Device Name = %v, want %v", devices[0].Name, "Test Device 1")
+
+	// Check the request
+	requests := srv.Requests()
+	if got := requests[0].Header.Get("Authorization"); got != "Bearer "+client.APIKey {
+		t.Errorf("Authorization = %v, want the client's token", got)
 	}
 }
 
 func TestDevicesService_List(t *testing.T) {
-	// Create a test server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/devices" {
-			t.Errorf("Expected request to '/devices', got '%s'", r.URL.Path)
-		}
-		if r.Method != http.MethodGet {
-			t.Errorf("Expected GET request, got '%s'", r.Method)
-		}
-
-		// Return a mock response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]*Device{
-			{
-				ID:          "device-1",
-				Name:        "Test Device 1",
-				Type:        "tracker",
-				IMEI:        "123456789012345",
-				Status:      "active",
-				LastUpdated: "2023-01-01T12:00:00Z",
-			},
-			{
-				ID:          "device-2",
-				Name:        "Test Device 2",
-				Type:        "tracker",
-				IMEI:        "987654321098765",
-				Status:      "inactive",
-				LastUpdated: "2023-01-02T12:00:00Z",
-			},
-		})
-	}))
-	defer server.Close()
-
-	// Create a client that uses the test server
-	client, _ := NewClient(WithBaseURL(server.URL))
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{ID: "device-1", Name: "Test Device 1", IMEI: "490154203237518", Status: "active"})
+	srv.AddDevice(&onntrackclient.Device{ID: "device-2", Name: "Test Device 2", IMEI: "352099001761481", Status: "inactive"})
+
+	client := srv.Client()
 
 	// Call the List method
 	devices, resp, err := client.Devices.List(context.Background(), nil)
@@ -208,4 +160,11 @@ func TestDevicesService_List(t *testing.T) {
 	if devices[1].ID != "device-2" {
 		t.Errorf("Device ID = %v, want %v", devices[1].ID, "device-2")
 	}
+
+	// Filters are sent as query parameters
+	devices, _, _ = client.Devices.List(context.Background(), &onntrackclient.DeviceListOptions{Status: "inactive"})
+	if len(devices) != 1 || devices[0].ID != "device-2" {
+		t.Errorf("List with status inactive = %+v, want device-2", devices)
+	}
+	srv.AssertCalled(t, http.MethodGet, "devices", 2)
 }
@@ -0,0 +1,296 @@
+// Command onntrack-archive keeps a local archive of the position history of
+// Onntrack devices.
+//
+// Usage:
+//
+//	onntrack-archive [-dir DIR] sync [-since 2024-01-01] [-interval 15m] [-group G] [-once]
+//	onntrack-archive [-dir DIR] query [-from T] [-to T] [-devices] (-device ID | -bbox S,W,N,E | -near LAT,LNG -radius M)
+//
+// The archive is kept in DIR, by default onntrack/archive-PROFILE in the
+// user config directory. Every sync continues after the newest archived
+// position of each device, so the command can be stopped at any time and
+// nothing is archived twice. The day before it is fetched again, to archive
+// positions that devices uploaded late. Devices without archived positions
+// start at -since, by default 90 days ago.
+//
+// The query command reads the archive without contacting the platform. It
+// prints the positions of a device, the positions inside a bounding box or
+// the positions within -radius metres of a point as JSON lines, oldest
+// first. With -devices only the IDs of the devices are printed, so
+//
+//	onntrack-archive query -near 52.3731,4.8926 -radius 200 -from 2024-05-01 -to 2024-05-02 -devices
+//
+// lists who was within 200 metres of Dam Square on 1 May 2024. Coordinates
+// are WGS-84; times are dates or "2006-01-02 15:04:05" in UTC.
+//
+// The platform connection is configured through the profile selected with
+// -profile or ONNTRACK_PROFILE, see onntrackclient.Config. When
+// ONNTRACK_PASSWORD is set the command logs in at start and again whenever
+// the session expires; otherwise the token cached by onntrack login is used.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/archive"
+)
+
+const usage = `Usage: onntrack-archive [flags] <command> [arguments]
+
+Commands:
+  sync    copy new positions from the platform into the archive
+  query   search the archive
+
+Flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-archive", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	dir := fs.String("dir", "", "archive directory")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	profile, options, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+		return 2
+	}
+
+	if *dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+			return 2
+		}
+		*dir = filepath.Join(configDir, "onntrack", "archive-"+profile.Name)
+	}
+
+	store, err := archive.OpenFileStore(*dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	switch fs.Arg(0) {
+	case "sync":
+		client, err := onntrackclient.NewClient(options...)
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+			return 2
+		}
+		return runSync(ctx, client, profile, store, fs.Args()[1:], stderr)
+	case "query":
+		return runQuery(store, fs.Args()[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "onntrack-archive: unknown command %q\n", fs.Arg(0))
+		return 2
+	}
+}
+
+func runSync(ctx context.Context, client *onntrackclient.Client, profile *onntrackclient.Profile, store archive.Store, args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-archive sync", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	since := fs.String("since", "", "start of the history of devices not in the archive yet (default 90 days ago)")
+	interval := fs.Duration("interval", archive.DefaultInterval, "time between syncs")
+	group := fs.String("group", "", "only archive devices in this group")
+	once := fs.Bool("once", false, "sync once and exit")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *interval < time.Minute {
+		fmt.Fprintln(stderr, "onntrack-archive: -interval must be at least 1m")
+		return 2
+	}
+
+	syncer := &archive.Syncer{
+		Client:   client,
+		Store:    store,
+		Group:    *group,
+		Interval: *interval,
+		Logger:   slog.New(slog.NewTextHandler(stderr, nil)),
+	}
+	if *since != "" {
+		t, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: invalid -since %q, want YYYY-MM-DD\n", *since)
+			return 2
+		}
+		syncer.Since = t
+	}
+
+	login := profile.Login(client)
+	if login != nil {
+		if err := login(ctx); err != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+			return 3
+		}
+	}
+	syncer.Reauthenticate = login
+
+	if *once {
+		n, err := syncer.Sync(ctx)
+		fmt.Fprintf(stderr, "Archived %d positions\n", n)
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := syncer.Run(ctx); err != nil {
+		fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runQuery(store *archive.FileStore, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-archive query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	device := fs.String("device", "", "positions of this device")
+	bbox := fs.String("bbox", "", "positions inside the box south,west,north,east")
+	near := fs.String("near", "", "positions near the point lat,lng")
+	radius := fs.Float64("radius", 100, "distance in metres from the -near point")
+	fromFlag := fs.String("from", "", "only positions recorded at or after this time")
+	toFlag := fs.String("to", "", "only positions recorded before this time")
+	devices := fs.Bool("devices", false, "print the IDs of the devices instead of the positions")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	from, err := parseTime(*fromFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-archive: invalid -from: %v\n", err)
+		return 2
+	}
+	to, err := parseTime(*toFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-archive: invalid -to: %v\n", err)
+		return 2
+	}
+
+	var positions []*onntrackclient.Position
+	switch {
+	case *device != "":
+		positions, err = store.Range(*device, from, to)
+	case *bbox != "":
+		coords, perr := parseFloats(*bbox, 4)
+		if perr != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: invalid -bbox: %v\n", perr)
+			return 2
+		}
+		box := archive.BoundingBox{MinLat: coords[0], MinLng: coords[1], MaxLat: coords[2], MaxLng: coords[3]}
+		positions, err = store.Within(box, from, to)
+	case *near != "":
+		coords, perr := parseFloats(*near, 2)
+		if perr != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: invalid -near: %v\n", perr)
+			return 2
+		}
+		positions, err = store.Near(coords[0], coords[1], *radius, from, to)
+	default:
+		fmt.Fprintln(stderr, "onntrack-archive: one of -device, -bbox and -near is required")
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+		return 1
+	}
+
+	if *devices {
+		for _, id := range archive.DeviceIDs(positions) {
+			fmt.Fprintln(stdout, id)
+		}
+		return 0
+	}
+
+	enc := json.NewEncoder(stdout)
+	for _, p := range positions {
+		if err := enc.Encode(p); err != nil {
+			fmt.Fprintf(stderr, "onntrack-archive: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseTime parses a date or date-time in UTC. An empty string is the zero
+// time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{onntrackclient.TimeLayout, time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date or time", s)
+}
+
+// parseFloats parses n comma-separated numbers.
+func parseFloats(s string, n int) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, fmt.Errorf("want %d comma-separated numbers, got %q", n, s)
+	}
+
+	values := make([]float64, n)
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", field)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
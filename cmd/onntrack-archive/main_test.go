@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+// newTestServer starts a fake platform with device 1 and its positions 26
+// and 2 hours before now.
+func newTestServer(t *testing.T, now time.Time) *onntracktest.Server {
+	srv := onntracktest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddDevice(&onntrackclient.Device{ID: "1", IMEI: "490154203237518"})
+	for _, at := range []time.Time{now.Add(-26 * time.Hour), now.Add(-2 * time.Hour)} {
+		srv.AddPosition(&onntrackclient.Position{DeviceID: "1", Lat: 52.3731, Lng: 4.8926, Time: onntrackclient.Timestamp{Time: at}})
+	}
+	return srv
+}
+
+// writeConfig writes a profile for srv with a cached token of the default
+// account and returns its path.
+func writeConfig(t *testing.T, srv *onntracktest.Server) string {
+	t.Setenv(onntrackclient.PasswordEnv, "")
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte(srv.IssueToken(onntracktest.DefaultAccount)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	configFile := filepath.Join(dir, "config")
+	config := "[default]\nbase_url = " + srv.URL + "\ntoken_cache = " + tokenFile + "\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	return configFile
+}
+
+func runArchive(configFile, dir string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", configFile, "-dir", dir}, args...)
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_SyncQuery(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	configFile := writeConfig(t, newTestServer(t, now))
+	dir := t.TempDir()
+	since := now.Add(-72 * time.Hour).Format("2006-01-02")
+
+	code, _, stderr := runArchive(configFile, dir, "sync", "-since", since, "-once")
+	if code != 0 {
+		t.Fatalf("onntrack-archive sync exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "Archived 2 positions\n") {
+		t.Errorf("stderr = %q, want 2 archived positions", stderr)
+	}
+
+	// Nothing is archived twice
+	code, _, stderr = runArchive(configFile, dir, "sync", "-since", since, "-once")
+	if code != 0 {
+		t.Fatalf("onntrack-archive sync exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "Archived 0 positions\n") {
+		t.Errorf("stderr = %q, want no archived positions", stderr)
+	}
+
+	from := now.Add(-3 * time.Hour).Format(onntrackclient.TimeLayout)
+	code, stdout, stderr := runArchive(configFile, dir, "query", "-device", "1", "-from", from)
+	if code != 0 {
+		t.Fatalf("onntrack-archive query exited with %d: %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("query printed %d positions, want 1:\n%s", len(lines), stdout)
+	}
+	var p onntrackclient.Position
+	if err := json.Unmarshal([]byte(lines[0]), &p); err != nil {
+		t.Fatalf("query printed invalid JSON %q: %v", lines[0], err)
+	}
+	if want := now.Add(-2 * time.Hour); !p.Time.Equal(want) {
+		t.Errorf("Time = %v, want %v", p.Time, want)
+	}
+
+	code, stdout, stderr = runArchive(configFile, dir, "query", "-near", "52.3731,4.8926", "-radius", "200", "-devices")
+	if code != 0 {
+		t.Fatalf("onntrack-archive query exited with %d: %s", code, stderr)
+	}
+	if stdout != "1\n" {
+		t.Errorf("query -devices = %q, want %q", stdout, "1\n")
+	}
+}
+
+func TestRun_QueryUsage(t *testing.T) {
+	configFile := writeConfig(t, newTestServer(t, time.Now()))
+
+	code, _, stderr := runArchive(configFile, t.TempDir(), "query")
+	if code != 2 {
+		t.Errorf("onntrack-archive query exited with %d, want 2", code)
+	}
+	if !strings.Contains(stderr, "one of -device, -bbox and -near is required") {
+		t.Errorf("stderr = %q, want the usage error", stderr)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// encoder writes tracks in one of the export formats. Tracks are written one
+// after the other: startTrack, any number of point calls, then endTrack.
+// close finishes the document.
+type encoder interface {
+	startTrack(name string) error
+	point(p *onntrackclient.Position) error
+	endTrack() error
+	close() error
+}
+
+// extensions maps each format to its file extension.
+var extensions = map[string]string{
+	"gpx":     ".gpx",
+	"geojson": ".geojson",
+	"kml":     ".kml",
+	"csv":     ".csv",
+}
+
+func newEncoder(format string, w io.Writer) (encoder, error) {
+	bw := bufio.NewWriter(w)
+
+	switch format {
+	case "gpx":
+		return newGPXEncoder(bw), nil
+	case "geojson":
+		return newGeoJSONEncoder(bw), nil
+	case "kml":
+		return newKMLEncoder(bw), nil
+	case "csv":
+		return newCSVEncoder(bw), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// formatTime returns t in RFC 3339, or "" if the platform sent no time.
+func formatTime(t onntrackclient.Timestamp) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// gpxEncoder writes GPX 1.1 with one trk per device.
+type gpxEncoder struct {
+	w *bufio.Writer
+}
+
+func newGPXEncoder(w *bufio.Writer) *gpxEncoder {
+	w.WriteString(xml.Header)
+	w.WriteString(`<gpx version="1.1" creator="onntrack-export" xmlns="http://www.topografix.com/GPX/1/1">` + "\n")
+	return &gpxEncoder{w: w}
+}
+
+func (e *gpxEncoder) startTrack(name string) error {
+	_, err := fmt.Fprintf(e.w, "  <trk>\n    <name>%s</name>\n    <trkseg>\n", escapeXML(name))
+	return err
+}
+
+func (e *gpxEncoder) point(p *onntrackclient.Position) error {
+	var timeElem string
+	if t := formatTime(p.Time); t != "" {
+		timeElem = "<time>" + t + "</time>"
+	}
+	_, err := fmt.Fprintf(e.w, "      <trkpt lat=\"%s\" lon=\"%s\"><ele>%s</ele>%s</trkpt>\n",
+		formatFloat(p.Lat), formatFloat(p.Lng), formatFloat(p.Altitude), timeElem)
+	return err
+}
+
+func (e *gpxEncoder) endTrack() error {
+	_, err := e.w.WriteString("    </trkseg>\n  </trk>\n")
+	return err
+}
+
+func (e *gpxEncoder) close() error {
+	e.w.WriteString("</gpx>\n")
+	return e.w.Flush()
+}
+
+// geoJSONEncoder writes a FeatureCollection with one LineString feature per
+// device. Point times go in the coordTimes property, as other GPX to
+// GeoJSON converters do, with null for points without a time.
+type geoJSONEncoder struct {
+	w        *bufio.Writer
+	features int
+	name     string
+	coords   [][3]float64
+	times    []any
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+}
+
+type geoJSONGeometry struct {
+	Type        string       `json:"type"`
+	Coordinates [][3]float64 `json:"coordinates"`
+}
+
+func newGeoJSONEncoder(w *bufio.Writer) *geoJSONEncoder {
+	w.WriteString(`{"type":"FeatureCollection","features":[`)
+	return &geoJSONEncoder{w: w}
+}
+
+func (e *geoJSONEncoder) startTrack(name string) error {
+	e.name = name
+	e.coords = e.coords[:0]
+	e.times = e.times[:0]
+	return nil
+}
+
+func (e *geoJSONEncoder) point(p *onntrackclient.Position) error {
+	e.coords = append(e.coords, [3]float64{p.Lng, p.Lat, p.Altitude})
+	var t any
+	if s := formatTime(p.Time); s != "" {
+		t = s
+	}
+	e.times = append(e.times, t)
+	return nil
+}
+
+func (e *geoJSONEncoder) endTrack() error {
+	data, err := json.Marshal(geoJSONFeature{
+		Type: "Feature",
+		Properties: map[string]interface{}{
+			"name":       e.name,
+			"coordTimes": e.times,
+		},
+		Geometry: geoJSONGeometry{Type: "LineString", Coordinates: e.coords},
+	})
+	if err != nil {
+		return err
+	}
+
+	if e.features > 0 {
+		e.w.WriteString(",")
+	}
+	e.features++
+	e.w.WriteString("\n")
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *geoJSONEncoder) close() error {
+	e.w.WriteString("\n]}\n")
+	return e.w.Flush()
+}
+
+// kmlEncoder writes KML 2.2 with one gx:Track placemark per device, which
+// keeps the time of every point.
+type kmlEncoder struct {
+	w      *bufio.Writer
+	whens  []string
+	coords []string
+}
+
+func newKMLEncoder(w *bufio.Writer) *kmlEncoder {
+	w.WriteString(xml.Header)
+	w.WriteString(`<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">` + "\n<Document>\n")
+	return &kmlEncoder{w: w}
+}
+
+func (e *kmlEncoder) startTrack(name string) error {
+	e.whens = e.whens[:0]
+	e.coords = e.coords[:0]
+	_, err := fmt.Fprintf(e.w, "  <Placemark>\n    <name>%s</name>\n    <gx:Track>\n", escapeXML(name))
+	return err
+}
+
+func (e *kmlEncoder) point(p *onntrackclient.Position) error {
+	e.whens = append(e.whens, formatTime(p.Time))
+	e.coords = append(e.coords, formatFloat(p.Lng)+" "+formatFloat(p.Lat)+" "+formatFloat(p.Altitude))
+	return nil
+}
+
+func (e *kmlEncoder) endTrack() error {
+	// Points without a time get an empty when, since gx:Track pairs every
+	// when with a coord
+	for _, when := range e.whens {
+		if when == "" {
+			e.w.WriteString("      <when/>\n")
+			continue
+		}
+		fmt.Fprintf(e.w, "      <when>%s</when>\n", when)
+	}
+	for _, coord := range e.coords {
+		fmt.Fprintf(e.w, "      <gx:coord>%s</gx:coord>\n", coord)
+	}
+	_, err := e.w.WriteString("    </gx:Track>\n  </Placemark>\n")
+	return err
+}
+
+func (e *kmlEncoder) close() error {
+	e.w.WriteString("</Document>\n</kml>\n")
+	return e.w.Flush()
+}
+
+// csvEncoder writes one row per position.
+type csvEncoder struct {
+	w    *bufio.Writer
+	cw   *csv.Writer
+	name string
+}
+
+func newCSVEncoder(w *bufio.Writer) *csvEncoder {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"device", "time", "lat", "lng", "speed", "course", "altitude"})
+	return &csvEncoder{w: w, cw: cw}
+}
+
+func (e *csvEncoder) startTrack(name string) error {
+	e.name = name
+	return nil
+}
+
+func (e *csvEncoder) point(p *onntrackclient.Position) error {
+	return e.cw.Write([]string{
+		e.name,
+		formatTime(p.Time),
+		formatFloat(p.Lat),
+		formatFloat(p.Lng),
+		formatFloat(p.Speed),
+		formatFloat(p.Course),
+		formatFloat(p.Altitude),
+	})
+}
+
+func (e *csvEncoder) endTrack() error {
+	return nil
+}
+
+func (e *csvEncoder) close() error {
+	e.cw.Flush()
+	if err := e.cw.Error(); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
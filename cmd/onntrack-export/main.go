@@ -0,0 +1,249 @@
+// Command onntrack-export exports the route history of one or more devices
+// as GPX, GeoJSON, KML or CSV.
+//
+// Usage:
+//
+//	onntrack-export -device ID [-device ID ...] -from TIME [-to TIME] [-format gpx|geojson|kml|csv] [-o FILE] [-split]
+//
+// Times are given as 2006-01-02, 2006-01-02 15:04, 2006-01-02 15:04:05 or
+// RFC 3339, in local time unless a zone is given. -to defaults to now.
+//
+// All devices are written to a single file, one track per device. With
+// -split every device gets its own file; -o is then a file name pattern in
+// which {device} is replaced by the device ID. Positions are exported in
+// WGS-84.
+//
+// The platform connection is configured through the profile selected with
+// -profile or ONNTRACK_PROFILE, see onntrackclient.Config. Run onntrack
+// login first to cache a session token.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+// listFlag collects the values of a flag that may be repeated. Values may
+// also be comma separated.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+	return nil
+}
+
+// exporter holds the settings of one export run.
+type exporter struct {
+	client   *onntrackclient.Client
+	stderr   io.Writer
+	format   string
+	from, to time.Time
+	pageSize int
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var devices listFlag
+	fs.Var(&devices, "device", "device ID to export; may be repeated or comma separated")
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	fromFlag := fs.String("from", "", "start of the time range")
+	toFlag := fs.String("to", "", "end of the time range (default now)")
+	format := fs.String("format", "gpx", "output format: gpx, geojson, kml or csv")
+	output := fs.String("o", "-", "output file, - for stdout; with -split a pattern containing {device}")
+	split := fs.Bool("split", false, "write one file per device")
+	pageSize := fs.Int("page-size", 500, "number of positions to request per page")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	usageErr := func(msg string) int {
+		fmt.Fprintf(stderr, "onntrack-export: %s\n", msg)
+		return 2
+	}
+
+	if len(devices) == 0 {
+		return usageErr("at least one -device is required")
+	}
+	if _, ok := extensions[*format]; !ok {
+		return usageErr(fmt.Sprintf("unknown format %q", *format))
+	}
+	if *fromFlag == "" {
+		return usageErr("-from is required")
+	}
+	from, err := parseTime(*fromFlag)
+	if err != nil {
+		return usageErr(err.Error())
+	}
+	to := time.Now()
+	if *toFlag != "" {
+		if to, err = parseTime(*toFlag); err != nil {
+			return usageErr(err.Error())
+		}
+	}
+	if !from.Before(to) {
+		return usageErr("-from must be before -to")
+	}
+
+	pattern := *output
+	if *split {
+		if pattern == "-" {
+			pattern = "{device}" + extensions[*format]
+		}
+		if !strings.Contains(pattern, "{device}") {
+			return usageErr("with -split, -o must contain {device}")
+		}
+	}
+
+	_, options, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		return usageErr(err.Error())
+	}
+	options = append(options, onntrackclient.WithPositionDatum(geo.WGS84))
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		return usageErr(err.Error())
+	}
+
+	e := &exporter{
+		client:   client,
+		stderr:   stderr,
+		format:   *format,
+		from:     from,
+		to:       to,
+		pageSize: *pageSize,
+	}
+
+	if *split {
+		for _, device := range devices {
+			path := strings.ReplaceAll(pattern, "{device}", safeFileName(device))
+			if err := e.exportFile(ctx, path, nil, []string{device}); err != nil {
+				fmt.Fprintf(stderr, "onntrack-export: %v\n", err)
+				return 1
+			}
+		}
+		return 0
+	}
+
+	if err := e.exportFile(ctx, pattern, stdout, devices); err != nil {
+		fmt.Fprintf(stderr, "onntrack-export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// exportFile writes the tracks of devices to path, or to stdout if path is -.
+func (e *exporter) exportFile(ctx context.Context, path string, stdout io.Writer, devices []string) (err error) {
+	w := stdout
+	if path != "-" {
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+
+	enc, err := newEncoder(e.format, w)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if err := e.exportDevice(ctx, enc, device); err != nil {
+			return fmt.Errorf("device %s: %w", device, err)
+		}
+	}
+
+	return enc.close()
+}
+
+// exportDevice writes the track of one device, reporting progress on stderr.
+func (e *exporter) exportDevice(ctx context.Context, enc encoder, device string) error {
+	if err := enc.startTrack(device); err != nil {
+		return err
+	}
+
+	count := 0
+	opts := &onntrackclient.HistoryOptions{From: e.from, To: e.to, PerPage: e.pageSize}
+	err := e.client.Positions.WalkHistory(ctx, device, opts, func(page []*onntrackclient.Position) error {
+		for _, p := range page {
+			if err := enc.point(p); err != nil {
+				return err
+			}
+		}
+		count += len(page)
+		fmt.Fprintf(e.stderr, "\r%s: %d positions", device, count)
+		return nil
+	})
+	fmt.Fprintf(e.stderr, "\r%s: %d positions\n", device, count)
+	if err != nil {
+		return err
+	}
+
+	return enc.endTrack()
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// safeFileName replaces characters that are not allowed in file names.
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
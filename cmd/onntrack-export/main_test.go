@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+// newTestServer starts a fake platform with three positions for each of
+// van-1 and van-2.
+func newTestServer(t *testing.T) *onntracktest.Server {
+	srv := onntracktest.NewServer()
+	t.Cleanup(srv.Close)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, device := range []string{"van-1", "van-2"} {
+		srv.AddDevice(&onntrackclient.Device{ID: device})
+		for i, coord := range [][2]float64{{52.1, 4.1}, {52.2, 4.2}, {52.3, 4.3}} {
+			srv.AddPosition(&onntrackclient.Position{DeviceID: device, Lat: coord[0], Lng: coord[1],
+				Time: onntrackclient.Timestamp{Time: start.Add(time.Duration(i) * time.Minute)}})
+		}
+	}
+	return srv
+}
+
+// writeConfig writes a profile for srv with a cached token of the default
+// account and returns its path.
+func writeConfig(t *testing.T, srv *onntracktest.Server) string {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte(srv.IssueToken(onntracktest.DefaultAccount)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	configFile := filepath.Join(dir, "config")
+	config := "[default]\nbase_url = " + srv.URL + "\ntoken_cache = " + tokenFile + "\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	return configFile
+}
+
+func runExport(t *testing.T, srv *onntracktest.Server, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", writeConfig(t, srv), "-from", "2024-05-01", "-to", "2024-05-02", "-page-size", "2"}, args...)
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_GPX(t *testing.T) {
+	srv := newTestServer(t)
+
+	code, stdout, stderr := runExport(t, srv, "-device", "van-1,van-2")
+	if code != 0 {
+		t.Fatalf("onntrack-export exited with %d: %s", code, stderr)
+	}
+
+	if got := strings.Count(stdout, "<trk>"); got != 2 {
+		t.Errorf("GPX has %d tracks, want 2", got)
+	}
+	if got := strings.Count(stdout, "<trkpt "); got != 6 {
+		t.Errorf("GPX has %d points, want 6", got)
+	}
+	if !strings.Contains(stdout, `<trkpt lat="52.3" lon="4.3"><ele>0</ele><time>2024-05-01T10:02:00Z</time></trkpt>`) {
+		t.Errorf("GPX does not contain the last point:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "van-2: 3 positions\n") {
+		t.Errorf("progress = %q, want final count for van-2", stderr)
+	}
+
+	// Each device takes two pages of history from the start of the range
+	srv.AssertCalled(t, http.MethodGet, "positions/history", 4)
+	for _, r := range srv.Requests() {
+		if got := r.Query.Get("startTime"); r.Path == "positions/history" && got != "2024-05-01 00:00:00" {
+			t.Errorf("startTime = %q, want %q", got, "2024-05-01 00:00:00")
+		}
+	}
+}
+
+func TestRun_GeoJSON(t *testing.T) {
+	srv := newTestServer(t)
+
+	code, stdout, stderr := runExport(t, srv, "-device", "van-1", "-device", "van-2", "-format", "geojson")
+	if code != 0 {
+		t.Fatalf("onntrack-export exited with %d: %s", code, stderr)
+	}
+
+	var collection struct {
+		Features []struct {
+			Properties struct {
+				Name       string   `json:"name"`
+				CoordTimes []string `json:"coordTimes"`
+			} `json:"properties"`
+			Geometry struct {
+				Coordinates [][3]float64 `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &collection); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, stdout)
+	}
+
+	if len(collection.Features) != 2 {
+		t.Fatalf("GeoJSON has %d features, want 2", len(collection.Features))
+	}
+	f := collection.Features[1]
+	if f.Properties.Name != "van-2" || len(f.Geometry.Coordinates) != 3 || len(f.Properties.CoordTimes) != 3 {
+		t.Errorf("GeoJSON feature = %+v, want van-2 with 3 points", f)
+	}
+	if f.Geometry.Coordinates[0] != [3]float64{4.1, 52.1, 0} {
+		t.Errorf("GeoJSON first coordinate = %v, want lng, lat, alt", f.Geometry.Coordinates[0])
+	}
+}
+
+func TestRun_Split(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+
+	code, _, stderr := runExport(t, srv, "-device", "van-1,van-2", "-format", "csv", "-split", "-o", filepath.Join(dir, "{device}.csv"))
+	if code != 0 {
+		t.Fatalf("onntrack-export exited with %d: %s", code, stderr)
+	}
+
+	for _, device := range []string{"van-1", "van-2"} {
+		data, err := os.ReadFile(filepath.Join(dir, device+".csv"))
+		if err != nil {
+			t.Fatalf("split file for %s missing: %v", device, err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 4 {
+			t.Errorf("%s.csv has %d lines, want header and 3 rows", device, len(lines))
+		}
+		if !strings.HasPrefix(lines[1], device+",2024-05-01T10:00:00Z,52.1,4.1,") {
+			t.Errorf("%s.csv first row = %q", device, lines[1])
+		}
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := [][]string{
+		{},
+		{"-device", "van-1", "-format", "shp"},
+		{"-device", "van-1", "-split", "-o", "out.gpx"},
+	}
+
+	for _, args := range tests {
+		if code, _, _ := runExport(t, srv, args...); code != 2 {
+			t.Errorf("onntrack-export %v exited with %d, want 2", args, code)
+		}
+	}
+}
+
+func TestEncoders_NoTime(t *testing.T) {
+	// Positions without a time leave it out instead of writing year 1
+	for format := range extensions {
+		var buf bytes.Buffer
+		enc, err := newEncoder(format, &buf)
+		if err != nil {
+			t.Fatalf("newEncoder(%q) returned unexpected error: %v", format, err)
+		}
+		enc.startTrack("van-1")
+		enc.point(&onntrackclient.Position{Lat: 52.1, Lng: 4.1})
+		enc.endTrack()
+		if err := enc.close(); err != nil {
+			t.Fatalf("%s: close returned unexpected error: %v", format, err)
+		}
+
+		if out := buf.String(); strings.Contains(out, "0001-01-01") || !strings.Contains(out, "52.1") {
+			t.Errorf("%s output = %s, want the point without a time", format, out)
+		}
+	}
+}
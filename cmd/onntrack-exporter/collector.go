@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// collector scrapes the platform and serves the result as Prometheus
+// metrics. Scrapes run in the background; the /metrics handler only reads
+// the last result, so Prometheus never waits for the platform.
+type collector struct {
+	client *onntrackclient.Client
+	api    *apiMetrics
+	group  string
+
+	mu             sync.Mutex
+	devices        []*onntrackclient.Device
+	positions      map[string]*onntrackclient.Position
+	up             bool
+	scrapeDuration time.Duration
+	scrapeErrors   uint64
+
+	// alarms counts alarms by device ID and type since the exporter started.
+	alarms      map[[2]string]uint64
+	alarmPoller *onntrackclient.AlarmPoller
+}
+
+func newCollector(client *onntrackclient.Client, api *apiMetrics, group string, start time.Time) *collector {
+	return &collector{
+		client:      client,
+		api:         api,
+		group:       group,
+		positions:   make(map[string]*onntrackclient.Position),
+		alarms:      make(map[[2]string]uint64),
+		alarmPoller: &onntrackclient.AlarmPoller{Client: client, Since: start},
+	}
+}
+
+// scrape fetches the devices, their latest positions and the alarms raised
+// since the previous scrape. On failure the previous devices and positions
+// are kept and onntrack_up drops to 0.
+func (c *collector) scrape(ctx context.Context, now time.Time) error {
+	start := time.Now()
+	err := c.fetch(ctx, now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.up = err == nil
+	c.scrapeDuration = time.Since(start)
+	if err != nil {
+		c.scrapeErrors++
+	}
+	return err
+}
+
+func (c *collector) fetch(ctx context.Context, now time.Time) error {
+	devices, _, err := c.client.Devices.ListAll(ctx, &onntrackclient.DeviceListOptions{Group: c.group})
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+
+	positions := make(map[string]*onntrackclient.Position)
+	if len(ids) > 0 {
+		latest, _, err := c.client.Positions.Latest(ctx, ids...)
+		if err != nil {
+			return err
+		}
+		for _, p := range latest {
+			positions[p.DeviceID] = p
+		}
+	}
+
+	c.mu.Lock()
+	c.devices, c.positions = devices, positions
+	c.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	return c.alarmPoller.Poll(ctx, now, ids, func(a *onntrackclient.Alarm) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.alarms[[2]string{a.DeviceID, a.Type}]++
+		return nil
+	})
+}
+
+// ServeHTTP writes the metrics.
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e := newExposition(w)
+	c.write(e, time.Now())
+	c.api.write(e)
+	e.flush()
+}
+
+// write writes the fleet metric families; ages are relative to now.
+func (c *collector) write(e *exposition, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.family("onntrack_up", "gauge", "Whether the last scrape of the Onntrack API succeeded.")
+	up := 0.0
+	if c.up {
+		up = 1
+	}
+	e.sample("onntrack_up", nil, up)
+
+	e.family("onntrack_scrape_duration_seconds", "gauge", "Duration of the last scrape of the Onntrack API.")
+	e.sample("onntrack_scrape_duration_seconds", nil, c.scrapeDuration.Seconds())
+
+	e.family("onntrack_scrape_errors_total", "counter", "Scrapes of the Onntrack API that failed.")
+	e.sample("onntrack_scrape_errors_total", nil, float64(c.scrapeErrors))
+
+	statuses := map[string]int{"online": 0, "offline": 0}
+	for _, d := range c.devices {
+		status := d.Status
+		if status == "" {
+			status = "unknown"
+		}
+		statuses[status]++
+	}
+	e.family("onntrack_devices", "gauge", "Number of devices by status.")
+	for _, status := range sortedKeys(statuses) {
+		e.sample("onntrack_devices", []label{{"status", status}}, float64(statuses[status]))
+	}
+
+	devices := append([]*onntrackclient.Device(nil), c.devices...)
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+
+	e.family("onntrack_device_last_seen_seconds", "gauge", "Seconds since the device last reported a position.")
+	for _, d := range devices {
+		if p := c.positions[d.ID]; p != nil && !p.Time.IsZero() {
+			e.sample("onntrack_device_last_seen_seconds", deviceLabels(d), now.Sub(p.Time.Time).Seconds())
+		}
+	}
+
+	e.family("onntrack_device_speed_kmh", "gauge", "Speed in the last reported position, in km/h.")
+	for _, d := range devices {
+		if p := c.positions[d.ID]; p != nil {
+			e.sample("onntrack_device_speed_kmh", deviceLabels(d), p.Speed)
+		}
+	}
+
+	e.family("onntrack_device_battery_percent", "gauge", "Battery charge in the last reported position.")
+	for _, d := range devices {
+		if p := c.positions[d.ID]; p != nil && p.Battery != nil {
+			e.sample("onntrack_device_battery_percent", deviceLabels(d), float64(*p.Battery))
+		}
+	}
+
+	e.family("onntrack_alarms_total", "counter", "Alarms raised since the exporter started, by device and alarm type.")
+	for _, k := range sortedPairs(c.alarms) {
+		e.sample("onntrack_alarms_total", []label{{"device", k[0]}, {"type", k[1]}}, float64(c.alarms[k]))
+	}
+}
+
+func deviceLabels(d *onntrackclient.Device) []label {
+	return []label{{"device", d.ID}, {"name", d.Name}}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+func TestCollector(t *testing.T) {
+	alarms := `[{"id": "alarm-1", "deviceId": "1", "alarmType": "sos", "alarmTime": "2024-05-01 11:55:00"}]`
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices":
+			w.Write([]byte(`{"ok": true, "data": [
+				{"id": "1", "name": "Van A", "status": "online"},
+				{"id": "2", "name": "Van B", "status": "offline"},
+				{"id": "3", "name": "Van C", "status": "online"},
+				{"id": "4", "name": "Van D", "status": "offline"}
+			]}`))
+		case "/positions/latest":
+			w.Write([]byte(`{"ok": true, "data": [
+				{"deviceId": "1", "speed": 52.5, "battery": 80, "gpsTime": "2024-05-01 11:58:00"},
+				{"deviceId": "2", "speed": 0, "gpsTime": "2024-04-30 12:00:00"},
+				{"deviceId": "4", "battery": 0, "gpsTime": "2024-05-01 11:00:00"}
+			]}`))
+		case "/alarms":
+			w.Write([]byte(`{"ok": true, "data": ` + alarms + `}`))
+		default:
+			t.Errorf("Unexpected request to '%s'", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	api := newAPIMetrics()
+	client, _ := onntrackclient.NewClient(
+		onntrackclient.WithBaseURL(server.URL),
+		onntrackclient.WithMetrics(api),
+	)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	col := newCollector(client, api, "", now.Add(-time.Hour))
+
+	if err := col.scrape(context.Background(), now); err != nil {
+		t.Fatalf("scrape returned unexpected error: %v", err)
+	}
+
+	// The same alarm is returned again by the next scrape, with a new one
+	alarms = `[
+		{"id": "alarm-2", "deviceId": "1", "alarmType": "sos", "alarmTime": "2024-05-01 12:00:30"},
+		{"id": "alarm-1", "deviceId": "1", "alarmType": "sos", "alarmTime": "2024-05-01 11:55:00"}
+	]`
+	if err := col.scrape(context.Background(), now.Add(time.Minute)); err != nil {
+		t.Fatalf("scrape returned unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := newExposition(&buf)
+	col.write(e, now)
+	e.flush()
+	out := buf.String()
+
+	for _, want := range []string{
+		`onntrack_up 1`,
+		`onntrack_devices{status="offline"} 2`,
+		`onntrack_devices{status="online"} 2`,
+		`onntrack_device_last_seen_seconds{device="1",name="Van A"} 120`,
+		`onntrack_device_last_seen_seconds{device="2",name="Van B"} 86400`,
+		`onntrack_device_speed_kmh{device="1",name="Van A"} 52.5`,
+		`onntrack_device_battery_percent{device="1",name="Van A"} 80`,
+		`onntrack_device_battery_percent{device="4",name="Van D"} 0`,
+		`onntrack_alarms_total{device="1",type="sos"} 2`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, out)
+		}
+	}
+
+	// Devices without a position or battery reading have no such series
+	if strings.Contains(out, `device="3"`) {
+		t.Errorf("metrics contain series for device 3 without a position:\n%s", out)
+	}
+	if strings.Contains(out, `onntrack_device_battery_percent{device="2"`) {
+		t.Errorf("metrics contain a battery reading for device 2:\n%s", out)
+	}
+}
+
+func TestCollector_ScrapeFailure(t *testing.T) {
+	// Create a test server that rejects the session
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	api := newAPIMetrics()
+	client, _ := onntrackclient.NewClient(
+		onntrackclient.WithBaseURL(server.URL),
+		onntrackclient.WithMetrics(api),
+	)
+	col := newCollector(client, api, "", time.Now())
+
+	err := col.scrape(context.Background(), time.Now())
+	if !onntrackclient.IsAuthError(err) {
+		t.Fatalf("scrape error = %v, want an authentication error", err)
+	}
+
+	rec := httptest.NewRecorder()
+	col.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+
+	for _, want := range []string{
+		"onntrack_up 0",
+		"onntrack_scrape_errors_total 1",
+		`onntrack_api_errors_total{endpoint="devices",code="401"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, out)
+		}
+	}
+}
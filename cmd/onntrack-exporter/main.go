@@ -0,0 +1,148 @@
+// Command onntrack-exporter serves fleet metrics from the Onntrack platform
+// to Prometheus.
+//
+// Usage:
+//
+//	onntrack-exporter [-listen :9798] [-interval 1m] [-group G]
+//
+// The exporter scrapes the devices, their latest positions and new alarms
+// every interval and serves the result at /metrics in the Prometheus text
+// format:
+//
+//	onntrack_up                            whether the last scrape succeeded
+//	onntrack_devices{status}               devices by status, e.g. online and offline
+//	onntrack_device_last_seen_seconds      age of each device's last position
+//	onntrack_device_speed_kmh              speed in each device's last position
+//	onntrack_device_battery_percent        battery charge, for devices that report it
+//	onntrack_alarms_total{device,type}     alarms raised since the exporter started
+//	onntrack_api_request_duration_seconds  latency histogram of API requests by endpoint
+//	onntrack_api_errors_total              failed API requests by endpoint and status
+//
+// The platform connection is configured through the profile selected with
+// -profile or ONNTRACK_PROFILE, see onntrackclient.Config. When
+// ONNTRACK_PASSWORD is set the exporter logs in at start and again whenever
+// the session expires; otherwise the token cached by onntrack login is used.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-exporter", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	listen := fs.String("listen", ":9798", "address to serve metrics on")
+	interval := fs.Duration("interval", time.Minute, "time between scrapes of the platform")
+	group := fs.String("group", "", "only export devices in this group")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *interval < time.Second {
+		fmt.Fprintln(stderr, "onntrack-exporter: -interval must be at least 1s")
+		return 2
+	}
+
+	profile, options, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-exporter: %v\n", err)
+		return 2
+	}
+
+	api := newAPIMetrics()
+	options = append(options,
+		onntrackclient.WithHTTPClient(&http.Client{Timeout: 30 * time.Second}),
+		onntrackclient.WithMetrics(api),
+	)
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-exporter: %v\n", err)
+		return 2
+	}
+
+	login := profile.Login(client)
+	if login != nil {
+		if err := login(ctx); err != nil {
+			fmt.Fprintf(stderr, "onntrack-exporter: %v\n", err)
+			return 3
+		}
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-exporter: %v\n", err)
+		return 1
+	}
+
+	col := newCollector(client, api, *group, time.Now())
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", col)
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Onntrack exporter - metrics are served at /metrics")
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go server.Serve(ln)
+	fmt.Fprintf(stderr, "Serving metrics on %s/metrics\n", ln.Addr())
+
+	scrapeLoop(ctx, col, login, *interval, stderr)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+
+	return 0
+}
+
+// scrapeLoop scrapes the platform every interval until ctx is done. When a
+// scrape is rejected because the session expired and login is set, it logs
+// in again and retries the scrape once.
+func scrapeLoop(ctx context.Context, col *collector, login func(context.Context) error, interval time.Duration, stderr io.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := col.scrape(ctx, time.Now())
+		if err != nil && login != nil && onntrackclient.IsAuthError(err) {
+			if err = login(ctx); err == nil {
+				err = col.scrape(ctx, time.Now())
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(stderr, "onntrack-exporter: scrape failed: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
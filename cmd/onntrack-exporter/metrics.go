@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// label is a Prometheus label name and value.
+type label struct {
+	name, value string
+}
+
+// exposition writes metrics in the Prometheus text exposition format,
+// version 0.0.4. The first write error is kept and returned by flush.
+type exposition struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newExposition(w io.Writer) *exposition {
+	return &exposition{w: bufio.NewWriter(w)}
+}
+
+// family starts a metric family. typ is counter, gauge or histogram.
+func (e *exposition) family(name, typ, help string) {
+	e.printf("# HELP %s %s\n", name, escapeHelp(help))
+	e.printf("# TYPE %s %s\n", name, typ)
+}
+
+// sample writes one sample of the current family.
+func (e *exposition) sample(name string, labels []label, value float64) {
+	e.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// histogram writes the buckets, sum and count of a histogram.
+func (e *exposition) histogram(name string, labels []label, h *histogram) {
+	bucketLabels := append(append([]label(nil), labels...), label{"le", ""})
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		bucketLabels[len(labels)].value = formatValue(upper)
+		e.sample(name+"_bucket", bucketLabels, float64(cumulative))
+	}
+	bucketLabels[len(labels)].value = "+Inf"
+	e.sample(name+"_bucket", bucketLabels, float64(h.count))
+	e.sample(name+"_sum", labels, h.sum)
+	e.sample(name+"_count", labels, float64(h.count))
+}
+
+func (e *exposition) printf(format string, args ...any) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.w, format, args...)
+	}
+}
+
+func (e *exposition) flush() error {
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(l.value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// latencyBuckets are the upper bounds, in seconds, of the API latency
+// histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations in buckets. It is not safe for concurrent
+// use; apiMetrics guards its histograms with a mutex.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// apiMetrics records the latency and errors of the requests sent to the
+// platform. It is an onntrackclient.Metrics, so requests are labelled with
+// the client's endpoint templates, such as devices/{id}.
+type apiMetrics struct {
+	mu      sync.Mutex
+	latency map[string]*histogram
+	errors  map[[2]string]uint64
+}
+
+func newAPIMetrics() *apiMetrics {
+	return &apiMetrics{
+		latency: make(map[string]*histogram),
+		errors:  make(map[[2]string]uint64),
+	}
+}
+
+// ObserveRequest implements onntrackclient.Metrics.
+func (m *apiMetrics) ObserveRequest(_ context.Context, info onntrackclient.RequestInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.latency[info.Endpoint]
+	if !ok {
+		h = newHistogram(latencyBuckets)
+		m.latency[info.Endpoint] = h
+	}
+	h.observe(info.Duration.Seconds())
+
+	switch {
+	case info.Status >= 400:
+		m.errors[[2]string{info.Endpoint, strconv.Itoa(info.Status)}]++
+	case info.Status == 0 && info.Err != nil:
+		m.errors[[2]string{info.Endpoint, errorCode(info.Err)}]++
+	}
+}
+
+// write writes the API metric families.
+func (m *apiMetrics) write(e *exposition) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.family("onntrack_api_request_duration_seconds", "histogram", "Latency of requests to the Onntrack API.")
+	for _, endpoint := range sortedKeys(m.latency) {
+		e.histogram("onntrack_api_request_duration_seconds", []label{{"endpoint", endpoint}}, m.latency[endpoint])
+	}
+
+	e.family("onntrack_api_errors_total", "counter", "Failed requests to the Onntrack API by HTTP status or network error.")
+	for _, k := range sortedPairs(m.errors) {
+		e.sample("onntrack_api_errors_total", []label{{"endpoint", k[0]}, {"code", k[1]}}, float64(m.errors[k]))
+	}
+}
+
+// errorCode classifies a transport error.
+func errorCode(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "network"
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedPairs returns the keys of a counter map keyed by two label values.
+func sortedPairs(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
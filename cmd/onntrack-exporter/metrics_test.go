@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+func TestExposition(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(3)
+
+	var buf bytes.Buffer
+	e := newExposition(&buf)
+	e.family("test_info", "gauge", "A test\nmetric.")
+	e.sample("test_info", []label{{"name", `Van "A"\1`}}, 1)
+	e.family("test_seconds", "histogram", "Test latency.")
+	e.histogram("test_seconds", []label{{"endpoint", "devices"}}, h)
+	if err := e.flush(); err != nil {
+		t.Fatalf("flush returned unexpected error: %v", err)
+	}
+
+	want := `# HELP test_info A test\nmetric.
+# TYPE test_info gauge
+test_info{name="Van \"A\"\\1"} 1
+# HELP test_seconds Test latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{endpoint="devices",le="0.1"} 1
+test_seconds_bucket{endpoint="devices",le="1"} 2
+test_seconds_bucket{endpoint="devices",le="+Inf"} 3
+test_seconds_sum{endpoint="devices"} 3.55
+test_seconds_count{endpoint="devices"} 3
+`
+	if buf.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestAPIMetrics(t *testing.T) {
+	// Create a test server under a base path that fails requests for one
+	// device
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v3/new/devices/404":
+			w.WriteHeader(http.StatusNotFound)
+		case "/v3/new/devices":
+			w.Write([]byte(`{"ok": true, "data": []}`))
+		default:
+			w.Write([]byte(`{"ok": true, "data": {"id": "1"}}`))
+		}
+	}))
+	defer server.Close()
+
+	api := newAPIMetrics()
+	client, _ := onntrackclient.NewClient(
+		onntrackclient.WithBaseURL(server.URL+"/v3/new/"),
+		onntrackclient.WithMetrics(api),
+	)
+	ctx := context.Background()
+
+	// IDs of any shape share the label of their endpoint
+	for _, id := range []string{"1", "van-a", "404"} {
+		client.Devices.Get(ctx, id)
+	}
+	if _, _, err := client.Devices.List(ctx, nil); err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := newExposition(&buf)
+	api.write(e)
+	e.flush()
+	out := buf.String()
+
+	for _, want := range []string{
+		`onntrack_api_request_duration_seconds_count{endpoint="devices/{id}"} 3`,
+		`onntrack_api_request_duration_seconds_count{endpoint="devices"} 1`,
+		`onntrack_api_errors_total{endpoint="devices/{id}",code="404"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "v3") || strings.Contains(out, "van-a") {
+		t.Errorf("metrics contain the base path or an ID:\n%s", out)
+	}
+}
@@ -0,0 +1,156 @@
+// Command onntrack-mqtt publishes the positions and alarms of Onntrack
+// devices to an MQTT broker.
+//
+// Usage:
+//
+//	onntrack-mqtt [-broker host:1883] [-tls] [-interval 30s] [-group G]
+//	              [-position-topic onntrack/{imei}/position] [-alarm-topic onntrack/{imei}/alarm]
+//	              [-homeassistant] [-discovery-prefix homeassistant]
+//
+// Every new position and alarm is published as JSON with QoS 1. In topics,
+// {imei} is replaced by the device IMEI, {device} by the device ID and
+// {type} by the alarm type. The broker credentials are read from
+// MQTT_USERNAME and MQTT_PASSWORD. When the broker connection is lost the
+// bridge reconnects and publishes what it missed.
+//
+// With -homeassistant the devices are announced to Home Assistant through
+// MQTT discovery, each as a device tracker with battery, speed, ACC and last
+// update sensors. Their state is published to onntrack/{imei}/state and the
+// availability of the bridge to onntrack/bridge/status.
+//
+// The platform connection is configured through the profile selected with
+// -profile or ONNTRACK_PROFILE, see onntrackclient.Config. When
+// ONNTRACK_PASSWORD is set the bridge logs in at start and again whenever
+// the session expires; otherwise the token cached by onntrack login is used.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/mqtt"
+	"github.com/MaikelH/onntrackclient/mqttbridge"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-mqtt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	broker := fs.String("broker", "localhost:1883", "MQTT broker address")
+	useTLS := fs.Bool("tls", false, "connect to the broker over TLS")
+	clientID := fs.String("client-id", "", "MQTT client ID (default random)")
+	positionTopic := fs.String("position-topic", mqttbridge.DefaultPositionTopic, "topic for positions")
+	alarmTopic := fs.String("alarm-topic", mqttbridge.DefaultAlarmTopic, "topic for alarms")
+	interval := fs.Duration("interval", mqttbridge.DefaultInterval, "time between polls of the platform")
+	group := fs.String("group", "", "only publish devices in this group")
+	homeAssistant := fs.Bool("homeassistant", false, "announce devices to Home Assistant through MQTT discovery")
+	discoveryPrefix := fs.String("discovery-prefix", mqttbridge.DefaultDiscoveryPrefix, "Home Assistant discovery prefix")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *interval < time.Second {
+		fmt.Fprintln(stderr, "onntrack-mqtt: -interval must be at least 1s")
+		return 2
+	}
+
+	logger := slog.New(slog.NewTextHandler(stderr, nil))
+
+	profile, options, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-mqtt: %v\n", err)
+		return 2
+	}
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-mqtt: %v\n", err)
+		return 2
+	}
+
+	login := profile.Login(client)
+	if login != nil {
+		if err := login(ctx); err != nil {
+			fmt.Fprintf(stderr, "onntrack-mqtt: %v\n", err)
+			return 3
+		}
+	}
+
+	mqttOptions := &mqtt.Options{
+		ClientID: *clientID,
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+		Logger:   logger,
+	}
+	var ha *mqttbridge.HomeAssistant
+	if *homeAssistant {
+		ha = &mqttbridge.HomeAssistant{DiscoveryPrefix: *discoveryPrefix}
+		mqttOptions.Will = &mqtt.Message{
+			Topic:   mqttbridge.DefaultAvailabilityTopic,
+			Payload: []byte(mqttbridge.PayloadOffline),
+			QoS:     1,
+			Retain:  true,
+		}
+	}
+	if *useTLS {
+		dialer := &tls.Dialer{}
+		mqttOptions.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+
+	mq, err := mqtt.Dial(ctx, *broker, mqttOptions)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-mqtt: connecting to %s: %v\n", *broker, err)
+		return 1
+	}
+	defer mq.Close()
+
+	bridge := &mqttbridge.Bridge{
+		Client:         client,
+		Publisher:      mq,
+		PositionTopic:  *positionTopic,
+		AlarmTopic:     *alarmTopic,
+		Group:          *group,
+		Interval:       *interval,
+		HomeAssistant:  ha,
+		Reauthenticate: login,
+		Logger:         logger,
+	}
+	if err := bridge.Run(ctx); err != nil {
+		fmt.Fprintf(stderr, "onntrack-mqtt: %v\n", err)
+		return 1
+	}
+
+	// The will is not published on a clean disconnect
+	if ha != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mq.Publish(shutdownCtx, mqttOptions.Will)
+	}
+
+	return 0
+}
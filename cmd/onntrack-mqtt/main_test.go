@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/mqtt/mqtttest"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+// newTestServer starts a fake platform with one device and its latest
+// position.
+func newTestServer(t *testing.T) *onntracktest.Server {
+	srv := onntracktest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddDevice(&onntrackclient.Device{ID: "1", IMEI: "490154203237518"})
+	srv.AddPosition(&onntrackclient.Position{DeviceID: "1", Lat: 52.1, Lng: 4.1,
+		Time: onntrackclient.Timestamp{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}})
+	return srv
+}
+
+// writeConfig writes a profile for srv with a cached token of the default
+// account and returns its path.
+func writeConfig(t *testing.T, srv *onntracktest.Server) string {
+	t.Setenv(onntrackclient.PasswordEnv, "")
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte(srv.IssueToken(onntracktest.DefaultAccount)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	configFile := filepath.Join(dir, "config")
+	config := "[default]\nbase_url = " + srv.URL + "\ntoken_cache = " + tokenFile + "\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	return configFile
+}
+
+func runMQTT(ctx context.Context, configFile string, args ...string) (int, string) {
+	var stderr bytes.Buffer
+	code := run(ctx, append([]string{"-config", configFile}, args...), &stderr)
+	return code, stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	configFile := writeConfig(t, newTestServer(t))
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	var stderr string
+	go func() {
+		var code int
+		code, stderr = runMQTT(ctx, configFile, "-broker", broker.Addr)
+		done <- code
+	}()
+
+	msgs := broker.WaitMessages(1, 5*time.Second)
+	cancel()
+	if code := <-done; code != 0 {
+		t.Fatalf("onntrack-mqtt exited with %d: %s", code, stderr)
+	}
+
+	if len(msgs) == 0 {
+		t.Fatal("no messages published")
+	}
+	if want := "onntrack/490154203237518/position"; msgs[0].Topic != want {
+		t.Errorf("Topic = %q, want %q", msgs[0].Topic, want)
+	}
+	if !strings.Contains(string(msgs[0].Payload), `"lat":52.1`) {
+		t.Errorf("Payload = %s, want the position", msgs[0].Payload)
+	}
+}
+
+func TestRun_BrokerRefused(t *testing.T) {
+	configFile := writeConfig(t, newTestServer(t))
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+	broker.RefuseConnects(5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	code, stderr := runMQTT(ctx, configFile, "-broker", broker.Addr)
+	if code != 1 {
+		t.Errorf("onntrack-mqtt exited with %d, want 1", code)
+	}
+	if !strings.Contains(stderr, "connecting to "+broker.Addr) {
+		t.Errorf("stderr = %q, want the connection error", stderr)
+	}
+}
+
+func TestRun_Interval(t *testing.T) {
+	configFile := writeConfig(t, newTestServer(t))
+
+	code, stderr := runMQTT(context.Background(), configFile, "-interval", "10ms")
+	if code != 2 {
+		t.Errorf("onntrack-mqtt exited with %d, want 2", code)
+	}
+	if !strings.Contains(stderr, "-interval must be at least 1s") {
+		t.Errorf("stderr = %q, want the interval error", stderr)
+	}
+}
@@ -0,0 +1,132 @@
+// Command onntrack-traccar forwards the positions of Onntrack devices to a
+// Traccar server using the OsmAnd protocol.
+//
+// Usage:
+//
+//	onntrack-traccar -server http://traccar:5055 [-cursor FILE] [-interval 30s] [-group G] [-once]
+//
+// Devices appear in Traccar under their IMEI, so register them there with
+// the IMEI as identifier. The time of the last forwarded position of every
+// device is kept in the cursor file, by default onntrack/traccar-PROFILE.json
+// in the user config directory. After downtime the missed positions are
+// forwarded from the history. Only a position forwarded just before a crash
+// can be forwarded twice.
+//
+// The platform connection is configured through the profile selected with
+// -profile or ONNTRACK_PROFILE, see onntrackclient.Config. When
+// ONNTRACK_PASSWORD is set the forwarder logs in at start and again whenever
+// the session expires; otherwise the token cached by onntrack login is used.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/traccar"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-traccar", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	server := fs.String("server", "", "Traccar OsmAnd address, e.g. http://traccar:5055")
+	cursorPath := fs.String("cursor", "", "file keeping the last forwarded position per device")
+	interval := fs.Duration("interval", traccar.DefaultInterval, "time between polls of the platform")
+	group := fs.String("group", "", "only forward devices in this group")
+	once := fs.Bool("once", false, "poll once and exit")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *server == "" {
+		fmt.Fprintln(stderr, "onntrack-traccar: -server is required")
+		return 2
+	}
+	if *interval < time.Second {
+		fmt.Fprintln(stderr, "onntrack-traccar: -interval must be at least 1s")
+		return 2
+	}
+
+	profile, options, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+		return 2
+	}
+
+	if *cursorPath == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+			return 2
+		}
+		*cursorPath = filepath.Join(dir, "onntrack", "traccar-"+profile.Name+".json")
+	}
+	if err := os.MkdirAll(filepath.Dir(*cursorPath), 0o700); err != nil {
+		fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+		return 1
+	}
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+		return 2
+	}
+
+	login := profile.Login(client)
+	if login != nil {
+		if err := login(ctx); err != nil {
+			fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+			return 3
+		}
+	}
+
+	fwd := &traccar.Forwarder{
+		Client:         client,
+		ServerURL:      *server,
+		HTTPClient:     &http.Client{Timeout: 30 * time.Second},
+		Cursor:         &traccar.FileCursor{Path: *cursorPath},
+		Group:          *group,
+		Interval:       *interval,
+		Reauthenticate: login,
+		Logger:         slog.New(slog.NewTextHandler(stderr, nil)),
+	}
+
+	if *once {
+		n, err := fwd.Poll(ctx)
+		fmt.Fprintf(stderr, "Forwarded %d positions\n", n)
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := fwd.Run(ctx); err != nil {
+		fmt.Fprintf(stderr, "onntrack-traccar: %v\n", err)
+		return 1
+	}
+	return 0
+}
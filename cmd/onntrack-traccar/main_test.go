@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+// newTestServer starts a fake platform with one device and one position.
+func newTestServer(t *testing.T) *onntracktest.Server {
+	srv := onntracktest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddDevice(&onntrackclient.Device{ID: "1", IMEI: "490154203237518"})
+	srv.AddPosition(&onntrackclient.Position{DeviceID: "1", Lat: 52.1, Lng: 4.1,
+		Time: onntrackclient.Timestamp{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}})
+	return srv
+}
+
+// newTraccarServer records the OsmAnd requests it receives.
+func newTraccarServer(t *testing.T) (*httptest.Server, func() []url.Values) {
+	var mu sync.Mutex
+	var received []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.URL.Query())
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]url.Values(nil), received...)
+	}
+}
+
+// writeConfig writes a profile for srv with a cached token of the default
+// account and returns its path.
+func writeConfig(t *testing.T, srv *onntracktest.Server) string {
+	t.Setenv(onntrackclient.PasswordEnv, "")
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte(srv.IssueToken(onntracktest.DefaultAccount)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	configFile := filepath.Join(dir, "config")
+	config := "[default]\nbase_url = " + srv.URL + "\ntoken_cache = " + tokenFile + "\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+	return configFile
+}
+
+func runTraccar(configFile string, args ...string) (int, string) {
+	var stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"-config", configFile}, args...), &stderr)
+	return code, stderr.String()
+}
+
+func TestRun_Once(t *testing.T) {
+	configFile := writeConfig(t, newTestServer(t))
+	traccarServer, received := newTraccarServer(t)
+	cursor := filepath.Join(t.TempDir(), "cursor.json")
+
+	code, stderr := runTraccar(configFile, "-server", traccarServer.URL, "-cursor", cursor, "-once")
+	if code != 0 {
+		t.Fatalf("onntrack-traccar exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "Forwarded 1 positions\n") {
+		t.Errorf("stderr = %q, want 1 forwarded position", stderr)
+	}
+
+	got := received()
+	if len(got) != 1 {
+		t.Fatalf("Traccar received %d positions, want 1", len(got))
+	}
+	if id := got[0].Get("id"); id != "490154203237518" {
+		t.Errorf("id = %q, want the IMEI", id)
+	}
+
+	// The cursor keeps the next run from forwarding the position again
+	code, stderr = runTraccar(configFile, "-server", traccarServer.URL, "-cursor", cursor, "-once")
+	if code != 0 {
+		t.Fatalf("onntrack-traccar exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "Forwarded 0 positions\n") {
+		t.Errorf("stderr = %q, want no forwarded positions", stderr)
+	}
+	if got := received(); len(got) != 1 {
+		t.Errorf("Traccar received %d positions, want 1", len(got))
+	}
+}
+
+func TestRun_NoServer(t *testing.T) {
+	configFile := writeConfig(t, newTestServer(t))
+
+	code, stderr := runTraccar(configFile, "-once")
+	if code != 2 {
+		t.Errorf("onntrack-traccar exited with %d, want 2", code)
+	}
+	if !strings.Contains(stderr, "-server is required") {
+		t.Errorf("stderr = %q, want the missing server error", stderr)
+	}
+}
@@ -0,0 +1,144 @@
+// Command onntrack-watch shows a live table of device statuses and
+// positions in the terminal.
+//
+// Usage:
+//
+//	onntrack-watch [-group G] [-interval 10s] [-once] [-no-color]
+//
+// The table is redrawn on every refresh and values that changed since the
+// previous refresh are highlighted. Only ANSI escape codes are used, so it
+// works over SSH in any common terminal. Colours are disabled with
+// -no-color or when NO_COLOR is set.
+//
+// The platform connection is configured through the profile selected with
+// -profile or ONNTRACK_PROFILE, see onntrackclient.Config. Run onntrack
+// login first to cache a session token.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack-watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	group := fs.String("group", "", "only show devices in this group")
+	interval := fs.Duration("interval", 10*time.Second, "time between refreshes")
+	once := fs.Bool("once", false, "print the table once and exit")
+	noColor := fs.Bool("no-color", os.Getenv("NO_COLOR") != "", "disable colours and screen clearing")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *interval < time.Second {
+		fmt.Fprintln(stderr, "onntrack-watch: -interval must be at least 1s")
+		return 2
+	}
+
+	_, options, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-watch: %v\n", err)
+		return 2
+	}
+	options = append(options, onntrackclient.WithPositionDatum(geo.WGS84))
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack-watch: %v\n", err)
+		return 2
+	}
+
+	v := &view{color: !*noColor}
+	title := "Onntrack devices"
+	if *group != "" {
+		title += " in " + *group
+	}
+
+	if *once {
+		rows, err := fetch(ctx, client, *group)
+		if err != nil {
+			fmt.Fprintf(stderr, "onntrack-watch: %v\n", err)
+			return 1
+		}
+		if err := v.render(stdout, rows, time.Now(), title); err != nil {
+			return 1
+		}
+		return 0
+	}
+
+	if v.color {
+		fmt.Fprint(stdout, hideCursor)
+		defer fmt.Fprint(stdout, showCursor)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	var rows []row
+	for {
+		// Keep showing the last table when a refresh fails
+		fetched, err := fetch(ctx, client, *group)
+		if err == nil {
+			rows = fetched
+		}
+
+		now := time.Now()
+		status := fmt.Sprintf("%s, refreshing every %s", title, *interval)
+		v.render(stdout, rows, now, status+" - "+now.Format("15:04:05"))
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(stdout, "\n%s\n", v.style(highlight, "refresh failed: "+err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch loads the devices and their latest positions.
+func fetch(ctx context.Context, client *onntrackclient.Client, group string) ([]row, error) {
+	devices, _, err := client.Devices.ListAll(ctx, &onntrackclient.DeviceListOptions{Group: group})
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+
+	positions, _, err := client.Positions.Latest(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildRows(devices, positions), nil
+}
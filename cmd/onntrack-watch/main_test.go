@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+func TestFetch_Pages(t *testing.T) {
+	// 101 devices in the group take two pages
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	for i := 1; i <= 101; i++ {
+		srv.AddDevice(&onntrackclient.Device{ID: strconv.Itoa(i), Name: "Van " + strconv.Itoa(i), Group: "Delivery"})
+	}
+	srv.AddDevice(&onntrackclient.Device{ID: "102", Name: "Car", Group: "Sales"})
+	srv.AddPosition(&onntrackclient.Position{DeviceID: "101", Lat: 52.1, Lng: 4.1})
+
+	rows, err := fetch(context.Background(), srv.Client(), "Delivery")
+	if err != nil {
+		t.Fatalf("fetch returned unexpected error: %v", err)
+	}
+	if len(rows) != 101 {
+		t.Fatalf("fetch returned %d rows, want 101", len(rows))
+	}
+	for _, r := range rows {
+		if r.ID == "101" && !r.HasFix {
+			t.Errorf("device 101 = %+v, want its position", r)
+		}
+	}
+	srv.AssertCalled(t, http.MethodGet, "devices", 2)
+}
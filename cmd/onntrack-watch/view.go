@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// ANSI escape sequences
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+	bold        = "\x1b[1m"
+	highlight   = "\x1b[1;33m"
+	reset       = "\x1b[0m"
+)
+
+// row is the state of one device as shown in the table.
+type row struct {
+	ID       string
+	Name     string
+	Status   string
+	Updated  time.Time
+	Speed    float64
+	Lat, Lng float64
+	HasFix   bool
+}
+
+// buildRows joins devices with their latest positions, sorted by name.
+func buildRows(devices []*onntrackclient.Device, positions []*onntrackclient.Position) []row {
+	latest := make(map[string]*onntrackclient.Position, len(positions))
+	for _, p := range positions {
+		latest[p.DeviceID] = p
+	}
+
+	rows := make([]row, 0, len(devices))
+	for _, d := range devices {
+		r := row{ID: d.ID, Name: d.Name, Status: d.Status}
+		if p, ok := latest[d.ID]; ok {
+			r.Updated = p.Time.Time
+			r.Speed = p.Speed
+			r.Lat, r.Lng = p.Lat, p.Lng
+			r.HasFix = true
+		}
+		rows = append(rows, r)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Name != rows[j].Name {
+			return rows[i].Name < rows[j].Name
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	return rows
+}
+
+// view renders the device table and remembers what it showed, so the next
+// render can highlight what changed.
+type view struct {
+	color    bool
+	previous map[string]row
+}
+
+// cell is one table cell; changed cells are highlighted.
+type cell struct {
+	text    string
+	changed bool
+}
+
+var header = []string{"NAME", "STATUS", "UPDATED", "SPEED", "POSITION"}
+
+// render writes the table for rows to w.
+func (v *view) render(w io.Writer, rows []row, now time.Time, title string) error {
+	table := make([][]cell, 0, len(rows))
+	for _, r := range rows {
+		prev, seen := v.previous[r.ID]
+		changed := func(same bool) bool {
+			return seen && !same
+		}
+
+		age, position, speed := "-", "-", "-"
+		if r.HasFix {
+			age = formatAge(now.Sub(r.Updated))
+			position = fmt.Sprintf("%.5f, %.5f", r.Lat, r.Lng)
+			speed = fmt.Sprintf("%.0f km/h", r.Speed)
+		}
+
+		table = append(table, []cell{
+			{text: r.Name},
+			{text: r.Status, changed: changed(prev.Status == r.Status)},
+			{text: age, changed: changed(prev.Updated.Equal(r.Updated))},
+			{text: speed, changed: changed(prev.Speed == r.Speed)},
+			{text: position, changed: changed(prev.Lat == r.Lat && prev.Lng == r.Lng)},
+		})
+	}
+
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, cells := range table {
+		for i, c := range cells {
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var b strings.Builder
+	if v.color {
+		b.WriteString(clearScreen)
+	}
+	b.WriteString(v.style(bold, title))
+	b.WriteString("\n\n")
+
+	headerCells := make([]cell, len(header))
+	for i, h := range header {
+		headerCells[i] = cell{text: h}
+	}
+	v.writeLine(&b, headerCells, widths, bold)
+	for _, cells := range table {
+		v.writeLine(&b, cells, widths, "")
+	}
+
+	// Remember this refresh for the next one
+	v.previous = make(map[string]row, len(rows))
+	for _, r := range rows {
+		v.previous[r.ID] = r
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (v *view) writeLine(b *strings.Builder, cells []cell, widths []int, style string) {
+	for i, c := range cells {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+
+		s := style
+		if c.changed {
+			s = highlight
+		}
+		b.WriteString(v.style(s, c.text))
+
+		// Pad on the visible width so escape codes do not skew the columns
+		if i < len(cells)-1 {
+			b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.text)))
+		}
+	}
+	b.WriteString("\n")
+}
+
+func (v *view) style(style, text string) string {
+	if !v.color || style == "" {
+		return text
+	}
+	return style + text + reset
+}
+
+// formatAge formats a duration as a short age such as 45s, 12m, 3h or 2d.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "0s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+func TestBuildRows(t *testing.T) {
+	devices := []*onntrackclient.Device{
+		{ID: "2", Name: "Van B", Status: "online"},
+		{ID: "1", Name: "Van A", Status: "offline"},
+	}
+	positions := []*onntrackclient.Position{
+		{DeviceID: "2", Lat: 52.1, Lng: 4.1, Speed: 40},
+	}
+
+	rows := buildRows(devices, positions)
+
+	if len(rows) != 2 || rows[0].Name != "Van A" || rows[1].Name != "Van B" {
+		t.Fatalf("buildRows = %+v, want Van A then Van B", rows)
+	}
+	if rows[0].HasFix {
+		t.Errorf("Van A HasFix = true, want false")
+	}
+	if !rows[1].HasFix || rows[1].Speed != 40 {
+		t.Errorf("Van B = %+v, want a fix at 40 km/h", rows[1])
+	}
+}
+
+func TestView_Render(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rows := []row{
+		{ID: "1", Name: "Van A", Status: "online", Updated: now.Add(-90 * time.Second), Speed: 50, Lat: 52.1, Lng: 4.1, HasFix: true},
+		{ID: "2", Name: "Van B", Status: "offline"},
+	}
+
+	// Without colours the table is plain text
+	plain := &view{}
+	var buf bytes.Buffer
+	plain.render(&buf, rows, now, "Onntrack devices")
+
+	want := "Onntrack devices\n\n" +
+		"NAME   STATUS   UPDATED  SPEED    POSITION\n" +
+		"Van A  online   1m       50 km/h  52.10000, 4.10000\n" +
+		"Van B  offline  -        -        -\n"
+	if buf.String() != want {
+		t.Errorf("render =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// With colours, only the values that changed are highlighted
+	colored := &view{color: true}
+	colored.render(&bytes.Buffer{}, rows, now, "Onntrack devices")
+
+	rows[0].Speed = 80
+	buf.Reset()
+	colored.render(&buf, rows, now, "Onntrack devices")
+
+	out := buf.String()
+	if !strings.HasPrefix(out, clearScreen) {
+		t.Errorf("render does not clear the screen")
+	}
+	if !strings.Contains(out, highlight+"80 km/h"+reset) {
+		t.Errorf("render does not highlight the changed speed:\n%q", out)
+	}
+	if strings.Contains(out, highlight+"online"+reset) {
+		t.Errorf("render highlights the unchanged status:\n%q", out)
+	}
+	if strings.Count(out, highlight) != 1 {
+		t.Errorf("render highlights %d cells, want 1", strings.Count(out, highlight))
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{-time.Second, "0s"},
+		{45 * time.Second, "45s"},
+		{12 * time.Minute, "12m"},
+		{3 * time.Hour, "3h"},
+		{50 * time.Hour, "2d"},
+	}
+
+	for _, tt := range tests {
+		if got := formatAge(tt.in); got != tt.want {
+			t.Errorf("formatAge(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (a *app) login(ctx context.Context, args []string) error {
+	fs := a.flagSet("login")
+	account := fs.String("account", envOr("ONNTRACK_ACCOUNT", a.profile.Account), "account name or e-mail address")
+	language := fs.String("language", a.profile.Language, "language of platform messages")
+	nodeID := fs.String("node-id", a.profile.NodeID, "platform node ID")
+	if err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *account == "" {
+		return &usageError{"login requires -account, ONNTRACK_ACCOUNT or an account in the profile"}
+	}
+	a.profile.Account = *account
+	a.profile.Language = *language
+	a.profile.NodeID = *nodeID
+
+	// Prefer the environment so passwords stay out of shell history
+	password := os.Getenv("ONNTRACK_PASSWORD")
+	if password == "" {
+		fmt.Fprint(a.stderr, "Password: ")
+		line, err := bufio.NewReader(a.stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return &usageError{"no password given"}
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	loginResp, _, err := a.client.Auth.Login(ctx, a.profile.LoginRequest(password))
+	if err != nil {
+		return err
+	}
+	if !loginResp.OK {
+		return &authError{fmt.Sprintf("login failed: %s (code %d)", loginResp.Msg, loginResp.Code)}
+	}
+
+	if err := a.profile.SaveToken(loginResp.Data.Token); err != nil {
+		return fmt.Errorf("saving token: %w", err)
+	}
+
+	fmt.Fprintf(a.stderr, "Logged in as %s (profile %s)\n", *account, a.profile.Name)
+	return nil
+}
+
+func (a *app) whoami(ctx context.Context, args []string) error {
+	fs := a.flagSet("whoami")
+	if err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if a.client.APIKey == "" {
+		return &authError{"not logged in"}
+	}
+
+	claims, err := tokenClaims(a.client.APIKey)
+	if err != nil {
+		return &authError{err.Error()}
+	}
+
+	// Show the expiry as a date rather than a Unix timestamp
+	if exp, ok := claims["exp"].(float64); ok {
+		expires := time.Unix(int64(exp), 0)
+		claims["exp"] = expires.Format(time.RFC3339)
+		if time.Now().After(expires) {
+			fmt.Fprintln(a.stderr, "Warning: the cached token has expired, run onntrack login")
+		}
+	}
+
+	keys := make([]string, 0, len(claims))
+	for k := range claims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	t := &table{header: []string{"CLAIM", "VALUE"}}
+	for _, k := range keys {
+		t.rows = append(t.rows, []string{k, fmt.Sprint(claims[k])})
+	}
+
+	return a.print(claims, t)
+}
+
+// tokenClaims returns the claims of a JWT without verifying its signature.
+// That is left to the platform; we only use them for display.
+func tokenClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("cached token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("decoding token: %w", err)
+	}
+
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("decoding token: %w", err)
+	}
+
+	return claims, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
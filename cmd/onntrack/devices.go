@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+var deviceHeader = []string{"ID", "NAME", "TYPE", "IMEI", "STATUS", "LAST UPDATED"}
+
+func deviceRow(d *onntrackclient.Device) []string {
+	return []string{d.ID, d.Name, d.Type, d.IMEI, d.Status, d.LastUpdated}
+}
+
+func (a *app) devices(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return &usageError{"devices requires a subcommand: list, get, create, update, delete or import"}
+	}
+
+	switch args[0] {
+	case "list":
+		return a.devicesList(ctx, args[1:])
+	case "get":
+		return a.devicesGet(ctx, args[1:])
+	case "create":
+		return a.devicesCreate(ctx, args[1:])
+	case "update":
+		return a.devicesUpdate(ctx, args[1:])
+	case "delete":
+		return a.devicesDelete(ctx, args[1:])
+	case "import":
+		return a.devicesImport(ctx, args[1:])
+	default:
+		return &usageError{fmt.Sprintf("unknown devices subcommand %q", args[0])}
+	}
+}
+
+func (a *app) devicesList(ctx context.Context, args []string) error {
+	fs := a.flagSet("devices list")
+	opts := new(onntrackclient.DeviceListOptions)
+	fs.StringVar(&opts.Status, "status", "", "only list devices with this status")
+	fs.StringVar(&opts.Group, "group", "", "only list devices in this group")
+	if err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	devices, _, err := a.client.Devices.ListAll(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	t := &table{header: deviceHeader}
+	for _, d := range devices {
+		t.rows = append(t.rows, deviceRow(d))
+	}
+
+	return a.print(devices, t)
+}
+
+func (a *app) devicesGet(ctx context.Context, args []string) error {
+	fs := a.flagSet("devices get")
+	if err := a.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	device, _, err := a.client.Devices.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return a.print(device, &table{header: deviceHeader, rows: [][]string{deviceRow(device)}, single: true})
+}
+
+func (a *app) devicesCreate(ctx context.Context, args []string) error {
+	fs := a.flagSet("devices create")
+	req := new(onntrackclient.DeviceCreateRequest)
+	fs.StringVar(&req.Name, "name", "", "device name")
+	fs.StringVar(&req.Type, "type", "", "device type")
+	fs.StringVar(&req.IMEI, "imei", "", "device IMEI")
+	fs.StringVar(&req.Group, "group", "", "device group")
+	fs.StringVar(&req.SIM, "sim", "", "phone number of the SIM card")
+	fs.StringVar(&req.ICCID, "iccid", "", "serial number of the SIM card")
+	if err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if req.IMEI == "" {
+		return &usageError{"devices create requires -imei"}
+	}
+
+	device, _, err := a.client.Devices.Create(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return a.print(device, &table{header: deviceHeader, rows: [][]string{deviceRow(device)}, single: true})
+}
+
+func (a *app) devicesUpdate(ctx context.Context, args []string) error {
+	fs := a.flagSet("devices update")
+	req := new(onntrackclient.DeviceUpdateRequest)
+	fs.StringVar(&req.Name, "name", "", "new device name")
+	fs.StringVar(&req.Status, "status", "", "new device status")
+	fs.StringVar(&req.SIM, "sim", "", "new SIM phone number")
+	fs.StringVar(&req.ICCID, "iccid", "", "new SIM serial number")
+	if err := a.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	device, _, err := a.client.Devices.Update(ctx, fs.Arg(0), req)
+	if err != nil {
+		return err
+	}
+
+	return a.print(device, &table{header: deviceHeader, rows: [][]string{deviceRow(device)}, single: true})
+}
+
+func (a *app) devicesDelete(ctx context.Context, args []string) error {
+	fs := a.flagSet("devices delete")
+	if err := a.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	if _, err := a.client.Devices.Delete(ctx, fs.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "Deleted device %s\n", fs.Arg(0))
+	return nil
+}
+
+// importReport is the printed form of an import result.
+type importReport struct {
+	Line     int    `json:"line"`
+	IMEI     string `json:"imei"`
+	Action   string `json:"action"`
+	DeviceID string `json:"deviceId,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (a *app) devicesImport(ctx context.Context, args []string) error {
+	fs := a.flagSet("devices import")
+	format := fs.String("format", "", "file format: csv or json (default from the file extension)")
+	dryRun := fs.Bool("dry-run", false, "only show what would be done")
+	concurrency := fs.Int("concurrency", 4, "number of requests sent at the same time")
+	if err := a.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	rows, err := onntrackclient.ReadDeviceRows(f, *format)
+	f.Close()
+	if err != nil {
+		return &usageError{fmt.Sprintf("reading %s: %v", path, err)}
+	}
+
+	results, err := a.client.Devices.Import(ctx, rows, &onntrackclient.ImportOptions{
+		Concurrency: *concurrency,
+		DryRun:      *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	reports := make([]importReport, len(results))
+	t := &table{header: []string{"LINE", "IMEI", "ACTION", "DEVICE", "ERROR"}}
+	failed := 0
+	for i, result := range results {
+		report := importReport{Line: result.Row.Line, IMEI: result.Row.IMEI, Action: string(result.Action)}
+		if result.Device != nil {
+			report.DeviceID = result.Device.ID
+		}
+		if result.Err != nil {
+			report.Error = result.Err.Error()
+			failed++
+		}
+		reports[i] = report
+		t.rows = append(t.rows, []string{strconv.Itoa(report.Line), report.IMEI, report.Action, report.DeviceID, report.Error})
+	}
+
+	if err := a.print(reports, t); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", failed, len(results))
+	}
+	return nil
+}
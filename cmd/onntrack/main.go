@@ -0,0 +1,233 @@
+// Command onntrack is a command-line client for the Onntrack platform.
+//
+// Usage:
+//
+//	onntrack [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	login                  log in and cache the session token
+//	whoami                 show the account the cached token belongs to
+//	devices list           list devices
+//	devices get <id>       show a single device
+//	devices create         create a device
+//	devices update <id>    update a device
+//	devices delete <id>    delete a device
+//	devices import <file>  create and update devices from a CSV or JSON file
+//
+// Settings are read from the profile selected with -profile or
+// ONNTRACK_PROFILE in the config file, see onntrackclient.Config. The
+// -base-url and -token-file flags override the profile.
+//
+// Results are printed as a table by default; use -o to select json, yaml or
+// csv instead. The exit code reflects the kind of error: 2 for usage
+// errors, 3 for authentication errors, 4 when something was not found, 5 for
+// other API errors and 6 for network errors.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// Exit codes
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitAuth     = 3
+	exitNotFound = 4
+	exitAPI      = 5
+	exitNetwork  = 6
+)
+
+const usage = `Usage: onntrack [flags] <command> [arguments]
+
+Commands:
+  login                  log in and cache the session token
+  whoami                 show the account the cached token belongs to
+  devices list           list devices
+  devices get <id>       show a single device
+  devices create         create a device
+  devices update <id>    update a device
+  devices delete <id>    delete a device
+  devices import <file>  create and update devices from a CSV or JSON file
+
+Flags:
+`
+
+// app holds the state shared by all commands.
+type app struct {
+	client  *onntrackclient.Client
+	profile *onntrackclient.Profile
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	format  string
+}
+
+// usageError is returned for invalid command lines.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// authError is returned when the platform rejects the credentials or no
+// session token is available.
+type authError struct {
+	msg string
+}
+
+func (e *authError) Error() string {
+	return e.msg
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("onntrack", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	configPath := fs.String("config", "", "config file (default $ONNTRACK_CONFIG or onntrack/config in the user config directory)")
+	profileName := fs.String("profile", "", "config profile (default $ONNTRACK_PROFILE or \"default\")")
+	baseURL := fs.String("base-url", os.Getenv("ONNTRACK_BASE_URL"), "base URL of the platform API, overriding the profile")
+	tokenFile := fs.String("token-file", os.Getenv("ONNTRACK_TOKEN_FILE"), "file the session token is cached in, overriding the profile")
+	format := fs.String("o", "table", "output format: table, json, yaml or csv")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		fmt.Fprintf(stderr, "onntrack: unknown output format %q\n", *format)
+		return exitUsage
+	}
+
+	profile, _, err := onntrackclient.LoadConfig(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack: %v\n", err)
+		return exitUsage
+	}
+	if *baseURL != "" {
+		profile.BaseURL = *baseURL
+	}
+	if *tokenFile != "" {
+		profile.TokenCache = *tokenFile
+	}
+
+	options, err := profile.ClientOptions()
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack: %v\n", err)
+		return exitError
+	}
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "onntrack: %v\n", err)
+		return exitUsage
+	}
+
+	a := &app{
+		client:  client,
+		profile: profile,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+		format:  *format,
+	}
+
+	if err := a.dispatch(ctx, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "onntrack: %v\n", err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
+
+func (a *app) dispatch(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "login":
+		return a.login(ctx, args[1:])
+	case "whoami":
+		return a.whoami(ctx, args[1:])
+	case "devices":
+		return a.devices(ctx, args[1:])
+	default:
+		return &usageError{fmt.Sprintf("unknown command %q", args[0])}
+	}
+}
+
+// flagSet returns a flag set for a subcommand that reports errors instead
+// of exiting.
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+// parse parses the flags of a subcommand and checks the number of
+// positional arguments.
+func (a *app) parse(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return &usageError{err.Error()}
+	}
+	if fs.NArg() != nargs {
+		return &usageError{fmt.Sprintf("%s expects %d argument(s), got %d", fs.Name(), nargs, fs.NArg())}
+	}
+	return nil
+}
+
+// exitCode maps an error to the exit code for its kind.
+func exitCode(err error) int {
+	var usageErr *usageError
+	var validationErr *onntrackclient.ValidationError
+	var authErr *authError
+	var errResp *onntrackclient.ErrorResponse
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &usageErr), errors.As(err, &validationErr):
+		return exitUsage
+	case errors.As(err, &authErr):
+		return exitAuth
+	case errors.As(err, &errResp):
+		switch errResp.Response.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		case http.StatusNotFound:
+			return exitNotFound
+		}
+		return exitAPI
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return exitNetwork
+	default:
+		return exitError
+	}
+}
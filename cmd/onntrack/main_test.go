@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+// newTestServer starts a fake platform with two active devices and an
+// inactive one.
+func newTestServer(t *testing.T) *onntracktest.Server {
+	srv := onntracktest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddDevice(&onntrackclient.Device{ID: "device-1", Name: "Van 1", Type: "tracker", IMEI: "123456789012345", Status: "active", Group: "Delivery"})
+	srv.AddDevice(&onntrackclient.Device{ID: "device-2", Name: "Van: 2", Type: "tracker", IMEI: "987654321098765", Status: "active"})
+	srv.AddDevice(&onntrackclient.Device{ID: "device-3", Name: "Van 3", Type: "tracker", IMEI: "490154203237518", Status: "inactive", Group: "Delivery"})
+	return srv
+}
+
+// writeFile writes a test file and fails the test if that is not possible.
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+}
+
+// writeToken writes a token of the default account to a new token file and
+// returns its path.
+func writeToken(t *testing.T, srv *onntracktest.Server) string {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, srv.IssueToken(onntracktest.DefaultAccount)+"\n")
+	return tokenFile
+}
+
+func runCLI(t *testing.T, srv *onntracktest.Server, tokenFile string, args ...string) (int, string, string) {
+	// Keep the user's own config file out of the tests
+	configFile := filepath.Join(t.TempDir(), "config")
+	writeFile(t, configFile, "[default]\n")
+
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", configFile, "-base-url", srv.URL, "-token-file", tokenFile}, args...)
+	code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_DevicesList(t *testing.T) {
+	srv := newTestServer(t)
+	tokenFile := writeToken(t, srv)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"table", "ID        NAME    TYPE     IMEI             STATUS  LAST UPDATED\n" +
+			"device-1  Van 1   tracker  123456789012345  active  \n" +
+			"device-2  Van: 2  tracker  987654321098765  active  \n"},
+		{"csv", "id,name,type,imei,status,last_updated\n" +
+			"device-1,Van 1,tracker,123456789012345,active,\n" +
+			"device-2,Van: 2,tracker,987654321098765,active,\n"},
+		{"yaml", "- id: device-1\n  name: Van 1\n  type: tracker\n  imei: \"123456789012345\"\n  status: active\n  last_updated: \"\"\n" +
+			"- id: device-2\n  name: \"Van: 2\"\n  type: tracker\n  imei: \"987654321098765\"\n  status: active\n  last_updated: \"\"\n"},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, srv, tokenFile, "-o", tt.format, "devices", "list", "-status", "active")
+		if code != exitOK {
+			t.Fatalf("devices list -o %s exited with %d: %s", tt.format, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("devices list -o %s =\n%s\nwant\n%s", tt.format, stdout, tt.want)
+		}
+	}
+}
+
+func TestRun_DevicesGroup(t *testing.T) {
+	srv := newTestServer(t)
+	tokenFile := writeToken(t, srv)
+
+	code, stdout, stderr := runCLI(t, srv, tokenFile, "-o", "csv", "devices", "list", "-group", "Delivery")
+	if code != exitOK {
+		t.Fatalf("devices list -group exited with %d: %s", code, stderr)
+	}
+	want := "id,name,type,imei,status,last_updated\n" +
+		"device-1,Van 1,tracker,123456789012345,active,\n" +
+		"device-3,Van 3,tracker,490154203237518,inactive,\n"
+	if stdout != want {
+		t.Errorf("devices list -group =\n%s\nwant\n%s", stdout, want)
+	}
+
+	code, stdout, stderr = runCLI(t, srv, tokenFile, "-o", "json", "devices", "create", "-imei", "352099001761481", "-group", "Delivery")
+	if code != exitOK {
+		t.Fatalf("devices create -group exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"group": "Delivery"`) {
+		t.Errorf("devices create -group = %s, want the group", stdout)
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	srv := newTestServer(t)
+	tokenFile := writeToken(t, srv)
+	srv.AddFault(onntracktest.Fault{Path: "devices/missing", Status: http.StatusNotFound})
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{}, exitUsage},
+		{[]string{"frobnicate"}, exitUsage},
+		{[]string{"devices", "get"}, exitUsage},
+		{[]string{"-o", "xml", "devices", "list"}, exitUsage},
+		{[]string{"devices", "get", "missing"}, exitNotFound},
+	}
+
+	for _, tt := range tests {
+		if code, _, _ := runCLI(t, srv, tokenFile, tt.args...); code != tt.want {
+			t.Errorf("onntrack %v exited with %d, want %d", tt.args, code, tt.want)
+		}
+	}
+
+	// Without a token the command is not logged in
+	noToken := filepath.Join(t.TempDir(), "token")
+	if code, _, _ := runCLI(t, srv, noToken, "whoami"); code != exitAuth {
+		t.Errorf("onntrack whoami exited with %d, want %d", code, exitAuth)
+	}
+}
+
+func TestRun_LoginAndWhoami(t *testing.T) {
+	srv := newTestServer(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+
+	t.Setenv("ONNTRACK_PASSWORD", onntracktest.DefaultPassword)
+	code, _, stderr := runCLI(t, srv, tokenFile, "login", "-account", onntracktest.DefaultAccount)
+	if code != exitOK {
+		t.Fatalf("login exited with %d: %s", code, stderr)
+	}
+	srv.AssertCalled(t, http.MethodPost, "homepage/login", 1)
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatalf("login did not write the token file: %v", err)
+	}
+	if len(token) < 2 || token[len(token)-1] != '\n' {
+		t.Errorf("token file = %q, want a token on one line", token)
+	}
+
+	code, stdout, stderr := runCLI(t, srv, tokenFile, "-o", "yaml", "whoami")
+	if code != exitOK {
+		t.Fatalf("whoami exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "- claim: sub\n  value: test@example.com\n") {
+		t.Errorf("whoami = %q, want it to contain the subject", stdout)
+	}
+}
+
+func TestRun_Profile(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+
+	configFile := filepath.Join(dir, "config")
+	writeFile(t, configFile, `
+[default]
+base_url = http://127.0.0.1:1/
+
+[staging]
+base_url = `+srv.URL+`
+account = `+onntracktest.DefaultAccount+`
+token_cache = `+filepath.Join(dir, "staging.token")+`
+`)
+
+	var stdout, stderr bytes.Buffer
+	t.Setenv("ONNTRACK_PASSWORD", onntracktest.DefaultPassword)
+	code := run(context.Background(), []string{"-config", configFile, "-profile", "staging", "login"}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("login exited with %d: %s", code, stderr.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "staging.token")); err != nil {
+		t.Errorf("login did not write the profile's token cache: %v", err)
+	}
+
+	t.Setenv("ONNTRACK_PROFILE", "production")
+	code = run(context.Background(), []string{"-config", configFile, "whoami"}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("whoami with unknown profile exited with %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// table is the tabular form of a command's result. It is used by every
+// output format except JSON, which encodes the API value directly.
+type table struct {
+	header []string
+	rows   [][]string
+
+	// single is set when the result is one object rather than a list.
+	single bool
+}
+
+func validFormat(format string) bool {
+	switch format {
+	case "table", "json", "yaml", "csv":
+		return true
+	}
+	return false
+}
+
+// print writes a command's result in the selected output format.
+func (a *app) print(v interface{}, t *table) error {
+	switch a.format {
+	case "json":
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		return writeYAML(a.stdout, t)
+	case "csv":
+		return writeCSV(a.stdout, t)
+	default:
+		return writeTable(a.stdout, t)
+	}
+}
+
+func writeTable(w io.Writer, t *table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, t *table) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(t.header))
+	for i, h := range t.header {
+		header[i] = yamlKey(h)
+	}
+	cw.Write(header)
+	cw.WriteAll(t.rows)
+	return cw.Error()
+}
+
+// writeYAML writes the table as a YAML sequence of mappings, or as a single
+// mapping for single results. Only strings are written, quoted when needed,
+// which is enough for the flat values the commands print.
+func writeYAML(w io.Writer, t *table) error {
+	for _, row := range t.rows {
+		for i, value := range row {
+			prefix := "  "
+			if t.single {
+				prefix = ""
+			} else if i == 0 {
+				prefix = "- "
+			}
+			if _, err := fmt.Fprintf(w, "%s%s: %s\n", prefix, yamlKey(t.header[i]), yamlValue(value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlKey turns a column header such as "LAST UPDATED" into "last_updated".
+func yamlKey(header string) string {
+	return strings.ReplaceAll(strings.ToLower(header), " ", "_")
+}
+
+// yamlValue quotes a value if YAML would otherwise read it as something
+// other than the same plain string.
+func yamlValue(s string) string {
+	switch {
+	case s == "", strings.TrimSpace(s) != s, strings.ContainsAny(s, "\"\n"):
+		return strconv.Quote(s)
+	case strings.Contains(s, ": "), strings.Contains(s, " #"), strings.HasSuffix(s, ":"):
+		return strconv.Quote(s)
+	case strings.ContainsRune("-?:,[]{}#&*!|>'%@`", rune(s[0])):
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,340 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ConfigEnv is the environment variable that overrides the config file path.
+	ConfigEnv = "ONNTRACK_CONFIG"
+
+	// ProfileEnv is the environment variable that selects a profile.
+	ProfileEnv = "ONNTRACK_PROFILE"
+
+	// DefaultProfile is the profile used when none is selected.
+	DefaultProfile = "default"
+
+	// AccountEnv is the environment variable that overrides the account of
+	// a profile in Profile.Login.
+	AccountEnv = "ONNTRACK_ACCOUNT"
+
+	// PasswordEnv is the environment variable Profile.Login reads the
+	// password from.
+	PasswordEnv = "ONNTRACK_PASSWORD"
+)
+
+// Profile holds the settings for one platform deployment and account.
+type Profile struct {
+	Name string
+
+	// BaseURL is the base URL of the platform API. DefaultBaseURL is used
+	// when it is empty.
+	BaseURL string
+
+	Account  string
+	Language string
+	NodeID   string
+
+	// TokenCache is the file the session token is stored in. See TokenPath.
+	TokenCache string
+}
+
+// Config is a set of named profiles read from a config file.
+//
+// The file has one section per profile with key = value lines:
+//
+//	[default]
+//	base_url = https://platform.onntrack.nl/v3/new/
+//	account = ops@example.com
+//	language = en
+//
+//	[whitelabel]
+//	base_url = https://api.jimi-platform.com/
+//	account = ops@example.com
+//	node_id = 42
+//	token_cache = ~/.cache/onntrack/whitelabel.token
+//
+// Lines starting with # or ; are comments.
+type Config struct {
+	Profiles map[string]*Profile
+}
+
+// DefaultConfigPath returns the path of the config file: the value of
+// ONNTRACK_CONFIG if set, otherwise onntrack/config in the user's config
+// directory.
+func DefaultConfigPath() (string, error) {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "onntrack", "config"), nil
+}
+
+// ReadConfig parses a config file.
+func ReadConfig(r io.Reader) (*Config, error) {
+	config := &Config{Profiles: make(map[string]*Profile)}
+
+	var current *Profile
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			name := strings.TrimSpace(text[1 : len(text)-1])
+			if name == "" {
+				return nil, fmt.Errorf("config line %d: empty profile name", line)
+			}
+			if _, ok := config.Profiles[name]; ok {
+				return nil, fmt.Errorf("config line %d: duplicate profile %q", line, name)
+			}
+			current = &Profile{Name: name}
+			config.Profiles[name] = current
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("config line %d: expected key = value", line)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("config line %d: setting outside of a profile", line)
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch key {
+		case "base_url":
+			current.BaseURL = value
+		case "account":
+			current.Account = value
+		case "language":
+			current.Language = value
+		case "node_id":
+			current.NodeID = value
+		case "token_cache":
+			current.TokenCache = value
+		default:
+			return nil, fmt.Errorf("config line %d: unknown setting %q", line, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Profile returns the named profile. An empty name selects the profile in
+// ONNTRACK_PROFILE, or the default profile if that is not set either.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q (have %s)", name, strings.Join(names, ", "))
+	}
+
+	return profile, nil
+}
+
+// TokenPath returns the file the profile's session token is cached in:
+// TokenCache with a leading ~ expanded, or <name>.token in the onntrack
+// directory of the user's config directory.
+func (p *Profile) TokenPath() (string, error) {
+	if p.TokenCache != "" {
+		return expandHome(p.TokenCache)
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "onntrack", p.Name+".token"), nil
+}
+
+// Token returns the cached session token, or an empty string if none has
+// been saved yet.
+func (p *Profile) Token() (string, error) {
+	path, err := p.TokenPath()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SaveToken writes a session token to the profile's token cache. The file
+// is only readable by the current user.
+func (p *Profile) SaveToken(token string) error {
+	path, err := p.TokenPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(token+"\n"), 0o600)
+}
+
+// LoginRequest returns a login request for the profile's account.
+func (p *Profile) LoginRequest(password string) *LoginRequest {
+	language := p.Language
+	if language == "" {
+		language = "en"
+	}
+
+	return &LoginRequest{
+		Account:  p.Account,
+		Password: password,
+		Language: language,
+		NodeID:   p.NodeID,
+	}
+}
+
+// Login returns a function that logs client in with the account of the
+// profile, or of ONNTRACK_ACCOUNT, and the password in ONNTRACK_PASSWORD.
+// Long-running commands call it at start and again whenever IsAuthError
+// reports an expired session. It returns nil when ONNTRACK_PASSWORD is not
+// set, in which case the cached token is all there is.
+func (p *Profile) Login(client *Client) func(ctx context.Context) error {
+	password := os.Getenv(PasswordEnv)
+	if password == "" {
+		return nil
+	}
+	loginReq := p.LoginRequest(password)
+	if account := os.Getenv(AccountEnv); account != "" {
+		loginReq.Account = account
+	}
+
+	return func(ctx context.Context) error {
+		loginResp, _, err := client.Auth.Login(ctx, loginReq)
+		if err != nil {
+			return err
+		}
+		if !loginResp.OK {
+			return fmt.Errorf("login failed: %s (code %d)", loginResp.Msg, loginResp.Code)
+		}
+		return nil
+	}
+}
+
+// ClientOptions returns the options that configure a client for the
+// profile: its base URL and, if one has been cached, its session token.
+func (p *Profile) ClientOptions() ([]ClientOption, error) {
+	var options []ClientOption
+
+	if p.BaseURL != "" {
+		options = append(options, WithBaseURL(p.BaseURL))
+	}
+
+	token, err := p.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		options = append(options, WithAPIKey(token))
+	}
+
+	return options, nil
+}
+
+// LoadConfig reads a config file and returns the selected profile together
+// with the options that configure a client for it:
+//
+//	profile, options, err := onntrackclient.LoadConfig("", "")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	client, err := onntrackclient.NewClient(options...)
+//
+// An empty path reads the file returned by DefaultConfigPath; if that file
+// does not exist and ONNTRACK_CONFIG is not set, an empty default profile is
+// used. An empty profile name is resolved as described for Config.Profile.
+func LoadConfig(path, profile string) (*Profile, []ClientOption, error) {
+	config, err := loadConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := config.Profile(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options, err := p.ClientOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, options, nil
+}
+
+func loadConfigFile(path string) (*Config, error) {
+	// Only fall back to an empty profile when no file was asked for
+	explicit := path != "" || os.Getenv(ConfigEnv) != ""
+	if path == "" {
+		var err error
+		if path, err = DefaultConfigPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return &Config{Profiles: map[string]*Profile{
+			DefaultProfile: {Name: DefaultProfile},
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadConfig(f)
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
@@ -0,0 +1,125 @@
+package onntrackclient
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# Onntrack profiles
+[default]
+base_url = https://platform.onntrack.nl/v3/new/
+account = ops@example.com
+
+[whitelabel]
+base_url = https://api.jimi-platform.com/
+account = fleet@example.com
+language = nl
+node_id = 42
+`
+
+func TestReadConfig(t *testing.T) {
+	config, err := ReadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ReadConfig returned unexpected error: %v", err)
+	}
+
+	if len(config.Profiles) != 2 {
+		t.Fatalf("ReadConfig returned %d profiles, want 2", len(config.Profiles))
+	}
+
+	p := config.Profiles["whitelabel"]
+	if p.BaseURL != "https://api.jimi-platform.com/" {
+		t.Errorf("Profile BaseURL = %v, want %v", p.BaseURL, "https://api.jimi-platform.com/")
+	}
+	if p.NodeID != "42" {
+		t.Errorf("Profile NodeID = %v, want %v", p.NodeID, "42")
+	}
+
+	req := p.LoginRequest("secret")
+	if req.Account != "fleet@example.com" || req.Language != "nl" || req.NodeID != "42" {
+		t.Errorf("LoginRequest = %+v, want the profile's account, language and node", req)
+	}
+}
+
+func TestReadConfig_Invalid(t *testing.T) {
+	tests := []string{
+		"base_url = https://example.com/\n",
+		"[default]\nbase_url\n",
+		"[default]\ncolour = blue\n",
+		"[default]\n[default]\n",
+	}
+
+	for _, tt := range tests {
+		if _, err := ReadConfig(strings.NewReader(tt)); err == nil {
+			t.Errorf("ReadConfig(%q) expected error, got nil", tt)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	tokenPath := filepath.Join(dir, "whitelabel.token")
+	if err := os.WriteFile(path, []byte(testConfig+"token_cache = "+tokenPath+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+
+	// Select the profile through the environment
+	t.Setenv(ProfileEnv, "whitelabel")
+
+	profile, _, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("LoadConfig returned unexpected error: %v", err)
+	}
+	if profile.Name != "whitelabel" {
+		t.Errorf("LoadConfig profile = %v, want %v", profile.Name, "whitelabel")
+	}
+
+	if err := profile.SaveToken("cached-token"); err != nil {
+		t.Fatalf("SaveToken returned unexpected error: %v", err)
+	}
+
+	_, options, err := LoadConfig(path, "whitelabel")
+	if err != nil {
+		t.Fatalf("LoadConfig returned unexpected error: %v", err)
+	}
+
+	client, err := NewClient(options...)
+	if err != nil {
+		t.Fatalf("NewClient returned unexpected error: %v", err)
+	}
+	if client.BaseURL.String() != "https://api.jimi-platform.com/" {
+		t.Errorf("Client BaseURL = %v, want %v", client.BaseURL, "https://api.jimi-platform.com/")
+	}
+	if client.APIKey != "cached-token" {
+		t.Errorf("Client APIKey = %v, want %v", client.APIKey, "cached-token")
+	}
+
+	if _, _, err := LoadConfig(path, "missing"); err == nil {
+		t.Error("LoadConfig with unknown profile expected error, got nil")
+	}
+}
+
+func TestLoadConfig_MissingFile(t *testing.T) {
+	t.Setenv(ConfigEnv, "")
+	t.Setenv(ProfileEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// Without a config file the default profile is empty
+	profile, options, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatalf("LoadConfig returned unexpected error: %v", err)
+	}
+	if profile.Name != DefaultProfile || len(options) != 0 {
+		t.Errorf("LoadConfig = %+v with %d options, want empty default profile", profile, len(options))
+	}
+
+	// An explicit path must exist
+	if _, _, err := LoadConfig(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("LoadConfig with missing explicit file expected error, got nil")
+	}
+}
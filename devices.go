@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
 // DevicesService handles communication with the device related
@@ -19,6 +21,28 @@ type Device struct {
 	IMEI        string `json:"imei"`
 	Status      string `json:"status"`
 	LastUpdated string `json:"last_updated"`
+
+	// Customer is the name of the customer account the device belongs to.
+	Customer string `json:"customer"`
+
+	// Group is the name of the device group within the customer account.
+	Group string `json:"group"`
+
+	// SIM is the phone number of the SIM card in the device.
+	SIM string `json:"sim"`
+
+	// ICCID is the serial number of the SIM card in the device.
+	ICCID string `json:"iccid"`
+
+	// ActivationTime is when the device was first activated on the platform.
+	ActivationTime Timestamp `json:"activation_time"`
+
+	// UserExpiry is when the end user's service period ends.
+	UserExpiry Timestamp `json:"user_expiry"`
+
+	// PlatformExpiry is when the platform subscription ends. The device
+	// stops reporting after this date.
+	PlatformExpiry Timestamp `json:"platform_expiry"`
 	// Add other device fields as needed
 }
 
@@ -33,6 +57,9 @@ type DeviceListOptions struct {
 
 	// Filter by device status
 	Status string `url:"status,omitempty"`
+
+	// Filter by device group
+	Group string `url:"group,omitempty"`
 }
 
 // List devices.
@@ -40,7 +67,24 @@ type DeviceListOptions struct {
 // Jimi API docs: [URL to API documentation]
 func (s *DevicesService) List(ctx context.Context, opts *DeviceListOptions) ([]*Device, *http.Response, error) {
 	u := "devices"
-	// TODO: Add query parameters from opts
+	if opts != nil {
+		params := url.Values{}
+		if opts.Page > 0 {
+			params.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PerPage > 0 {
+			params.Set("per_page", strconv.Itoa(opts.PerPage))
+		}
+		if opts.Status != "" {
+			params.Set("status", opts.Status)
+		}
+		if opts.Group != "" {
+			params.Set("group", opts.Group)
+		}
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+	}
 
 	req, err := s.client.NewRequest(ctx, http.MethodGet, u, nil)
 	if err != nil {
@@ -48,7 +92,7 @@ func (s *DevicesService) List(ctx context.Context, opts *DeviceListOptions) ([]*
 	}
 
 	var devices []*Device
-	resp, err := s.client.Do(req, &devices)
+	resp, err := s.client.doData(req, &devices)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -56,6 +100,38 @@ func (s *DevicesService) List(ctx context.Context, opts *DeviceListOptions) ([]*
 	return devices, resp, nil
 }
 
+// devicePageSize is the page size ListAll uses when none is given.
+const devicePageSize = 100
+
+// ListAll pages through the devices matching opts and returns all of them.
+// The Page option is used as the first page to fetch. The response is that
+// of the last page.
+func (s *DevicesService) ListAll(ctx context.Context, opts *DeviceListOptions) ([]*Device, *http.Response, error) {
+	pageOpts := DeviceListOptions{Page: 1, PerPage: devicePageSize}
+	if opts != nil {
+		pageOpts.Status, pageOpts.Group = opts.Status, opts.Group
+		if opts.Page > 0 {
+			pageOpts.Page = opts.Page
+		}
+		if opts.PerPage > 0 {
+			pageOpts.PerPage = opts.PerPage
+		}
+	}
+
+	var all []*Device
+	for {
+		devices, resp, err := s.List(ctx, &pageOpts)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, devices...)
+		if len(devices) < pageOpts.PerPage {
+			return all, resp, nil
+		}
+		pageOpts.Page++
+	}
+}
+
 // Get a single device.
 //
 // Jimi API docs: [URL to API documentation]
@@ -68,7 +144,7 @@ func (s *DevicesService) Get(ctx context.Context, deviceID string) (*Device, *ht
 	}
 
 	device := new(Device)
-	resp, err := s.client.Do(req, device)
+	resp, err := s.client.doData(req, device)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -78,25 +154,36 @@ func (s *DevicesService) Get(ctx context.Context, deviceID string) (*Device, *ht
 
 // DeviceCreateRequest represents a request to create a device.
 type DeviceCreateRequest struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
-	IMEI string `json:"imei"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	IMEI  string `json:"imei"`
+	Group string `json:"group,omitempty"`
+	SIM   string `json:"sim,omitempty"`
+	ICCID string `json:"iccid,omitempty"`
 	// Add other required fields
 }
 
 // Create a new device.
 //
+// The IMEI is validated and the SIM number and ICCID are normalised before
+// the request is sent; invalid values are returned as a *ValidationError.
+//
 // Jimi API docs: [URL to API documentation]
 func (s *DevicesService) Create(ctx context.Context, deviceReq *DeviceCreateRequest) (*Device, *http.Response, error) {
 	u := "devices"
 
+	deviceReq, err := deviceReq.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	req, err := s.client.NewRequest(ctx, http.MethodPost, u, deviceReq)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	device := new(Device)
-	resp, err := s.client.Do(req, device)
+	resp, err := s.client.doData(req, device)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -107,23 +194,35 @@ func (s *DevicesService) Create(ctx context.Context, deviceReq *DeviceCreateRequ
 // DeviceUpdateRequest represents a request to update a device.
 type DeviceUpdateRequest struct {
 	Name   string `json:"name,omitempty"`
+	Type   string `json:"type,omitempty"`
 	Status string `json:"status,omitempty"`
+	Group  string `json:"group,omitempty"`
+	SIM    string `json:"sim,omitempty"`
+	ICCID  string `json:"iccid,omitempty"`
 	// Add other fields that can be updated
 }
 
 // Update a device.
 //
+// The SIM number and ICCID are normalised before the request is sent;
+// invalid values are returned as a *ValidationError.
+//
 // Jimi API docs: [URL to API documentation]
 func (s *DevicesService) Update(ctx context.Context, deviceID string, deviceReq *DeviceUpdateRequest) (*Device, *http.Response, error) {
 	u := fmt.Sprintf("devices/%s", deviceID)
 
+	deviceReq, err := deviceReq.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	req, err := s.client.NewRequest(ctx, http.MethodPut, u, deviceReq)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	device := new(Device)
-	resp, err := s.client.Do(req, device)
+	resp, err := s.client.doData(req, device)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -142,5 +241,5 @@ func (s *DevicesService) Delete(ctx context.Context, deviceID string) (*http.Res
 		return nil, err
 	}
 
-	return s.client.Do(req, nil)
+	return s.client.doData(req, nil)
 }
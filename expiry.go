@@ -0,0 +1,80 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ExpiresAt returns the earliest of the device's user and platform expiry
+// dates. The second return value is false if neither date is set.
+func (d *Device) ExpiresAt() (time.Time, bool) {
+	var earliest time.Time
+	for _, ts := range []Timestamp{d.UserExpiry, d.PlatformExpiry} {
+		if ts.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || ts.Before(earliest) {
+			earliest = ts.Time
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// CustomerExpiry groups the devices of a single customer that are about to
+// expire.
+type CustomerExpiry struct {
+	Customer string
+	Devices  []*Device
+}
+
+// GroupExpiring returns the devices that expire between now and now+within,
+// grouped by customer. Devices that have already expired are included as
+// well, since they need renewing just as urgently. Groups are sorted by
+// customer name and the devices in each group by expiry date.
+func GroupExpiring(devices []*Device, now time.Time, within time.Duration) []*CustomerExpiry {
+	deadline := now.Add(within)
+
+	groups := make(map[string]*CustomerExpiry)
+	for _, device := range devices {
+		expiresAt, ok := device.ExpiresAt()
+		if !ok || expiresAt.After(deadline) {
+			continue
+		}
+
+		group, ok := groups[device.Customer]
+		if !ok {
+			group = &CustomerExpiry{Customer: device.Customer}
+			groups[device.Customer] = group
+		}
+		group.Devices = append(group.Devices, device)
+	}
+
+	result := make([]*CustomerExpiry, 0, len(groups))
+	for _, group := range groups {
+		sort.SliceStable(group.Devices, func(i, j int) bool {
+			a, _ := group.Devices[i].ExpiresAt()
+			b, _ := group.Devices[j].ExpiresAt()
+			return a.Before(b)
+		})
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Customer < result[j].Customer
+	})
+
+	return result
+}
+
+// ListExpiring lists the devices whose service period expires within the
+// given number of days, grouped by customer. It pages through all devices.
+func (s *DevicesService) ListExpiring(ctx context.Context, days int) ([]*CustomerExpiry, *http.Response, error) {
+	devices, resp, err := s.ListAll(ctx, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return GroupExpiring(devices, time.Now(), time.Duration(days)*24*time.Hour), resp, nil
+}
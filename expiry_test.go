@@ -0,0 +1,83 @@
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGroupExpiring(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) Timestamp {
+		return Timestamp{now.AddDate(0, 0, days)}
+	}
+
+	devices := []*Device{
+		{ID: "1", Customer: "Acme", PlatformExpiry: at(20)},
+		{ID: "2", Customer: "Acme", UserExpiry: at(40), PlatformExpiry: at(3)},
+		{ID: "3", Customer: "Beta", PlatformExpiry: at(-2)},
+		{ID: "4", Customer: "Beta", PlatformExpiry: at(90)},
+		{ID: "5", Customer: "Beta"},
+	}
+
+	groups := GroupExpiring(devices, now, 30*24*time.Hour)
+
+	if len(groups) != 2 {
+		t.Fatalf("GroupExpiring returned %d groups, want 2", len(groups))
+	}
+	if groups[0].Customer != "Acme" || groups[1].Customer != "Beta" {
+		t.Errorf("GroupExpiring customers = %v, %v, want Acme, Beta", groups[0].Customer, groups[1].Customer)
+	}
+	if len(groups[0].Devices) != 2 {
+		t.Fatalf("Acme has %d devices, want 2", len(groups[0].Devices))
+	}
+	if groups[0].Devices[0].ID != "2" {
+		t.Errorf("Acme first device = %v, want %v", groups[0].Devices[0].ID, "2")
+	}
+	if len(groups[1].Devices) != 1 || groups[1].Devices[0].ID != "3" {
+		t.Errorf("Beta devices = %v, want only device 3", groups[1].Devices)
+	}
+}
+
+func TestDevicesService_ListExpiring(t *testing.T) {
+	soon := Timestamp{time.Now().AddDate(0, 0, 5)}
+	later := Timestamp{time.Now().AddDate(1, 0, 0)}
+
+	// 150 devices over two pages; only the last one expires soon
+	devices := make([]*Device, 150)
+	for i := range devices {
+		devices[i] = &Device{ID: fmt.Sprintf("device-%d", i+1), Customer: "Acme", PlatformExpiry: later}
+	}
+	devices[149].PlatformExpiry = soon
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		start := min((page-1)*size, len(devices))
+		end := min(start+size, len(devices))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": devices[start:end]})
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	groups, _, err := client.Devices.ListExpiring(context.Background(), 30)
+	if err != nil {
+		t.Fatalf("ListExpiring returned unexpected error: %v", err)
+	}
+
+	if len(groups) != 1 || len(groups[0].Devices) != 1 {
+		t.Fatalf("ListExpiring returned %v, want one group with one device", groups)
+	}
+	if groups[0].Devices[0].ID != "device-150" {
+		t.Errorf("Device ID = %v, want %v", groups[0].Devices[0].ID, "device-150")
+	}
+}
@@ -0,0 +1,184 @@
+// Package geo converts coordinates between the WGS-84, GCJ-02 and BD-09 datums
+// and measures distances between them.
+//
+// GCJ-02 is the obfuscated datum mandated for maps of mainland China and
+// BD-09 is Baidu's variant of it. Positions in either datum are shifted by
+// up to several hundred metres when drawn on a WGS-84 map such as
+// OpenStreetMap. Coordinates outside mainland China are the same in all
+// three datums.
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// Datum identifies the geodetic datum a coordinate is expressed in.
+type Datum string
+
+const (
+	// WGS84 is the datum used by GPS and most maps outside China.
+	WGS84 Datum = "WGS84"
+
+	// GCJ02 is the Chinese national datum, also used by Google and AMap in China.
+	GCJ02 Datum = "GCJ02"
+
+	// BD09 is the datum used by Baidu Maps.
+	BD09 Datum = "BD09"
+)
+
+// Valid reports whether d is one of the supported datums.
+func (d Datum) Valid() bool {
+	return d == WGS84 || d == GCJ02 || d == BD09
+}
+
+const (
+	// Semi-major axis and eccentricity squared of the Krasovsky 1940
+	// ellipsoid used by the GCJ-02 transformation.
+	krasovskyA  = 6378245.0
+	krasovskyEE = 0.00669342162296594323
+
+	// xPi is the constant used by the BD-09 transformation.
+	xPi = math.Pi * 3000.0 / 180.0
+
+	// Inverse transformations iterate until the error drops below this
+	// many degrees, about a millimetre.
+	tolerance     = 1e-9
+	maxIterations = 30
+)
+
+// OutOfChina reports whether a coordinate lies outside the area where the
+// GCJ-02 and BD-09 offsets are applied.
+func OutOfChina(lat, lng float64) bool {
+	return lng < 72.004 || lng > 137.8347 || lat < 0.8293 || lat > 55.8271
+}
+
+// WGS84ToGCJ02 converts a WGS-84 coordinate to GCJ-02.
+func WGS84ToGCJ02(lat, lng float64) (float64, float64) {
+	if OutOfChina(lat, lng) {
+		return lat, lng
+	}
+
+	dLat := transformLat(lng-105.0, lat-35.0)
+	dLng := transformLng(lng-105.0, lat-35.0)
+
+	radLat := lat / 180.0 * math.Pi
+	magic := math.Sin(radLat)
+	magic = 1 - krasovskyEE*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+
+	dLat = (dLat * 180.0) / ((krasovskyA * (1 - krasovskyEE)) / (magic * sqrtMagic) * math.Pi)
+	dLng = (dLng * 180.0) / (krasovskyA / sqrtMagic * math.Cos(radLat) * math.Pi)
+
+	return lat + dLat, lng + dLng
+}
+
+// GCJ02ToWGS84 converts a GCJ-02 coordinate to WGS-84. The transformation
+// has no closed-form inverse, so the result is refined iteratively until it
+// converts back to the input within about a millimetre.
+func GCJ02ToWGS84(lat, lng float64) (float64, float64) {
+	if OutOfChina(lat, lng) {
+		return lat, lng
+	}
+	return invert(WGS84ToGCJ02, lat, lng)
+}
+
+// GCJ02ToBD09 converts a GCJ-02 coordinate to BD-09.
+func GCJ02ToBD09(lat, lng float64) (float64, float64) {
+	z := math.Sqrt(lng*lng+lat*lat) + 0.00002*math.Sin(lat*xPi)
+	theta := math.Atan2(lat, lng) + 0.000003*math.Cos(lng*xPi)
+	return z*math.Sin(theta) + 0.006, z*math.Cos(theta) + 0.0065
+}
+
+// BD09ToGCJ02 converts a BD-09 coordinate to GCJ-02, refined iteratively in
+// the same way as GCJ02ToWGS84.
+func BD09ToGCJ02(lat, lng float64) (float64, float64) {
+	return invert(GCJ02ToBD09, lat, lng)
+}
+
+// WGS84ToBD09 converts a WGS-84 coordinate to BD-09.
+func WGS84ToBD09(lat, lng float64) (float64, float64) {
+	return GCJ02ToBD09(WGS84ToGCJ02(lat, lng))
+}
+
+// BD09ToWGS84 converts a BD-09 coordinate to WGS-84.
+func BD09ToWGS84(lat, lng float64) (float64, float64) {
+	return GCJ02ToWGS84(BD09ToGCJ02(lat, lng))
+}
+
+// Convert converts a coordinate from one datum to another.
+func Convert(lat, lng float64, from, to Datum) (float64, float64, error) {
+	if !from.Valid() {
+		return 0, 0, fmt.Errorf("geo: unknown datum %q", from)
+	}
+	if !to.Valid() {
+		return 0, 0, fmt.Errorf("geo: unknown datum %q", to)
+	}
+	if from == to {
+		return lat, lng, nil
+	}
+
+	// Go through WGS-84 so every pair only needs the two directions above
+	switch from {
+	case GCJ02:
+		lat, lng = GCJ02ToWGS84(lat, lng)
+	case BD09:
+		lat, lng = BD09ToWGS84(lat, lng)
+	}
+
+	switch to {
+	case GCJ02:
+		lat, lng = WGS84ToGCJ02(lat, lng)
+	case BD09:
+		lat, lng = WGS84ToBD09(lat, lng)
+	}
+
+	return lat, lng, nil
+}
+
+// earthRadius is the mean radius of the earth in metres.
+const earthRadius = 6371008.8
+
+// Distance returns the great-circle distance in metres between two
+// coordinates in the same datum.
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := phi2 - phi1
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(math.Min(a, 1)))
+}
+
+// invert finds the coordinate that forward maps onto (lat, lng) using
+// fixed-point iteration. The offsets vary slowly, so this converges in a
+// handful of steps.
+func invert(forward func(lat, lng float64) (float64, float64), lat, lng float64) (float64, float64) {
+	guessLat, guessLng := lat, lng
+	for i := 0; i < maxIterations; i++ {
+		gotLat, gotLng := forward(guessLat, guessLng)
+		dLat, dLng := gotLat-lat, gotLng-lng
+		guessLat -= dLat
+		guessLng -= dLng
+		if math.Abs(dLat) < tolerance && math.Abs(dLng) < tolerance {
+			break
+		}
+	}
+	return guessLat, guessLng
+}
+
+func transformLat(x, y float64) float64 {
+	ret := -100.0 + 2.0*x + 3.0*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	ret += (20.0*math.Sin(6.0*x*math.Pi) + 20.0*math.Sin(2.0*x*math.Pi)) * 2.0 / 3.0
+	ret += (20.0*math.Sin(y*math.Pi) + 40.0*math.Sin(y/3.0*math.Pi)) * 2.0 / 3.0
+	ret += (160.0*math.Sin(y/12.0*math.Pi) + 320*math.Sin(y*math.Pi/30.0)) * 2.0 / 3.0
+	return ret
+}
+
+func transformLng(x, y float64) float64 {
+	ret := 300.0 + x + 2.0*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	ret += (20.0*math.Sin(6.0*x*math.Pi) + 20.0*math.Sin(2.0*x*math.Pi)) * 2.0 / 3.0
+	ret += (20.0*math.Sin(x*math.Pi) + 40.0*math.Sin(x/3.0*math.Pi)) * 2.0 / 3.0
+	ret += (150.0*math.Sin(x/12.0*math.Pi) + 300.0*math.Sin(x/30.0*math.Pi)) * 2.0 / 3.0
+	return ret
+}
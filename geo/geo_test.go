@@ -0,0 +1,94 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+// Tiananmen Square in WGS-84 and the offsets published for it by AMap and Baidu.
+const (
+	wgsLat, wgsLng = 39.90734, 116.39118
+	gcjLat, gcjLng = 39.908741, 116.397426
+	bdLat, bdLng   = 39.915097, 116.403898
+)
+
+func near(a, b, eps float64) bool {
+	return math.Abs(a-b) < eps
+}
+
+func TestWGS84ToGCJ02(t *testing.T) {
+	lat, lng := WGS84ToGCJ02(wgsLat, wgsLng)
+	if !near(lat, gcjLat, 1e-4) || !near(lng, gcjLng, 1e-4) {
+		t.Errorf("WGS84ToGCJ02 = %v, %v, want %v, %v", lat, lng, gcjLat, gcjLng)
+	}
+}
+
+func TestGCJ02ToBD09(t *testing.T) {
+	lat, lng := GCJ02ToBD09(gcjLat, gcjLng)
+	if !near(lat, bdLat, 1e-4) || !near(lng, bdLng, 1e-4) {
+		t.Errorf("GCJ02ToBD09 = %v, %v, want %v, %v", lat, lng, bdLat, bdLng)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	points := [][2]float64{
+		{wgsLat, wgsLng},
+		{31.2304, 121.4737},
+		{22.5431, 114.0579},
+		{43.8171, 87.6173},
+	}
+
+	for _, p := range points {
+		for _, datum := range []Datum{GCJ02, BD09} {
+			lat, lng, err := Convert(p[0], p[1], WGS84, datum)
+			if err != nil {
+				t.Fatalf("Convert returned unexpected error: %v", err)
+			}
+			if near(lat, p[0], 1e-5) && near(lng, p[1], 1e-5) {
+				t.Errorf("Convert(%v, %v, WGS84, %v) did not shift the point", p[0], p[1], datum)
+			}
+
+			backLat, backLng, err := Convert(lat, lng, datum, WGS84)
+			if err != nil {
+				t.Fatalf("Convert returned unexpected error: %v", err)
+			}
+			// 1e-8 degrees is about a millimetre
+			if !near(backLat, p[0], 1e-8) || !near(backLng, p[1], 1e-8) {
+				t.Errorf("Convert round trip via %v = %v, %v, want %v, %v", datum, backLat, backLng, p[0], p[1])
+			}
+		}
+	}
+}
+
+func TestOutOfChina(t *testing.T) {
+	// Amsterdam gets no GCJ-02 offset, only the BD-09 one
+	lat, lng, err := Convert(52.3676, 4.9041, WGS84, BD09)
+	if err != nil {
+		t.Fatalf("Convert returned unexpected error: %v", err)
+	}
+	wantLat, wantLng := GCJ02ToBD09(52.3676, 4.9041)
+	if lat != wantLat || lng != wantLng {
+		t.Errorf("Convert outside China = %v, %v, want %v, %v", lat, lng, wantLat, wantLng)
+	}
+
+	lat, lng = WGS84ToGCJ02(52.3676, 4.9041)
+	if lat != 52.3676 || lng != 4.9041 {
+		t.Errorf("WGS84ToGCJ02 outside China = %v, %v, want unchanged", lat, lng)
+	}
+}
+
+func TestConvert_UnknownDatum(t *testing.T) {
+	if _, _, err := Convert(0, 0, "ED50", WGS84); err == nil {
+		t.Error("Convert with unknown datum expected error, got nil")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// One degree of latitude
+	if d := Distance(52, 4, 53, 4); !near(d, 111195, 1) {
+		t.Errorf("Distance = %v, want 111195", d)
+	}
+	if d := Distance(wgsLat, wgsLng, wgsLat, wgsLng); d != 0 {
+		t.Errorf("Distance to itself = %v, want 0", d)
+	}
+}
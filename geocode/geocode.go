@@ -0,0 +1,256 @@
+// Package geocode provides an offline reverse geocoder backed by a local
+// GeoNames-style place dataset.
+//
+// Datasets can be downloaded from https://download.geonames.org/export/dump/.
+// The cities files give town-level addresses; country files that include
+// roads (feature class R) give street-level results.
+package geocode
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// earthRadius is the mean radius of the earth in metres.
+const earthRadius = 6371008.8
+
+// ErrNoPlace is returned when no place lies within the geocoder's maximum
+// distance of a coordinate.
+var ErrNoPlace = errors.New("geocode: no place found")
+
+// Place is a named location from the dataset.
+type Place struct {
+	ID          string
+	Name        string
+	Lat         float64
+	Lng         float64
+	FeatureCode string
+	CountryCode string
+	Admin1Code  string
+}
+
+// String returns the place formatted as an address.
+func (p *Place) String() string {
+	if p.CountryCode == "" {
+		return p.Name
+	}
+	return p.Name + ", " + p.CountryCode
+}
+
+// Offline is a reverse geocoder that answers lookups from an in-memory
+// k-d tree of places. It is safe for concurrent use.
+type Offline struct {
+	root *node
+
+	// MaxDistance is the distance in metres beyond which a place is not
+	// considered a match. Zero means no limit.
+	MaxDistance float64
+}
+
+// LoadGeoNamesFile loads a GeoNames TSV file. See LoadGeoNames.
+func LoadGeoNamesFile(path string) (*Offline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadGeoNames(f)
+}
+
+// LoadGeoNames reads places from a tab-separated file in the GeoNames
+// dump format: id, name, ascii name, alternate names, latitude, longitude,
+// feature class, feature code, country code, cc2 and admin1 code. Only the
+// first six columns are required. Empty lines and lines starting with # are
+// skipped.
+func LoadGeoNames(r io.Reader) (*Offline, error) {
+	var places []*Place
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("geocode: line %d: expected at least 6 columns, got %d", line, len(fields))
+		}
+
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("geocode: line %d: invalid latitude: %w", line, err)
+		}
+		lng, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("geocode: line %d: invalid longitude: %w", line, err)
+		}
+
+		place := &Place{ID: fields[0], Name: fields[1], Lat: lat, Lng: lng}
+		if len(fields) > 7 {
+			place.FeatureCode = fields[7]
+		}
+		if len(fields) > 8 {
+			place.CountryCode = fields[8]
+		}
+		if len(fields) > 10 {
+			place.Admin1Code = fields[10]
+		}
+		places = append(places, place)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return New(places), nil
+}
+
+// New returns a geocoder for the given places.
+func New(places []*Place) *Offline {
+	points := make([]point, len(places))
+	for i, place := range places {
+		points[i] = point{xyz: toXYZ(place.Lat, place.Lng), place: place}
+	}
+	return &Offline{root: build(points, 0)}
+}
+
+// Nearest returns the place closest to a coordinate and its distance in
+// metres. It returns nil if the dataset is empty.
+func (o *Offline) Nearest(lat, lng float64) (*Place, float64) {
+	if o.root == nil {
+		return nil, 0
+	}
+
+	target := toXYZ(lat, lng)
+	best, bestDist := o.root.nearest(target, nil, math.Inf(1))
+
+	// Convert the chord length on the unit sphere to a great-circle distance
+	chord := math.Sqrt(bestDist)
+	return best.place, 2 * math.Asin(math.Min(chord/2, 1)) * earthRadius
+}
+
+// ReverseGeocode returns the address of the place closest to a WGS-84
+// coordinate. It returns ErrNoPlace if that place is further away than
+// MaxDistance.
+func (o *Offline) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	place, dist := o.Nearest(lat, lng)
+	if place == nil || (o.MaxDistance > 0 && dist > o.MaxDistance) {
+		return "", ErrNoPlace
+	}
+	return place.String(), nil
+}
+
+// point is a place projected onto the unit sphere. Straight-line distance
+// between such points grows monotonically with great-circle distance, so
+// the k-d tree can use plain Euclidean geometry without special cases at
+// the poles or the antimeridian.
+type point struct {
+	xyz   [3]float64
+	place *Place
+}
+
+type node struct {
+	point
+	axis        int
+	left, right *node
+}
+
+func toXYZ(lat, lng float64) [3]float64 {
+	phi := lat * math.Pi / 180
+	lambda := lng * math.Pi / 180
+	return [3]float64{
+		math.Cos(phi) * math.Cos(lambda),
+		math.Cos(phi) * math.Sin(lambda),
+		math.Sin(phi),
+	}
+}
+
+func distSq(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+// build constructs a balanced k-d tree, splitting on the median of each
+// axis in turn.
+func build(points []point, depth int) *node {
+	if len(points) == 0 {
+		return nil
+	}
+
+	axis := depth % 3
+	mid := len(points) / 2
+	selectNth(points, mid, axis)
+
+	return &node{
+		point: points[mid],
+		axis:  axis,
+		left:  build(points[:mid], depth+1),
+		right: build(points[mid+1:], depth+1),
+	}
+}
+
+// selectNth partially sorts points so that the element at index n is the
+// one that would be there if points were sorted on axis, with smaller
+// elements before it and larger ones after.
+func selectNth(points []point, n, axis int) {
+	lo, hi := 0, len(points)-1
+	for lo < hi {
+		pivot := points[(lo+hi)/2].xyz[axis]
+		i, j := lo, hi
+		for i <= j {
+			for points[i].xyz[axis] < pivot {
+				i++
+			}
+			for points[j].xyz[axis] > pivot {
+				j--
+			}
+			if i <= j {
+				points[i], points[j] = points[j], points[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case n <= j:
+			hi = j
+		case n >= i:
+			lo = i
+		default:
+			return
+		}
+	}
+}
+
+// nearest returns the point closest to target in the subtree and its squared
+// distance, given the best candidate found so far.
+func (n *node) nearest(target [3]float64, best *node, bestDist float64) (*node, float64) {
+	if n == nil {
+		return best, bestDist
+	}
+
+	if d := distSq(n.xyz, target); d < bestDist {
+		best, bestDist = n, d
+	}
+
+	diff := target[n.axis] - n.xyz[n.axis]
+	near, far := n.left, n.right
+	if diff > 0 {
+		near, far = n.right, n.left
+	}
+
+	best, bestDist = near.nearest(target, best, bestDist)
+	if diff*diff < bestDist {
+		best, bestDist = far.nearest(target, best, bestDist)
+	}
+
+	return best, bestDist
+}
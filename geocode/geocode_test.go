@@ -0,0 +1,115 @@
+package geocode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const dataset = `# geonameid	name	asciiname	alternatenames	latitude	longitude	feature class	feature code	country code	cc2	admin1 code
+2759794	Amsterdam	Amsterdam		52.37403	4.88969	P	PPLC	NL		07
+2747891	Rotterdam	Rotterdam		51.9225	4.47917	P	PPLA2	NL		11
+2745912	Utrecht	Utrecht		52.09083	5.12222	P	PPLA	NL		09
+2988507	Paris	Paris		48.85341	2.3488	P	PPLC	FR		11
+
+4164138	Miami	Miami		25.77427	-80.19366	P	PPLA2	US		FL
+2193733	Auckland	Auckland		-36.84853	174.76349	P	PPLA	NZ		E7
+4032402	Nuku'alofa	Nuku'alofa		-21.13938	-175.2018	P	PPLC	TO		02
+`
+
+func TestLoadGeoNames(t *testing.T) {
+	g, err := LoadGeoNames(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatalf("LoadGeoNames returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		lat, lng float64
+		want     string
+	}{
+		{52.3600, 4.8852, "Amsterdam, NL"},
+		{51.9000, 4.5000, "Rotterdam, NL"},
+		{48.8000, 2.4000, "Paris, FR"},
+		// Across the antimeridian from Nuku'alofa
+		{-21.0, 179.9, "Nuku'alofa, TO"},
+	}
+
+	for _, tt := range tests {
+		got, err := g.ReverseGeocode(context.Background(), tt.lat, tt.lng)
+		if err != nil {
+			t.Errorf("ReverseGeocode(%v, %v) returned unexpected error: %v", tt.lat, tt.lng, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ReverseGeocode(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+		}
+	}
+}
+
+func TestLoadGeoNames_Invalid(t *testing.T) {
+	_, err := LoadGeoNames(strings.NewReader("1\tNowhere\tNowhere\t\tnorth\t4.0\n"))
+	if err == nil {
+		t.Error("LoadGeoNames with invalid latitude expected error, got nil")
+	}
+}
+
+func TestOffline_MaxDistance(t *testing.T) {
+	g, _ := LoadGeoNames(strings.NewReader(dataset))
+	g.MaxDistance = 10000
+
+	place, dist := g.Nearest(52.0, 5.0)
+	if place.Name != "Utrecht" {
+		t.Errorf("Nearest = %v, want %v", place.Name, "Utrecht")
+	}
+	if dist < 12500 || dist > 13500 {
+		t.Errorf("Nearest distance = %v, want about 13km", dist)
+	}
+
+	if _, err := g.ReverseGeocode(context.Background(), 52.0, 5.0); err != ErrNoPlace {
+		t.Errorf("ReverseGeocode error = %v, want %v", err, ErrNoPlace)
+	}
+}
+
+func TestOffline_Nearest_MatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	places := make([]*Place, 2000)
+	for i := range places {
+		places[i] = &Place{
+			Name: fmt.Sprintf("place-%d", i),
+			Lat:  rng.Float64()*180 - 90,
+			Lng:  rng.Float64()*360 - 180,
+		}
+	}
+	g := New(places)
+
+	for i := 0; i < 200; i++ {
+		lat, lng := rng.Float64()*180-90, rng.Float64()*360-180
+
+		want, wantDist := places[0], math.Inf(1)
+		for _, p := range places {
+			if d := haversine(lat, lng, p.Lat, p.Lng); d < wantDist {
+				want, wantDist = p, d
+			}
+		}
+
+		got, gotDist := g.Nearest(lat, lng)
+		if got != want {
+			t.Fatalf("Nearest(%v, %v) = %v, want %v", lat, lng, got.Name, want.Name)
+		}
+		if math.Abs(gotDist-wantDist) > 1 {
+			t.Errorf("Nearest(%v, %v) distance = %v, want %v", lat, lng, gotDist, wantDist)
+		}
+	}
+}
+
+func haversine(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,56 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+// ReverseGeocoder looks up a human-readable address for a WGS-84
+// coordinate. The geocode package provides an offline implementation.
+type ReverseGeocoder interface {
+	ReverseGeocode(ctx context.Context, lat, lng float64) (string, error)
+}
+
+// WithReverseGeocoder returns a ClientOption that fills the Address field
+// of all returned positions using the given geocoder.
+func WithReverseGeocoder(geocoder ReverseGeocoder) ClientOption {
+	return func(c *Client) error {
+		c.geocoder = geocoder
+		return nil
+	}
+}
+
+// FillAddresses sets the Address field of positions that do not have one
+// yet, using the geocoder configured with WithReverseGeocoder. Positions the
+// geocoder cannot resolve are left without an address; only context errors
+// are returned.
+func (c *Client) FillAddresses(ctx context.Context, positions []*Position) error {
+	if c.geocoder == nil {
+		return nil
+	}
+
+	for _, p := range positions {
+		if p.Address != "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Geocoders expect WGS-84 coordinates
+		lat, lng, err := geo.Convert(p.Lat, p.Lng, p.Datum, geo.WGS84)
+		if err != nil {
+			continue
+		}
+
+		address, err := c.geocoder.ReverseGeocode(ctx, lat, lng)
+		if err != nil {
+			continue
+		}
+		p.Address = address
+	}
+
+	return nil
+}
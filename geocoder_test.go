@@ -0,0 +1,75 @@
+package onntrackclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+func TestWithReverseGeocoder(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": true, "code": 0, "data": [
+			{"deviceId": "device-1", "lat": 52.3676, "lng": 4.9041},
+			{"deviceId": "device-2", "lat": 0, "lng": 0}
+		]}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	geocoder := geocoderFunc(func(ctx context.Context, lat, lng float64) (string, error) {
+		if lat == 52.3676 && lng == 4.9041 {
+			return "Amsterdam, NL", nil
+		}
+		return "", errors.New("not found")
+	})
+	client, _ := NewClient(WithBaseURL(server.URL), WithReverseGeocoder(geocoder))
+
+	positions, _, err := client.Positions.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest returned unexpected error: %v", err)
+	}
+
+	if positions[0].Address != "Amsterdam, NL" {
+		t.Errorf("Position Address = %v, want %v", positions[0].Address, "Amsterdam, NL")
+	}
+	if positions[1].Address != "" {
+		t.Errorf("Position Address = %v, want empty", positions[1].Address)
+	}
+}
+
+func TestClient_FillAddresses_ConvertsToWGS84(t *testing.T) {
+	lat, lng := geo.WGS84ToGCJ02(39.90734, 116.39118)
+	positions := []*Position{{Lat: lat, Lng: lng, Datum: geo.GCJ02}}
+
+	var gotLat, gotLng float64
+	geocoder := geocoderFunc(func(ctx context.Context, lat, lng float64) (string, error) {
+		gotLat, gotLng = lat, lng
+		return "Beijing, CN", nil
+	})
+	client, _ := NewClient(WithReverseGeocoder(geocoder))
+
+	if err := client.FillAddresses(context.Background(), positions); err != nil {
+		t.Fatalf("FillAddresses returned unexpected error: %v", err)
+	}
+
+	if math.Abs(gotLat-39.90734) > 1e-8 || math.Abs(gotLng-116.39118) > 1e-8 {
+		t.Errorf("FillAddresses looked up %v, %v, want %v, %v", gotLat, gotLng, 39.90734, 116.39118)
+	}
+	if positions[0].Address != "Beijing, CN" {
+		t.Errorf("Position Address = %v, want %v", positions[0].Address, "Beijing, CN")
+	}
+}
+
+type geocoderFunc func(ctx context.Context, lat, lng float64) (string, error)
+
+func (f geocoderFunc) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	return f(ctx, lat, lng)
+}
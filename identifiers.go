@@ -0,0 +1,172 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError reports an invalid field in a request. It is returned
+// before the request is sent.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// ValidateIMEI checks that imei is 15 digits with a valid Luhn check digit.
+func ValidateIMEI(imei string) error {
+	if len(imei) != 15 || !isDigits(imei) {
+		return &ValidationError{Field: "imei", Value: imei, Reason: "must be 15 digits"}
+	}
+	if !luhnValid(imei) {
+		return &ValidationError{Field: "imei", Value: imei, Reason: "check digit does not match"}
+	}
+	return nil
+}
+
+// TAC returns the Type Allocation Code of an IMEI: its first 8 digits,
+// which identify the device model.
+func TAC(imei string) (string, error) {
+	if err := ValidateIMEI(imei); err != nil {
+		return "", err
+	}
+	return imei[:8], nil
+}
+
+// NormalizeICCID returns a SIM card's ICCID without spaces, dashes and the
+// padding F some modems append. ICCIDs are 18 to 22 digits and start with
+// the telecom industry prefix 89.
+func NormalizeICCID(iccid string) (string, error) {
+	normalized := strings.TrimRight(stripSeparators(iccid), "Ff")
+
+	if len(normalized) < 18 || len(normalized) > 22 || !isDigits(normalized) {
+		return "", &ValidationError{Field: "iccid", Value: iccid, Reason: "must be 18 to 22 digits"}
+	}
+	if !strings.HasPrefix(normalized, "89") {
+		return "", &ValidationError{Field: "iccid", Value: iccid, Reason: "must start with 89"}
+	}
+	return normalized, nil
+}
+
+// NormalizeMSISDN returns a SIM card's phone number without spaces, dashes,
+// dots and parentheses. Numbers in international format, starting with +
+// or 00, are returned in E.164 format with a leading +; other numbers are
+// returned as digits only.
+func NormalizeMSISDN(msisdn string) (string, error) {
+	normalized := stripSeparators(msisdn)
+
+	international := false
+	switch {
+	case strings.HasPrefix(normalized, "+"):
+		normalized, international = normalized[1:], true
+	case strings.HasPrefix(normalized, "00"):
+		normalized, international = normalized[2:], true
+	}
+
+	if !isDigits(normalized) {
+		return "", &ValidationError{Field: "sim", Value: msisdn, Reason: "must be a phone number"}
+	}
+	if len(normalized) < 6 || len(normalized) > 15 {
+		return "", &ValidationError{Field: "sim", Value: msisdn, Reason: "must be 6 to 15 digits"}
+	}
+
+	if international {
+		return "+" + normalized, nil
+	}
+	return normalized, nil
+}
+
+// validate checks the identifiers in a create request and returns a copy
+// with them normalised.
+func (r *DeviceCreateRequest) validate() (*DeviceCreateRequest, error) {
+	if r == nil {
+		return nil, &ValidationError{Field: "request", Reason: "must not be nil"}
+	}
+	normalized := *r
+
+	normalized.IMEI = strings.TrimSpace(r.IMEI)
+	if err := ValidateIMEI(normalized.IMEI); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.SIM != "" {
+		if normalized.SIM, err = NormalizeMSISDN(r.SIM); err != nil {
+			return nil, err
+		}
+	}
+	if r.ICCID != "" {
+		if normalized.ICCID, err = NormalizeICCID(r.ICCID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &normalized, nil
+}
+
+// validate checks the identifiers in an update request and returns a copy
+// with them normalised.
+func (r *DeviceUpdateRequest) validate() (*DeviceUpdateRequest, error) {
+	if r == nil {
+		return nil, &ValidationError{Field: "request", Reason: "must not be nil"}
+	}
+	normalized := *r
+
+	var err error
+	if r.SIM != "" {
+		if normalized.SIM, err = NormalizeMSISDN(r.SIM); err != nil {
+			return nil, err
+		}
+	}
+	if r.ICCID != "" {
+		if normalized.ICCID, err = NormalizeICCID(r.ICCID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &normalized, nil
+}
+
+func stripSeparators(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// luhnValid reports whether the last digit of s is the Luhn check digit of
+// the digits before it.
+func luhnValid(s string) bool {
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := int(s[len(s)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
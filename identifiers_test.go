@@ -0,0 +1,179 @@
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateIMEI(t *testing.T) {
+	tests := []struct {
+		in     string
+		reason string
+	}{
+		{"490154203237518", ""},
+		{"352099001761481", ""},
+		{"490154203237519", "check digit does not match"},
+		{"49015420323751", "must be 15 digits"},
+		{"49015420323751A", "must be 15 digits"},
+		{"", "must be 15 digits"},
+	}
+
+	for _, tt := range tests {
+		err := ValidateIMEI(tt.in)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("ValidateIMEI(%q) returned unexpected error: %v", tt.in, err)
+			}
+			continue
+		}
+
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("ValidateIMEI(%q) error = %v, want a *ValidationError", tt.in, err)
+			continue
+		}
+		if verr.Field != "imei" || verr.Value != tt.in || verr.Reason != tt.reason {
+			t.Errorf("ValidateIMEI(%q) error = %+v, want reason %q", tt.in, verr, tt.reason)
+		}
+	}
+}
+
+func TestTAC(t *testing.T) {
+	tac, err := TAC("490154203237518")
+	if err != nil {
+		t.Fatalf("TAC returned unexpected error: %v", err)
+	}
+	if tac != "49015420" {
+		t.Errorf("TAC = %v, want %v", tac, "49015420")
+	}
+
+	if _, err := TAC("12345"); err == nil {
+		t.Error("TAC of an invalid IMEI expected error, got nil")
+	}
+}
+
+func TestNormalizeICCID(t *testing.T) {
+	tests := []struct {
+		in, want string
+		valid    bool
+	}{
+		{"8931 0800 0000 1234 567", "8931080000001234567", true},
+		{"89-31-08-00000012345678", "89310800000012345678", true},
+		{"8931080000001234567F", "8931080000001234567", true},
+		{"1234567890123456789", "", false},
+		{"89310800", "", false},
+		{"8931080000001234X67", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeICCID(tt.in)
+		if tt.valid != (err == nil) {
+			t.Errorf("NormalizeICCID(%q) error = %v, want valid %v", tt.in, err, tt.valid)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeICCID(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMSISDN(t *testing.T) {
+	tests := []struct {
+		in, want string
+		valid    bool
+	}{
+		{"+31 6 1234 5678", "+31612345678", true},
+		{"0031-6-12345678", "+31612345678", true},
+		{"(06) 1234.5678", "0612345678", true},
+		{"+31 6 CALL ME", "", false},
+		{"12345", "", false},
+		{"+1234567890123456", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeMSISDN(tt.in)
+		if tt.valid != (err == nil) {
+			t.Errorf("NormalizeMSISDN(%q) error = %v, want valid %v", tt.in, err, tt.valid)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeMSISDN(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDevicesService_Create_Validation(t *testing.T) {
+	var body map[string]string
+	requests := 0
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": Device{ID: "device-1", IMEI: body["imei"], SIM: body["sim"]}})
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	// An invalid IMEI is rejected before anything is sent
+	_, _, err := client.Devices.Create(context.Background(), &DeviceCreateRequest{IMEI: "490154203237519"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Field != "imei" {
+		t.Errorf("Create error = %v, want an imei *ValidationError", err)
+	}
+	if requests != 0 {
+		t.Errorf("Create sent %d requests for an invalid IMEI, want none", requests)
+	}
+
+	// Valid identifiers are normalised without changing the caller's request
+	req := &DeviceCreateRequest{IMEI: "490154203237518", SIM: "+31 6 1234 5678", ICCID: "8931 0800 0000 1234 567"}
+	if _, _, err := client.Devices.Create(context.Background(), req); err != nil {
+		t.Fatalf("Create returned unexpected error: %v", err)
+	}
+	if body["sim"] != "+31612345678" || body["iccid"] != "8931080000001234567" {
+		t.Errorf("Create sent sim %q and iccid %q, want normalised values", body["sim"], body["iccid"])
+	}
+	if req.SIM != "+31 6 1234 5678" {
+		t.Errorf("Create changed the request SIM to %q", req.SIM)
+	}
+
+	// Surrounding spaces are trimmed from the IMEI
+	if _, _, err := client.Devices.Create(context.Background(), &DeviceCreateRequest{IMEI: " 490154203237518\n"}); err != nil {
+		t.Fatalf("Create returned unexpected error: %v", err)
+	}
+	if body["imei"] != "490154203237518" {
+		t.Errorf("Create sent imei %q, want it trimmed", body["imei"])
+	}
+
+	// Nil requests are rejected instead of sent as null
+	requests = 0
+	_, _, err = client.Devices.Create(context.Background(), nil)
+	if !errors.As(err, &verr) || verr.Field != "request" {
+		t.Errorf("Create with a nil request error = %v, want a request *ValidationError", err)
+	}
+	_, _, err = client.Devices.Update(context.Background(), "device-1", nil)
+	if !errors.As(err, &verr) || verr.Field != "request" {
+		t.Errorf("Update with a nil request error = %v, want a request *ValidationError", err)
+	}
+	if requests != 0 {
+		t.Errorf("nil requests sent %d requests, want none", requests)
+	}
+
+	// Updates check the SIM number too
+	requests = 0
+	_, _, err = client.Devices.Update(context.Background(), "device-1", &DeviceUpdateRequest{SIM: "call me"})
+	if !errors.As(err, &verr) || verr.Field != "sim" {
+		t.Errorf("Update error = %v, want a sim *ValidationError", err)
+	}
+	if requests != 0 {
+		t.Errorf("Update sent %d requests for an invalid SIM, want none", requests)
+	}
+}
@@ -0,0 +1,298 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DeviceRow is one device in a bulk import file.
+type DeviceRow struct {
+	// Line is the line or element number in the file, for reporting.
+	Line int `json:"-"`
+
+	IMEI  string `json:"imei"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Group string `json:"group"`
+	SIM   string `json:"sim"`
+}
+
+// ReadDeviceRows reads devices from a CSV or JSON file. format is "csv" or
+// "json".
+//
+// CSV files need a header row naming the columns imei, name, type, group and
+// sim, in any order; only imei is required. JSON files hold an array of
+// objects with the same keys.
+func ReadDeviceRows(r io.Reader, format string) ([]*DeviceRow, error) {
+	switch format {
+	case "csv":
+		return readDeviceRowsCSV(r)
+	case "json":
+		return readDeviceRowsJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+}
+
+func readDeviceRowsCSV(r io.Reader) ([]*DeviceRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "sim_number" {
+			name = "sim"
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["imei"]; !ok {
+		return nil, errors.New("header has no imei column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []*DeviceRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, &DeviceRow{
+			Line:  line,
+			IMEI:  field(record, "imei"),
+			Name:  field(record, "name"),
+			Type:  field(record, "type"),
+			Group: field(record, "group"),
+			SIM:   field(record, "sim"),
+		})
+	}
+
+	return rows, nil
+}
+
+func readDeviceRowsJSON(r io.Reader) ([]*DeviceRow, error) {
+	var rows []*DeviceRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		row.Line = i + 1
+	}
+
+	return rows, nil
+}
+
+// ImportAction is what an import does with a row.
+type ImportAction string
+
+const (
+	// ImportCreate creates a device that does not exist yet.
+	ImportCreate ImportAction = "create"
+
+	// ImportUpdate updates a device whose fields differ from the row.
+	ImportUpdate ImportAction = "update"
+
+	// ImportUnchanged skips a device that already matches the row.
+	ImportUnchanged ImportAction = "unchanged"
+
+	// ImportInvalid skips a row that failed validation.
+	ImportInvalid ImportAction = "invalid"
+)
+
+// ImportOptions specifies the optional parameters to the
+// DevicesService.Import method.
+type ImportOptions struct {
+	// Concurrency is the number of requests sent at the same time.
+	// Defaults to 4.
+	Concurrency int
+
+	// DryRun only works out what would be done, without sending any
+	// create or update requests.
+	DryRun bool
+}
+
+// ImportResult reports what happened to one row.
+type ImportResult struct {
+	Row    *DeviceRow
+	Action ImportAction
+
+	// Device is the existing device for updates and unchanged rows, and
+	// the created or updated device after a successful request.
+	Device *Device
+
+	// Err is set for invalid rows and failed requests.
+	Err error
+}
+
+// Import creates and updates devices in bulk. Rows are matched to existing
+// devices by IMEI: unknown IMEIs are created, devices whose name, type,
+// group or SIM differ are updated and the rest are left alone. Invalid rows
+// are reported and skipped.
+//
+// The result has one entry per row, in the same order. The returned error
+// is only set if the existing devices could not be listed; errors for
+// individual rows are reported in their results.
+func (s *DevicesService) Import(ctx context.Context, rows []*DeviceRow, opts *ImportOptions) ([]*ImportResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	existing, _, err := s.ListAll(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing devices: %w", err)
+	}
+	byIMEI := make(map[string]*Device, len(existing))
+	for _, d := range existing {
+		byIMEI[d.IMEI] = d
+	}
+
+	results := planImport(rows, byIMEI)
+	if opts.DryRun {
+		return results, nil
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, result := range results {
+		if result.Action != ImportCreate && result.Action != ImportUpdate {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *ImportResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.applyImport(ctx, result)
+		}(result)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// planImport works out the action for every row.
+func planImport(rows []*DeviceRow, byIMEI map[string]*Device) []*ImportResult {
+	results := make([]*ImportResult, len(rows))
+	seen := make(map[string]int, len(rows))
+
+	for i, row := range rows {
+		result := &ImportResult{Row: row}
+		results[i] = result
+
+		if err := validateDeviceRow(row); err != nil {
+			result.Action, result.Err = ImportInvalid, err
+			continue
+		}
+		if line, ok := seen[row.IMEI]; ok {
+			result.Action, result.Err = ImportInvalid, fmt.Errorf("duplicate of line %d", line)
+			continue
+		}
+		seen[row.IMEI] = row.Line
+
+		device, ok := byIMEI[row.IMEI]
+		switch {
+		case !ok:
+			result.Action = ImportCreate
+		case rowChanges(row, device):
+			result.Action, result.Device = ImportUpdate, device
+		default:
+			result.Action, result.Device = ImportUnchanged, device
+		}
+	}
+
+	return results
+}
+
+// validateDeviceRow checks a row before anything is sent and normalises its
+// SIM number, so it compares equal to the number stored by the platform.
+func validateDeviceRow(row *DeviceRow) error {
+	if err := ValidateIMEI(row.IMEI); err != nil {
+		return err
+	}
+	if row.SIM != "" {
+		sim, err := NormalizeMSISDN(row.SIM)
+		if err != nil {
+			return err
+		}
+		row.SIM = sim
+	}
+	return nil
+}
+
+// rowChanges reports whether importing row would change device. Empty
+// fields in the row leave the device's value alone. SIM numbers are
+// compared normalised, since the platform may store them as entered.
+func rowChanges(row *DeviceRow, device *Device) bool {
+	differs := func(want, have string) bool {
+		return want != "" && want != have
+	}
+	sim := device.SIM
+	if normalized, err := NormalizeMSISDN(sim); err == nil {
+		sim = normalized
+	}
+	return differs(row.Name, device.Name) ||
+		differs(row.Type, device.Type) ||
+		differs(row.Group, device.Group) ||
+		differs(row.SIM, sim)
+}
+
+func (s *DevicesService) applyImport(ctx context.Context, result *ImportResult) {
+	row := result.Row
+
+	var device *Device
+	var err error
+	switch result.Action {
+	case ImportCreate:
+		device, _, err = s.Create(ctx, &DeviceCreateRequest{
+			Name:  row.Name,
+			Type:  row.Type,
+			IMEI:  row.IMEI,
+			Group: row.Group,
+			SIM:   row.SIM,
+		})
+	case ImportUpdate:
+		device, _, err = s.Update(ctx, result.Device.ID, &DeviceUpdateRequest{
+			Name:  row.Name,
+			Type:  row.Type,
+			Group: row.Group,
+			SIM:   row.SIM,
+		})
+	default:
+		return
+	}
+
+	if err != nil {
+		result.Err = err
+		return
+	}
+	result.Device = device
+}
@@ -0,0 +1,191 @@
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadDeviceRows_CSV(t *testing.T) {
+	in := "IMEI, Name, Group, SIM_Number\n" +
+		"490154203237518, Van 1, Delivery, +31612345678\n" +
+		"352099001761481, Van 2,,\n"
+
+	rows, err := ReadDeviceRows(strings.NewReader(in), "csv")
+	if err != nil {
+		t.Fatalf("ReadDeviceRows returned unexpected error: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("ReadDeviceRows returned %d rows, want 2", len(rows))
+	}
+	want := DeviceRow{Line: 2, IMEI: "490154203237518", Name: "Van 1", Group: "Delivery", SIM: "+31612345678"}
+	if *rows[0] != want {
+		t.Errorf("ReadDeviceRows row = %+v, want %+v", *rows[0], want)
+	}
+	if rows[1].Line != 3 || rows[1].Name != "Van 2" {
+		t.Errorf("ReadDeviceRows row = %+v, want Van 2 on line 3", *rows[1])
+	}
+
+	if _, err := ReadDeviceRows(strings.NewReader("name\nVan 1\n"), "csv"); err == nil {
+		t.Error("ReadDeviceRows without imei column expected error, got nil")
+	}
+}
+
+func TestReadDeviceRows_JSON(t *testing.T) {
+	in := `[{"imei": "490154203237518", "name": "Van 1", "type": "GT06"}]`
+
+	rows, err := ReadDeviceRows(strings.NewReader(in), "json")
+	if err != nil {
+		t.Fatalf("ReadDeviceRows returned unexpected error: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].Line != 1 || rows[0].Type != "GT06" {
+		t.Errorf("ReadDeviceRows = %+v, want one GT06 row", rows)
+	}
+}
+
+func TestDevicesService_Import(t *testing.T) {
+	var mu sync.Mutex
+	var created, updated []string
+	var inFlight, maxInFlight int32
+
+	// Create a test server with two existing devices
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"ok": true, "data": [
+				{"id": "device-1", "name": "Van 1", "imei": "490154203237518", "group": "Delivery"},
+				{"id": "device-2", "name": "Van 2", "imei": "352099001761481"}
+			]}`))
+			return
+		}
+
+		// Track how many writes run at once
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			created = append(created, body["imei"])
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": Device{ID: "new-" + body["imei"], IMEI: body["imei"], Name: body["name"]}})
+		case http.MethodPut:
+			updated = append(updated, r.URL.Path)
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": Device{ID: strings.TrimPrefix(r.URL.Path, "/devices/"), Name: body["name"]}})
+		}
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	rows := []*DeviceRow{
+		{Line: 2, IMEI: "490154203237518", Name: "Van 1", Group: "Delivery"},
+		{Line: 3, IMEI: "352099001761481", Name: "Van 2 renamed"},
+		{Line: 4, IMEI: "356938035643809", Name: "Van 3"},
+		{Line: 5, IMEI: "867230041234563", Name: "Van 4"},
+		{Line: 6, IMEI: "867230041234571", Name: "Van 5"},
+		{Line: 7, IMEI: "12345", Name: "Typo"},
+		{Line: 8, IMEI: "356938035643809", Name: "Van 3 again"},
+	}
+
+	// A dry run sends nothing
+	results, err := client.Devices.Import(context.Background(), rows, &ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Import returned unexpected error: %v", err)
+	}
+	if len(created) != 0 || len(updated) != 0 {
+		t.Errorf("dry run sent %d creates and %d updates, want none", len(created), len(updated))
+	}
+
+	wantActions := []ImportAction{ImportUnchanged, ImportUpdate, ImportCreate, ImportCreate, ImportCreate, ImportInvalid, ImportInvalid}
+	for i, result := range results {
+		if result.Action != wantActions[i] {
+			t.Errorf("row %d action = %v, want %v", result.Row.Line, result.Action, wantActions[i])
+		}
+	}
+
+	results, err = client.Devices.Import(context.Background(), rows, &ImportOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Import returned unexpected error: %v", err)
+	}
+
+	if len(created) != 3 || len(updated) != 1 || updated[0] != "/devices/device-2" {
+		t.Errorf("Import created %v and updated %v, want 3 creates and device-2 updated", created, updated)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("Import sent %d requests at once, want at most 2", maxInFlight)
+	}
+	if results[2].Device == nil || results[2].Device.ID != "new-356938035643809" {
+		t.Errorf("created device = %+v, want new-356938035643809", results[2].Device)
+	}
+	if results[5].Err == nil || results[6].Err == nil {
+		t.Errorf("invalid rows have no error: %v, %v", results[5].Err, results[6].Err)
+	}
+}
+
+func TestDevicesService_Import_Pages(t *testing.T) {
+	// 150 existing devices over two pages; the imported one is on the second
+	existing := make([]*Device, 150)
+	for i := range existing {
+		existing[i] = &Device{ID: fmt.Sprintf("device-%d", i+1), IMEI: fmt.Sprintf("35000000000%04d", i)}
+	}
+	existing[120].IMEI, existing[120].Name = "490154203237518", "Van 1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		start := min((page-1)*size, len(existing))
+		end := min(start+size, len(existing))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": existing[start:end]})
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	rows := []*DeviceRow{{Line: 2, IMEI: "490154203237518", Name: "Van 1"}}
+	results, err := client.Devices.Import(context.Background(), rows, &ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Import returned unexpected error: %v", err)
+	}
+	if results[0].Action != ImportUnchanged || results[0].Device.ID != "device-121" {
+		t.Errorf("result = %+v, want device-121 unchanged", results[0])
+	}
+}
+
+func TestPlanImport_SIM(t *testing.T) {
+	// The platform stored the number as entered; the row has it in another format
+	byIMEI := map[string]*Device{
+		"490154203237518": {ID: "device-1", IMEI: "490154203237518", SIM: "+31 6 1234 5678"},
+	}
+	rows := []*DeviceRow{{Line: 2, IMEI: "490154203237518", SIM: "0031-612345678"}}
+
+	results := planImport(rows, byIMEI)
+	if results[0].Action != ImportUnchanged {
+		t.Errorf("action = %v, want %v", results[0].Action, ImportUnchanged)
+	}
+}
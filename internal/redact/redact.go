@@ -0,0 +1,143 @@
+// Package redact removes secrets from HTTP headers and JSON bodies before
+// they are logged or stored.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Placeholder replaces redacted values.
+const Placeholder = "REDACTED"
+
+// Headers are the headers that carry secrets in traffic with the platform.
+var Headers = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Keys are the JSON keys that carry secrets in traffic with the platform:
+// the password of a login request and the token of its response.
+var Keys = []string{"password", "token"}
+
+// Header returns a copy of h with the values of the named headers replaced
+// by Placeholder.
+func Header(h http.Header, names []string) http.Header {
+	h = h.Clone()
+	for _, name := range names {
+		if values := h.Values(name); len(values) > 0 {
+			h.Set(name, Placeholder)
+		}
+	}
+	return h
+}
+
+// JSON returns body with the values of keys replaced by Placeholder,
+// wherever they occur in the document. Keys match case-insensitively.
+// A body that is not JSON or holds none of the keys is returned unchanged.
+func JSON(body []byte, keys []string) []byte {
+	if len(keys) == 0 {
+		return body
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return body
+	}
+	if !redact(v, keys) {
+		return body
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// JSONPrefix is JSON for the start of a document that was cut off. It
+// returns body up to its last complete token, with the values of keys
+// replaced by Placeholder; a value of a key that was cut off is replaced
+// too. Unlike JSON it keeps the document as it is otherwise.
+func JSONPrefix(body []byte, keys []string) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	// objects holds whether every enclosing value is an object, innermost
+	// last, and key whether the next token in the object is a key
+	var objects []bool
+	key := false
+	var out bytes.Buffer
+	copied, end := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if key && tok != json.Delim('}') {
+			start := int(dec.InputOffset())
+			if !matches(tok.(string), keys) {
+				end, key = start, false
+				continue
+			}
+			out.Write(body[copied:start])
+			out.WriteString(`:"` + Placeholder + `"`)
+			if err := dec.Decode(new(json.RawMessage)); err != nil {
+				return out.Bytes()
+			}
+			copied = int(dec.InputOffset())
+			end = copied
+			continue
+		}
+
+		end = int(dec.InputOffset())
+		switch tok {
+		case json.Delim('{'):
+			objects = append(objects, true)
+		case json.Delim('['):
+			objects = append(objects, false)
+		case json.Delim('}'), json.Delim(']'):
+			objects = objects[:len(objects)-1]
+		}
+		key = len(objects) > 0 && objects[len(objects)-1] && tok != json.Delim('[')
+	}
+	out.Write(body[copied:end])
+	return out.Bytes()
+}
+
+// redact replaces the values of keys in v and reports whether it did.
+func redact(v any, keys []string) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			if matches(k, keys) {
+				v[k] = Placeholder
+				changed = true
+				continue
+			}
+			if redact(value, keys) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if redact(value, keys) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func matches(key string, keys []string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(key, k) {
+			return true
+		}
+	}
+	return false
+}
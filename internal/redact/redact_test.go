@@ -0,0 +1,71 @@
+package redact
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Content-Type", "application/json")
+
+	got := Header(h, Headers)
+	if v := got.Get("Authorization"); v != Placeholder {
+		t.Errorf("Authorization = %v, want %v", v, Placeholder)
+	}
+	if v := got.Get("Content-Type"); v != "application/json" {
+		t.Errorf("Content-Type = %v, want application/json", v)
+	}
+	if _, ok := got["Cookie"]; ok {
+		t.Error("Header added a Cookie header that was not set")
+	}
+	if v := h.Get("Authorization"); v != "Bearer secret" {
+		t.Errorf("Header changed the original to %v", v)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"login request", `{"account":"a@example.com","password":"hunter2"}`, `{"account":"a@example.com","password":"REDACTED"}`},
+		{"nested token", `{"ok":true,"data":{"Token":"eyJ","upgradeTips":false}}`, `{"data":{"Token":"REDACTED","upgradeTips":false},"ok":true}`},
+		{"in array", `[{"token":1.50}]`, `[{"token":"REDACTED"}]`},
+		{"no secrets", `{"b":1,  "a":2}`, `{"b":1,  "a":2}`},
+		{"not json", `password=hunter2`, `password=hunter2`},
+		{"numbers kept", `{"id":12345678901234567890,"password":"x"}`, `{"id":12345678901234567890,"password":"REDACTED"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(JSON([]byte(tt.body), Keys)); got != tt.want {
+				t.Errorf("JSON(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"login request", `{"account":"a@example.com", "password": "hunter2", "remember":tr`, `{"account":"a@example.com", "password":"REDACTED", "remember"`},
+		{"cut in secret", `{"ok":true,"data":{"token":"eyJhbGci`, `{"ok":true,"data":{"token":"REDACTED"`},
+		{"secret object", `[{"Token":{"value":"eyJ"},"id":1},{"password`, `[{"Token":"REDACTED","id":1},{`},
+		{"keys as values", `{"a":"password","b":["token","x"],"c":"y`, `{"a":"password","b":["token","x"],"c"`},
+		{"complete", `{"password":"x"}`, `{"password":"REDACTED"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(JSONPrefix([]byte(tt.body), Keys)); got != tt.want {
+				t.Errorf("JSONPrefix(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,27 +2,69 @@
 package onntrackclient
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/MaikelH/onntrackclient/internal/redact"
 )
 
+// DefaultBodyLimit is a body limit for WithBodyLogging that fits the
+// responses of most endpoints.
+const DefaultBodyLimit = 4096
+
+// envelopePeekLimit is how much of a JSON response LoggingTransport reads
+// to find the envelope code and message.
+const envelopePeekLimit = 4096
+
 // LoggingTransport is an http.RoundTripper that logs requests and responses.
+// Responses are logged with the code and message of their envelope, if any.
+// To find them and log the body only the start of a response is read, up to
+// the larger of 4 KiB and BodyLimit.
 type LoggingTransport struct {
 	Transport http.RoundTripper
 	Logger    *slog.Logger
+
+	// BodyLimit is the number of bytes of JSON request and response bodies
+	// logged at debug level. Bodies are not logged when it is zero.
+	BodyLimit int
+
+	// RedactKeys are JSON keys whose values are redacted from logged bodies,
+	// in addition to the password and token.
+	RedactKeys []string
 }
 
 // RoundTrip implements the http.RoundTripper interface.
 func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
 	start := time.Now()
+	logger := t.logger(req)
 
 	// Log the request
-	t.Logger.InfoContext(req.Context(), "API request",
+	logger.InfoContext(ctx, "API request",
 		slog.String("method", req.Method),
 		slog.String("url", req.URL.String()),
 	)
+	if t.logBodies(ctx, logger) {
+		attrs := []any{
+			slog.String("method", req.Method),
+			slog.String("url", req.URL.String()),
+			slog.Any("header", redact.Header(req.Header, redact.Headers)),
+		}
+		if body, truncated := requestBody(req, t.BodyLimit); body != nil {
+			attrs = append(attrs, slog.String("body", t.formatBody(body, truncated)))
+		}
+		logger.DebugContext(ctx, "API request body", attrs...)
+	}
 
 	// Execute the request
 	resp, err := t.Transport.RoundTrip(req)
@@ -30,9 +72,32 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	// Calculate duration
 	duration := time.Since(start)
 
+	// The start of JSON responses is read to log the platform code and
+	// message, and the body
+	logBodies := t.logBodies(ctx, logger)
+	var body []byte
+	truncated := false
+	if err == nil && isJSON(resp.Header) {
+		limit := envelopePeekLimit
+		if logBodies {
+			limit = max(limit, t.BodyLimit)
+		}
+		body, err = io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+		truncated = len(body) > limit
+		if err != nil {
+			resp.Body.Close()
+			resp = nil
+		} else {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		}
+	}
+
 	if err != nil {
 		// Log the error
-		t.Logger.ErrorContext(req.Context(), "API request failed",
+		logger.ErrorContext(ctx, "API request failed",
 			slog.String("method", req.Method),
 			slog.String("url", req.URL.String()),
 			slog.Duration("duration", duration),
@@ -42,49 +107,152 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	}
 
 	// Log the response
-	t.Logger.InfoContext(req.Context(), "API response",
+	attrs := []any{
 		slog.String("method", req.Method),
 		slog.String("url", req.URL.String()),
 		slog.Int("status", resp.StatusCode),
 		slog.Duration("duration", duration),
-	)
+	}
+	if code, msg := envelopeStatus(body); code != 0 || msg != "" {
+		attrs = append(attrs, slog.Int("code", code), slog.String("message", msg))
+	}
+	logger.InfoContext(ctx, "API response", attrs...)
+
+	if logBodies {
+		attrs := []any{
+			slog.String("method", req.Method),
+			slog.String("url", req.URL.String()),
+			slog.Any("header", redact.Header(resp.Header, redact.Headers)),
+		}
+		if body != nil {
+			attrs = append(attrs, slog.String("body", t.formatBody(body, truncated)))
+		}
+		logger.DebugContext(ctx, "API response body", attrs...)
+	}
 
 	return resp, err
 }
 
+// logger returns the logger for a request: the logger of its context, or
+// else the logger of the transport, with the ID of the request attached.
+func (t *LoggingTransport) logger(req *http.Request) *slog.Logger {
+	logger := t.Logger
+	if l, ok := req.Context().Value(loggerKey).(*slog.Logger); ok {
+		logger = l
+	}
+	if id := req.Header.Get(RequestIDHeader); id != "" {
+		logger = logger.With(slog.String("request_id", id))
+	}
+	return logger
+}
+
+// logBodies reports whether bodies are logged.
+func (t *LoggingTransport) logBodies(ctx context.Context, logger *slog.Logger) bool {
+	return t.BodyLimit > 0 && logger.Enabled(ctx, slog.LevelDebug)
+}
+
+// formatBody redacts a body and cuts it off at the body limit. A truncated
+// body is the start of a longer one.
+func (t *LoggingTransport) formatBody(body []byte, truncated bool) string {
+	keys := append(slices.Clone(redact.Keys), t.RedactKeys...)
+	if truncated {
+		size := len(body)
+		body = redact.JSONPrefix(body, keys)
+		return fmt.Sprintf("%s... (more than %d bytes)", strings.ToValidUTF8(string(body[:min(len(body), t.BodyLimit)]), ""), size-1)
+	}
+
+	body = redact.JSON(body, keys)
+	if len(body) <= t.BodyLimit {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d bytes)", strings.ToValidUTF8(string(body[:t.BodyLimit]), ""), len(body))
+}
+
+// envelopeStatus returns the code and message of a response envelope. The
+// body may be cut off; fields after the cut are missing.
+func envelopeStatus(body []byte) (code int, msg string) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0, ""
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return code, msg
+		}
+		switch key {
+		case "code":
+			err = dec.Decode(&code)
+		case "msg":
+			err = dec.Decode(&msg)
+		default:
+			err = dec.Decode(new(json.RawMessage))
+		}
+		if err != nil {
+			return code, msg
+		}
+	}
+	return code, msg
+}
+
+// requestBody returns a copy of the start of the body of a JSON request, up
+// to limit bytes, and whether the body is longer. The body is nil if the
+// request has none or it cannot be read without consuming it.
+func requestBody(req *http.Request, limit int) ([]byte, bool) {
+	if req.GetBody == nil || !isJSON(req.Header) {
+		return nil, false
+	}
+	r, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	defer r.Close()
+	body, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, false
+	}
+	return body, len(body) > limit
+}
+
+func isJSON(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
 // WithLogger returns a ClientOption that sets a logger for the client.
 func WithLogger(logger *slog.Logger) ClientOption {
 	return func(c *Client) error {
-		// Create a logging transport that wraps the existing transport
-		transport := c.HTTPClient.Transport
-		if transport == nil {
-			transport = http.DefaultTransport
-		}
+		c.SetLogger(logger)
+		return nil
+	}
+}
 
-		c.HTTPClient.Transport = &LoggingTransport{
-			Transport: transport,
-			Logger:    logger,
+// WithBodyLogging returns a ClientOption that logs request and response
+// bodies of up to limit bytes at debug level, with the Authorization header,
+// passwords, tokens and the values of redactKeys redacted. Without
+// WithLogger the default logger is used.
+func WithBodyLogging(limit int, redactKeys ...string) ClientOption {
+	return func(c *Client) error {
+		if c.logging == nil {
+			c.logging = &LoggingTransport{Logger: slog.Default()}
 		}
-
+		c.logging.BodyLimit = limit
+		c.logging.RedactKeys = redactKeys
 		return nil
 	}
 }
 
 // SetLogger sets a logger for the client.
 func (c *Client) SetLogger(logger *slog.Logger) {
-	// Create a logging transport that wraps the existing transport
-	transport := c.HTTPClient.Transport
-	if transport == nil {
-		transport = http.DefaultTransport
-	}
-
-	c.HTTPClient.Transport = &LoggingTransport{
-		Transport: transport,
-		Logger:    logger,
+	if c.logging == nil {
+		c.logging = &LoggingTransport{}
 	}
+	c.logging.Logger = logger
 }
 
-// ContextWithLogger returns a new context with the logger attached.
+// ContextWithLogger returns a new context with the logger attached. The
+// LoggingTransport of a client logs requests made with the context to it
+// instead of its own logger.
 func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
 	return context.WithValue(ctx, loggerKey, logger)
 }
@@ -97,10 +265,39 @@ func LoggerFromContext(ctx context.Context) *slog.Logger {
 	return slog.Default()
 }
 
+// RequestIDHeader is the header that carries the correlation ID of a
+// request.
+const RequestIDHeader = "X-Request-ID"
+
+// ContextWithRequestID returns a new context with a correlation ID attached.
+// Requests made with the context carry it instead of a generated ID, so
+// every request of one user action can be traced by the same ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the correlation ID attached to the context,
+// or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// newRequestID returns a random correlation ID.
+func newRequestID() string {
+	return rand.Text()
+}
+
 // contextKey is a private type for context keys.
 type contextKey int
 
 const (
 	// loggerKey is the context key for the logger.
 	loggerKey contextKey = iota
+
+	// requestIDKey is the context key for the request ID.
+	requestIDKey
+
+	// retriesKey is the context key for the retry counter of a request.
+	retriesKey
 )
@@ -0,0 +1,270 @@
+package onntrackclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+// logRecords decodes the records of a JSON log.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWithBodyLogging(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddAccount("fleet@example.com", "s3cret-pass")
+	srv.AddDevice(&onntrackclient.Device{ID: "1", Name: strings.Repeat("x", 200), SIM: "31612345678"})
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, _ := onntrackclient.NewClient(
+		onntrackclient.WithBaseURL(srv.URL),
+		onntrackclient.WithBodyLogging(128, "sim"),
+		onntrackclient.WithLogger(logger),
+	)
+
+	ctx := context.Background()
+	client.Auth.Login(ctx, &onntrackclient.LoginRequest{Account: "fleet@example.com", Password: "wrong"})
+	loginResp, _, _ := client.Auth.Login(ctx, &onntrackclient.LoginRequest{Account: "fleet@example.com", Password: "s3cret-pass"})
+	client.Devices.Get(ctx, "1")
+
+	// Secrets are redacted
+	for _, secret := range []string{"s3cret-pass", loginResp.Data.Token, "31612345678"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("log contains secret %q", secret)
+		}
+	}
+
+	records := logRecords(t, &buf)
+	var messages []string
+	for _, r := range records {
+		messages = append(messages, r["msg"].(string))
+	}
+	if got := len(records); got != 12 {
+		t.Fatalf("logged %d records, want 12: %v", got, messages)
+	}
+
+	// The envelope code of the failed login is logged with the response
+	if r := records[2]; r["msg"] != "API response" || r["code"] != float64(onntracktest.CodeBadCredentials) || r["message"] == "" {
+		t.Errorf("response record = %v, want code %d", r, onntracktest.CodeBadCredentials)
+	}
+	if r := records[1]; r["msg"] != "API request body" || !strings.Contains(r["body"].(string), `"password":"REDACTED"`) {
+		t.Errorf("request body record = %v, want a redacted password", r)
+	}
+	if r := records[5]; r["msg"] != "API request body" || r["header"].(map[string]any)["Authorization"].([]any)[0] != "REDACTED" {
+		t.Errorf("request body record = %v, want a redacted Authorization header", r)
+	}
+
+	// Bodies are cut off at the limit
+	body := records[11]["body"].(string)
+	if !strings.HasSuffix(body, "bytes)") || len(body) > 128+20 {
+		t.Errorf("response body = %q, want it cut off at 128 bytes", body)
+	}
+}
+
+func TestWithBodyLogging_InfoLevel(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	client := srv.Client(onntrackclient.WithLogger(logger), onntrackclient.WithBodyLogging(onntrackclient.DefaultBodyLimit))
+
+	client.Devices.List(context.Background(), nil)
+
+	for _, r := range logRecords(t, &buf) {
+		if _, ok := r["body"]; ok {
+			t.Errorf("record %v logs a body at info level", r)
+		}
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestLoggingTransport_LargeResponse(t *testing.T) {
+	payload := `{"ok": false, "code": 1004, "msg": "device busy", "data": "` + strings.Repeat("x", 1<<20) + `"}`
+	body := &countingReader{r: strings.NewReader(payload)}
+
+	var buf bytes.Buffer
+	transport := &onntrackclient.LoggingTransport{
+		Transport: onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{"Content-Type": []string{"application/json"}}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(body), Request: req}, nil
+		}),
+		Logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/devices", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip returned unexpected error: %v", err)
+	}
+
+	// Only the start of the body is read to log the envelope
+	if body.n > 2*onntrackclient.DefaultBodyLimit {
+		t.Errorf("RoundTrip read %d bytes of the body, want at most %d", body.n, 2*onntrackclient.DefaultBodyLimit)
+	}
+	if r := logRecords(t, &buf)[1]; r["code"] != float64(1004) || r["message"] != "device busy" {
+		t.Errorf("response record = %v, want code 1004 and message %q", r, "device busy")
+	}
+
+	// The whole body is still returned
+	got, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("reading the body returned unexpected error: %v", err)
+	}
+	if string(got) != payload {
+		t.Errorf("body has %d bytes, want %d", len(got), len(payload))
+	}
+}
+
+func TestLoggingTransport_LargeResponseBody(t *testing.T) {
+	payload := `{"ok": true, "data": {"token": "eyJhbGciOiJub25lIn0", "positions": "` + strings.Repeat("x", 1<<20) + `"}}`
+	body := &countingReader{r: strings.NewReader(payload)}
+
+	var buf bytes.Buffer
+	transport := &onntrackclient.LoggingTransport{
+		Transport: onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{"Content-Type": []string{"application/json"}}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(body), Request: req}, nil
+		}),
+		Logger:    slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		BodyLimit: onntrackclient.DefaultBodyLimit,
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/positions/history", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip returned unexpected error: %v", err)
+	}
+
+	// Only the logged start of the body is read, with the token redacted
+	if body.n > 2*onntrackclient.DefaultBodyLimit {
+		t.Errorf("RoundTrip read %d bytes of the body, want at most %d", body.n, 2*onntrackclient.DefaultBodyLimit)
+	}
+	records := logRecords(t, &buf)
+	logged, _ := records[len(records)-1]["body"].(string)
+	if !strings.HasPrefix(logged, `{"ok": true, "data": {"token":"REDACTED", "positions"`) || !strings.HasSuffix(logged, "(more than 4096 bytes)") {
+		t.Errorf("response body = %.80q..., want a redacted and truncated body", logged)
+	}
+
+	got, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("reading the body returned unexpected error: %v", err)
+	}
+	if string(got) != payload {
+		t.Errorf("body has %d bytes, want %d", len(got), len(payload))
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	var transportLog, contextLog bytes.Buffer
+	client := srv.Client(onntrackclient.WithLogger(slog.New(slog.NewJSONHandler(&transportLog, nil))))
+
+	// Requests get a generated ID each
+	client.Devices.List(context.Background(), nil)
+	client.Devices.List(context.Background(), nil)
+	requests := srv.Requests()
+	first, second := requests[0].Header.Get(onntrackclient.RequestIDHeader), requests[1].Header.Get(onntrackclient.RequestIDHeader)
+	if first == "" || first == second {
+		t.Errorf("generated request IDs = %q, %q, want two different IDs", first, second)
+	}
+	if r := logRecords(t, &transportLog)[0]; r["request_id"] != first {
+		t.Errorf("logged request_id = %v, want %v", r["request_id"], first)
+	}
+
+	// An ID and a logger from the context take precedence
+	ctx := onntrackclient.ContextWithRequestID(context.Background(), "action-42")
+	ctx = onntrackclient.ContextWithLogger(ctx, slog.New(slog.NewJSONHandler(&contextLog, nil)))
+	transportLog.Reset()
+	_, _, err := client.Devices.Get(ctx, "missing")
+
+	if got := srv.Requests()[2].Header.Get(onntrackclient.RequestIDHeader); got != "action-42" {
+		t.Errorf("sent request ID = %v, want action-42", got)
+	}
+	if transportLog.Len() != 0 {
+		t.Errorf("transport logger received %s, want nothing", transportLog.String())
+	}
+	for _, r := range logRecords(t, &contextLog) {
+		if r["request_id"] != "action-42" {
+			t.Errorf("record %v has request_id %v, want action-42", r["msg"], r["request_id"])
+		}
+	}
+
+	// The ID is attached to errors
+	var errResp *onntrackclient.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.RequestID != "action-42" {
+		t.Fatalf("Get error = %v, want an ErrorResponse with request ID action-42", err)
+	}
+	if !strings.Contains(err.Error(), "action-42") {
+		t.Errorf("Error() = %q, want it to contain the request ID", err.Error())
+	}
+}
+
+func TestRequestID_RequestError(t *testing.T) {
+	// Create a test server that returns a body that is not JSON
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true, "data": [`))
+	}))
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	ctx := onntrackclient.ContextWithRequestID(context.Background(), "action-43")
+
+	// Decoding errors carry the ID and still unwrap
+	_, _, err := client.Devices.List(ctx, nil)
+	var reqErr *onntrackclient.RequestError
+	if !errors.As(err, &reqErr) || reqErr.RequestID != "action-43" {
+		t.Fatalf("List error = %v, want a RequestError with request ID action-43", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("List error = %v, want it to wrap io.ErrUnexpectedEOF", err)
+	}
+	if !strings.Contains(err.Error(), "action-43") {
+		t.Errorf("Error() = %q, want it to contain the request ID", err.Error())
+	}
+
+	// So do transport errors
+	server.Close()
+	_, _, err = client.Devices.List(ctx, nil)
+	var urlErr *url.Error
+	if !errors.As(err, &reqErr) || reqErr.RequestID != "action-43" || !errors.As(err, &urlErr) {
+		t.Errorf("List error = %v, want a RequestError with request ID action-43 wrapping a *url.Error", err)
+	}
+}
@@ -0,0 +1,160 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MediaService handles communication with the dashcam media related
+// methods of the Onntrack API.
+type MediaService service
+
+// ErrRangeIgnored is returned by MediaService.Download when a download was
+// resumed from an offset but the server sent the whole file instead of the
+// requested range.
+var ErrRangeIgnored = errors.New("server ignored range request")
+
+// MediaType is the kind of file uploaded by a dashcam.
+type MediaType string
+
+const (
+	MediaTypePhoto MediaType = "photo"
+	MediaTypeVideo MediaType = "video"
+)
+
+// Media represents a photo or video clip uploaded by a dashcam.
+type Media struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"deviceId"`
+	Type      MediaType `json:"type"`
+	Camera    int       `json:"camera"`
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+	Duration  int       `json:"duration"`
+	CreatedAt Timestamp `json:"createTime"`
+}
+
+// MediaListOptions specifies the optional parameters to the
+// MediaService.List method.
+type MediaListOptions struct {
+	// Only return media created at or after From
+	From time.Time
+
+	// Only return media created before To
+	To time.Time
+
+	// Filter by media type
+	Type MediaType
+}
+
+// List the media uploaded by a device.
+//
+// Endpoint: media
+func (s *MediaService) List(ctx context.Context, deviceID string, opts *MediaListOptions) ([]*Media, *http.Response, error) {
+	params := url.Values{}
+	params.Set("deviceId", deviceID)
+	if opts != nil {
+		if !opts.From.IsZero() {
+			params.Set("startTime", opts.From.UTC().Format(TimeLayout))
+		}
+		if !opts.To.IsZero() {
+			params.Set("endTime", opts.To.UTC().Format(TimeLayout))
+		}
+		if opts.Type != "" {
+			params.Set("type", string(opts.Type))
+		}
+	}
+	u := "media?" + params.Encode()
+
+	req, err := s.client.NewRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var media []*Media
+	resp, err := s.client.doData(req, &media)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return media, resp, nil
+}
+
+// CaptureRequest represents a request to take a photo or record a video
+// clip remotely.
+type CaptureRequest struct {
+	Type   MediaType `json:"type"`
+	Camera int       `json:"camera"`
+
+	// Duration is the length of a video clip in seconds.
+	Duration int `json:"duration,omitempty"`
+}
+
+// Capture represents a capture command sent to a device. The resulting file
+// shows up in MediaService.List once the device has uploaded it.
+type Capture struct {
+	CommandID string    `json:"commandId"`
+	DeviceID  string    `json:"deviceId"`
+	SentAt    Timestamp `json:"sendTime"`
+}
+
+// Capture asks a device to take a photo or record a video clip.
+//
+// Endpoint: media/{deviceId}/capture
+func (s *MediaService) Capture(ctx context.Context, deviceID string, captureReq *CaptureRequest) (*Capture, *http.Response, error) {
+	u := fmt.Sprintf("media/%s/capture", deviceID)
+
+	req, err := s.client.NewRequest(ctx, http.MethodPost, u, captureReq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	capture := new(Capture)
+	resp, err := s.client.doData(req, capture)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return capture, resp, nil
+}
+
+// Download streams a media file into w.
+//
+// To resume an interrupted download, pass the number of bytes already
+// received as offset. Only the remainder of the file is then requested and
+// written. If the server does not honour the range, nothing is written to w
+// and ErrRangeIgnored is returned so the caller can start over.
+func (s *MediaService) Download(ctx context.Context, media *Media, w io.Writer, offset int64) (*http.Response, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodGet, media.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "*/*")
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	return s.client.Do(req, &rangeWriter{Writer: w, offset: offset})
+}
+
+// rangeWriter writes a downloaded file, refusing the body when a range was
+// requested but the whole file was sent.
+type rangeWriter struct {
+	io.Writer
+	offset int64
+}
+
+func (w *rangeWriter) checkResponse(resp *http.Response) error {
+	if w.offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		return ErrRangeIgnored
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package onntrackclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMediaService_List(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/media" {
+			t.Errorf("Expected request to '/media', got '%s'", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("deviceId"); got != "device-1" {
+			t.Errorf("Expected deviceId 'device-1', got '%s'", got)
+		}
+		if got := r.URL.Query().Get("startTime"); got != "2024-05-01 00:00:00" {
+			t.Errorf("Expected startTime '2024-05-01 00:00:00', got '%s'", got)
+		}
+		if got := r.URL.Query().Get("type"); got != "video" {
+			t.Errorf("Expected type 'video', got '%s'", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": true, "code": 0, "data": [
+			{"id": "media-1", "deviceId": "device-1", "type": "video", "url": "/files/media-1.mp4", "size": 1024}
+		]}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	media, _, err := client.Media.List(context.Background(), "device-1", &MediaListOptions{
+		From: time.Date(2024, 5, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Type: MediaTypeVideo,
+	})
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+
+	if len(media) != 1 {
+		t.Fatalf("List returned %d media, want 1", len(media))
+	}
+	if media[0].Type != MediaTypeVideo {
+		t.Errorf("Media Type = %v, want %v", media[0].Type, MediaTypeVideo)
+	}
+}
+
+func TestMediaService_Download(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+
+	// Create a test server that supports range requests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/files/media-1.mp4" {
+			t.Errorf("Expected request to '/files/media-1.mp4', got '%s'", r.URL.Path)
+		}
+		http.ServeContent(w, r, "media-1.mp4", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+	media := &Media{ID: "media-1", URL: "/files/media-1.mp4"}
+
+	// Download the whole file
+	var full bytes.Buffer
+	if _, err := client.Media.Download(context.Background(), media, &full, 0); err != nil {
+		t.Fatalf("Download returned unexpected error: %v", err)
+	}
+	if full.String() != content {
+		t.Errorf("Download wrote %d bytes, want %d", full.Len(), len(content))
+	}
+
+	// Resume from an offset
+	var rest bytes.Buffer
+	resp, err := client.Media.Download(context.Background(), media, &rest, 600)
+	if err != nil {
+		t.Fatalf("Download returned unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("Download returned status %d, want %d", resp.StatusCode, http.StatusPartialContent)
+	}
+	if rest.String() != content[600:] {
+		t.Errorf("Download wrote %q, want %q", rest.String(), content[600:])
+	}
+}
+
+func TestMediaService_Download_RangeIgnored(t *testing.T) {
+	// Create a test server that always sends the whole file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("whole file"))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	var buf bytes.Buffer
+	_, err := client.Media.Download(context.Background(), &Media{URL: "/files/media-1.mp4"}, &buf, 5)
+	if !errors.Is(err, ErrRangeIgnored) {
+		t.Errorf("Download error = %v, want %v", err, ErrRangeIgnored)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Download wrote %q, want nothing", buf.String())
+	}
+}
+
+func TestMediaService_Download_OtherHost(t *testing.T) {
+	// Create a file server on another host than the platform
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization = %q, want no API key sent to the file server", got)
+		}
+		w.Write([]byte("photo"))
+	}))
+	defer files.Close()
+
+	platform := httptest.NewServer(http.NotFoundHandler())
+	defer platform.Close()
+
+	// Create a client that uses the platform server
+	client, _ := NewClient(WithBaseURL(platform.URL), WithAPIKey("secret"))
+
+	var buf bytes.Buffer
+	if _, err := client.Media.Download(context.Background(), &Media{URL: files.URL + "/media-1.jpg"}, &buf, 0); err != nil {
+		t.Fatalf("Download returned unexpected error: %v", err)
+	}
+	if buf.String() != "photo" {
+		t.Errorf("Download wrote %q, want %q", buf.String(), "photo")
+	}
+}
@@ -0,0 +1,146 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes a request sent by Do.
+type RequestInfo struct {
+	// Endpoint is the endpoint template of the request, such as
+	// "devices/{id}". Requests for other URLs, such as media downloads,
+	// have the endpoint "other".
+	Endpoint string
+	Method   string
+
+	// Status is the HTTP status of the response, or 0 if there was none.
+	Status int
+
+	// Code is the platform code of the response envelope, or 0 if there
+	// was none.
+	Code int
+
+	// Retries is the number of times the request was retried.
+	Retries int
+
+	Duration time.Duration
+	Err      error
+}
+
+// Metrics receives a measurement of every request sent by Do. It must be
+// safe for concurrent use.
+type Metrics interface {
+	ObserveRequest(ctx context.Context, info RequestInfo)
+}
+
+// Tracer starts a span around every request sent by Do. It must be safe
+// for concurrent use.
+type Tracer interface {
+	// StartSpan starts a span for a request to an endpoint template. The
+	// request is sent with the returned context, so middleware can
+	// propagate the span.
+	StartSpan(ctx context.Context, endpoint, method string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span with the outcome of the request.
+	End(info RequestInfo)
+}
+
+// WithMetrics returns a ClientOption that reports every request to m.
+func WithMetrics(m Metrics) ClientOption {
+	return func(c *Client) error {
+		c.metrics = m
+		return nil
+	}
+}
+
+// WithTracer returns a ClientOption that traces every request with t.
+func WithTracer(t Tracer) ClientOption {
+	return func(c *Client) error {
+		c.tracer = t
+		return nil
+	}
+}
+
+// endpoints are the endpoint templates of the platform API. A segment in
+// braces matches any segment.
+var endpoints = []string{
+	"alarms",
+	"devices",
+	"devices/{id}",
+	"homepage/login",
+	"media",
+	"media/{deviceId}/capture",
+	"positions/history",
+	"positions/latest",
+	"share",
+	"share/{id}",
+}
+
+// endpoint returns the endpoint template of a request URL.
+func (c *Client) endpoint(u *url.URL) string {
+	if u.Host != c.BaseURL.Host {
+		return "other"
+	}
+	path, ok := strings.CutPrefix(u.Path, c.BaseURL.Path)
+	if !ok {
+		return "other"
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, endpoint := range endpoints {
+		template := strings.Split(endpoint, "/")
+		if len(template) != len(segments) {
+			continue
+		}
+		match := true
+		for i, s := range template {
+			if strings.HasPrefix(s, "{") {
+				match = segments[i] != ""
+			} else {
+				match = segments[i] == s
+			}
+			if !match {
+				break
+			}
+		}
+		if match {
+			return endpoint
+		}
+	}
+	return "other"
+}
+
+// retriesFromContext returns the retry counter of a request sent by Do.
+func retriesFromContext(ctx context.Context) *int {
+	retries, _ := ctx.Value(retriesKey).(*int)
+	return retries
+}
+
+// observe reports a request sent by Do to the metrics and span of the
+// client.
+func (c *Client) observe(ctx context.Context, span Span, info RequestInfo, v interface{}) {
+	if info.Err == nil {
+		if envelope, ok := v.(*apiResponse); ok {
+			info.Code = envelope.Code
+		}
+	}
+	var errResp *ErrorResponse
+	if errors.As(info.Err, &errResp) {
+		info.Code, _ = strconv.Atoi(errResp.Code)
+	}
+
+	if span != nil {
+		span.End(info)
+	}
+	if c.metrics != nil {
+		c.metrics.ObserveRequest(ctx, info)
+	}
+}
@@ -0,0 +1,79 @@
+package onntrackclient_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+func TestWithMetrics(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{ID: "1", IMEI: "490154203237518"})
+
+	metrics := new(onntracktest.Metrics)
+	client := srv.Client(
+		onntrackclient.WithMetrics(metrics),
+		onntrackclient.WithRetry(onntrackclient.RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}),
+	)
+	ctx := context.Background()
+
+	srv.AddFault(onntracktest.Fault{Path: "devices/1", Status: http.StatusServiceUnavailable, Times: 1})
+	client.Devices.Get(ctx, "1")
+	client.Devices.Get(ctx, "2")
+	client.Positions.Latest(ctx)
+
+	gets := metrics.Endpoint(http.MethodGet, "devices/{id}")
+	if len(gets) != 2 {
+		t.Fatalf("observed %d requests for GET devices/{id}, want 2: %+v", len(gets), metrics.Requests())
+	}
+	if info := gets[0]; info.Status != http.StatusOK || info.Code != 0 || info.Retries != 1 || info.Err != nil || info.Duration <= 0 {
+		t.Errorf("first Get = %+v, want status 200 after 1 retry", info)
+	}
+	if info := gets[1]; info.Code != onntracktest.CodeNotFound || info.Retries != 0 {
+		t.Errorf("second Get = %+v, want code %d", info, onntracktest.CodeNotFound)
+	}
+	if n := len(metrics.Endpoint(http.MethodGet, "positions/latest")); n != 1 {
+		t.Errorf("observed %d requests for GET positions/latest, want 1", n)
+	}
+
+	// Requests for unknown URLs are not reported by path
+	req, _ := client.NewRequest(ctx, http.MethodGet, "media/files/photo.jpg", nil)
+	client.Do(req, nil)
+	if n := len(metrics.Endpoint(http.MethodGet, "other")); n != 1 {
+		t.Errorf("observed %d requests for GET other, want 1", n)
+	}
+}
+
+func TestWithTracer(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	// Middleware sees the span of the request
+	var traced bool
+	propagate := func(next http.RoundTripper) http.RoundTripper {
+		return onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			traced = onntracktest.SpanFromContext(req.Context()) != nil
+			return next.RoundTrip(req)
+		})
+	}
+
+	tracer := new(onntracktest.Tracer)
+	client := srv.Client(onntrackclient.WithTracer(tracer), onntrackclient.WithMiddleware(propagate))
+	client.Devices.Delete(context.Background(), "7")
+
+	spans := tracer.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("started %d spans, want 1", len(spans))
+	}
+	if s := spans[0]; s.Endpoint != "devices/{id}" || s.Method != http.MethodDelete || !s.Ended || s.Info.Code != onntracktest.CodeNotFound {
+		t.Errorf("span = %+v, want an ended DELETE devices/{id} with code %d", s, onntracktest.CodeNotFound)
+	}
+	if !traced {
+		t.Error("middleware did not see the span in the request context")
+	}
+}
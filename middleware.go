@@ -0,0 +1,229 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Middleware wraps the round tripper that sends a request on to the next
+// stage of the chain. It may change the request, act on the response or
+// answer the request itself without calling next. Requests must be cloned
+// before they are changed, as for any http.RoundTripper.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as
+// http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface.
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware returns a ClientOption that appends middleware to the
+// chain every request of the client passes through.
+//
+// The chain runs from the outside in, ending at the transport of
+// HTTPClient:
+//
+//  1. middleware, in the order it was added, so the first sees the request
+//     first and the response last;
+//  2. the response cache (WithCache), which answers fresh GET requests
+//     without sending them on;
+//  3. the circuit breaker (WithCircuitBreaker), which fails requests fast
+//     while the platform is down;
+//  4. retries (WithRetry), so everything below runs once per attempt;
+//  5. authentication, which sets the Authorization header to the current
+//     API key on requests to BaseURL;
+//  6. logging (WithLogger, WithBodyLogging), which logs every attempt as
+//     it is sent.
+//
+// The order of client options does not change the chain, and replacing
+// HTTPClient or its transport keeps it intact.
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(c *Client) error {
+		c.middleware = append(c.middleware, middleware...)
+		return nil
+	}
+}
+
+// transport returns the transport of HTTPClient wrapped in the middleware
+// chain.
+func (c *Client) transport() http.RoundTripper {
+	transport := c.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	chain := slices.Clone(c.middleware)
+	if c.cache != nil {
+		chain = append(chain, c.cache.middleware(c))
+	}
+	if c.breaker != nil {
+		chain = append(chain, c.breaker.middleware(c))
+	}
+	if c.retry != nil {
+		chain = append(chain, RetryMiddleware(*c.retry))
+	}
+	chain = append(chain, c.authMiddleware)
+	if c.logging != nil {
+		chain = append(chain, c.loggingMiddleware)
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		transport = chain[i](transport)
+	}
+	return transport
+}
+
+// authMiddleware sets the Authorization header to the API key of the client
+// when the request is sent, so requests retried after a new login carry the
+// new token. Requests to other hosts, such as media file servers, are sent
+// without it.
+func (c *Client) authMiddleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !c.platformURL(req.URL) {
+			return next.RoundTrip(req)
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		return next.RoundTrip(req)
+	})
+}
+
+// loggingMiddleware logs requests with the settings of WithLogger and
+// WithBodyLogging.
+func (c *Client) loggingMiddleware(next http.RoundTripper) http.RoundTripper {
+	t := *c.logging
+	t.Transport = next
+	return &t
+}
+
+// RetryPolicy configures retries of failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first.
+	// Requests are not retried when it is less than 2.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry. It doubles for every
+	// further retry, up to MaxBackoff. Without MaxBackoff the one of
+	// DefaultRetryPolicy applies.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries twice, after half a second and a second.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// WithRetry returns a ClientOption that retries requests according to
+// policy. See RetryMiddleware for the requests that are retried.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		c.retry = &policy
+		return nil
+	}
+}
+
+// RetryMiddleware returns middleware that retries idempotent requests
+// (GET, HEAD, OPTIONS, PUT and DELETE) that fail with a network error or
+// with status 429, 502, 503 or 504. A Retry-After header of a response
+// replaces the backoff, up to MaxBackoff.
+func RetryMiddleware(policy RetryPolicy) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			backoff := policy.MinBackoff
+			maxBackoff := policy.MaxBackoff
+			if maxBackoff <= 0 {
+				maxBackoff = DefaultRetryPolicy.MaxBackoff
+			}
+
+			for attempt := 1; ; attempt++ {
+				r := req
+				if attempt > 1 {
+					r = req.Clone(ctx)
+					if req.GetBody != nil {
+						body, err := req.GetBody()
+						if err != nil {
+							return nil, err
+						}
+						r.Body = body
+					}
+				}
+
+				resp, err := next.RoundTrip(r)
+				if attempt >= policy.MaxAttempts || !retryable(req, resp, err) {
+					return resp, err
+				}
+
+				delay := backoff
+				if resp != nil {
+					if after, ok := retryAfter(resp); ok {
+						delay = after
+					}
+					io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+					resp.Body.Close()
+				}
+				delay = min(delay, maxBackoff)
+
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				backoff = min(2*backoff, maxBackoff)
+				if retries := retriesFromContext(ctx); retries != nil {
+					*retries++
+				}
+			}
+		})
+	}
+}
+
+// retryable reports whether a request can be sent again after the given
+// outcome.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay of a Retry-After header in seconds or as a
+// date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
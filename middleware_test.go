@@ -0,0 +1,139 @@
+package onntrackclient_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) onntrackclient.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" in")
+				req = req.Clone(req.Context())
+				req.Header.Set("X-Tenant", name)
+				resp, err := next.RoundTrip(req)
+				order = append(order, name+" out")
+				return resp, err
+			})
+		}
+	}
+
+	client := srv.Client(
+		onntrackclient.WithMiddleware(trace("first")),
+		onntrackclient.WithMiddleware(trace("second")),
+	)
+	if _, _, err := client.Devices.List(context.Background(), nil); err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+
+	want := []string{"first in", "second in", "second out", "first out"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware ran in order %v, want %v", order, want)
+	}
+	if got := srv.Requests()[0].Header.Get("X-Tenant"); got != "second" {
+		t.Errorf("X-Tenant = %v, want the header of the inner middleware", got)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	policy := onntrackclient.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	client := srv.Client(onntrackclient.WithRetry(policy))
+	ctx := context.Background()
+
+	// Two failures are retried
+	srv.AddFault(onntracktest.Fault{Path: "devices", Status: http.StatusServiceUnavailable, Times: 2})
+	if _, _, err := client.Devices.List(ctx, nil); err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	srv.AssertCalled(t, http.MethodGet, "devices", 3)
+
+	// Attempts run out
+	srv.ResetRequests()
+	srv.AddFault(onntracktest.Fault{Path: "devices", Status: http.StatusBadGateway, Times: 3})
+	if _, resp, err := client.Devices.List(ctx, nil); err == nil || resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("List = %v, %v, want 502 after the last attempt", resp, err)
+	}
+	srv.AssertCalled(t, http.MethodGet, "devices", 3)
+	srv.ClearFaults()
+
+	// Other errors and requests that are not idempotent are not retried
+	srv.ResetRequests()
+	srv.AddFault(onntracktest.Fault{Status: http.StatusInternalServerError, Times: 1})
+	client.Devices.List(ctx, nil)
+	srv.AddFault(onntracktest.Fault{Status: http.StatusServiceUnavailable, Times: 1})
+	client.Devices.Create(ctx, &onntrackclient.DeviceCreateRequest{Name: "Van", IMEI: "490154203237518"})
+	srv.AssertCalled(t, http.MethodGet, "devices", 1)
+	srv.AssertCalled(t, http.MethodPost, "devices", 1)
+}
+
+func TestRetryMiddleware_NoMaxBackoff(t *testing.T) {
+	attempts := 0
+	transport := onntrackclient.RetryMiddleware(onntrackclient.RetryPolicy{MaxAttempts: 2, MinBackoff: 50 * time.Millisecond})(
+		onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}))
+
+	// The backoff is not capped at zero
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/devices", nil)
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if attempts != 2 {
+		t.Errorf("RoundTrip made %d attempts, want 2", attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("RoundTrip retried after %v, want at least 50ms", elapsed)
+	}
+}
+
+func TestWithMiddleware_Reauthenticate(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	// A middleware that logs in again when the token has expired, and
+	// retries through the chain so the new token is sent
+	var client *onntrackclient.Client
+	relogin := func(next http.RoundTripper) http.RoundTripper {
+		return onntrackclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized || req.URL.Path == "/homepage/login" {
+				return resp, err
+			}
+			resp.Body.Close()
+			client.Auth.Login(req.Context(), &onntrackclient.LoginRequest{
+				Account:  onntracktest.DefaultAccount,
+				Password: onntracktest.DefaultPassword,
+			})
+			return next.RoundTrip(req)
+		})
+	}
+	client = srv.Client(onntrackclient.WithMiddleware(relogin))
+
+	srv.ExpireTokens()
+	if _, _, err := client.Devices.List(context.Background(), nil); err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	srv.AssertCalled(t, http.MethodPost, "homepage/login", 1)
+	srv.AssertCalled(t, http.MethodGet, "devices", 2)
+}
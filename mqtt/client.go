@@ -0,0 +1,470 @@
+// Package mqtt is a minimal MQTT 3.1.1 client for publishing telemetry.
+//
+// It only publishes: messages are sent with QoS 0 or 1, and a QoS 1 publish
+// returns once the broker has acknowledged it. When the connection is lost
+// the client reconnects with exponential backoff and resends the message
+// that was in flight, so a QoS 1 message is delivered at least once unless
+// Publish gives up and returns an error.
+//
+//	client, err := mqtt.Dial(ctx, "localhost:1883", &mqtt.Options{ClientID: "onntrack"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer client.Close()
+//
+//	err = client.Publish(ctx, &mqtt.Message{Topic: "onntrack/test", Payload: []byte("hello"), QoS: 1})
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/mqtt/internal/packet"
+)
+
+// ErrClosed is returned when publishing on a closed client.
+var ErrClosed = errors.New("mqtt: client closed")
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+
+	// QoS is 0 (at most once) or 1 (at least once).
+	QoS byte
+
+	// Retain asks the broker to keep the message and send it to clients
+	// that subscribe later.
+	Retain bool
+}
+
+// Options configures a Client. The zero value is usable.
+type Options struct {
+	// ClientID identifies the client to the broker. A random ID is used
+	// when it is empty.
+	ClientID string
+
+	Username string
+	Password string
+
+	// CleanSession discards the session state the broker holds for the
+	// client ID when connecting.
+	CleanSession bool
+
+	// KeepAlive is the longest time without packets before the client
+	// pings the broker. Defaults to 60 seconds.
+	KeepAlive time.Duration
+
+	// Will is published by the broker when the connection is lost without
+	// the client closing it.
+	Will *Message
+
+	// ConnectTimeout limits connecting and waiting for acknowledgements.
+	// Defaults to 30 seconds.
+	ConnectTimeout time.Duration
+
+	// ReconnectDelay is the delay before the first reconnect attempt; it
+	// doubles after every failure up to MaxReconnectDelay. They default to
+	// 1 second and 1 minute.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+
+	// PublishAttempts is how often Publish sends a message whose
+	// connection is lost before it gives up. The attempts are spaced like
+	// reconnects. Defaults to 5.
+	PublishAttempts int
+
+	// Dial opens the network connection, for example to use TLS. Defaults
+	// to a TCP connection.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Logger receives connection events. Nothing is logged when it is nil.
+	Logger *slog.Logger
+}
+
+func (o *Options) withDefaults() Options {
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+
+	if opts.ClientID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		opts.ClientID = "onntrack-" + hex.EncodeToString(b)
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = time.Minute
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = 30 * time.Second
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = time.Second
+	}
+	if opts.MaxReconnectDelay <= 0 {
+		opts.MaxReconnectDelay = time.Minute
+	}
+	if opts.PublishAttempts <= 0 {
+		opts.PublishAttempts = 5
+	}
+	if opts.Dial == nil {
+		var d net.Dialer
+		opts.Dial = d.DialContext
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.DiscardHandler)
+	}
+
+	return opts
+}
+
+// ConnectError is returned when the broker refuses a connection.
+type ConnectError struct {
+	// Code is the CONNACK return code.
+	Code byte
+}
+
+func (e *ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "client identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	if reason, ok := reasons[e.Code]; ok {
+		return "mqtt: connection refused: " + reason
+	}
+	return fmt.Sprintf("mqtt: connection refused with code %d", e.Code)
+}
+
+// Temporary reports whether the refusal may go away by itself. Only a
+// broker that is unavailable (code 3) is worth trying again; a rejected
+// protocol version, client identifier or credentials stay rejected.
+func (e *ConnectError) Temporary() bool {
+	return e.Code == 3
+}
+
+// Client is an MQTT client connection. It is safe for concurrent use;
+// messages are published one at a time.
+type Client struct {
+	addr string
+	opts Options
+
+	// mu serialises publishes, pings and reconnects.
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+	lastSent time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the broker at addr, a host:port pair.
+func Dial(ctx context.Context, addr string, opts *Options) (*Client, error) {
+	c := &Client{
+		addr: addr,
+		opts: opts.withDefaults(),
+		done: make(chan struct{}),
+	}
+
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	go c.keepAlive()
+	return c, nil
+}
+
+// connect opens a connection and sends CONNECT. c.mu must be held or the
+// client not yet shared.
+func (c *Client) connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.ConnectTimeout)
+	defer cancel()
+
+	conn, err := c.opts.Dial(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	connect := &packet.Connect{
+		ClientID:     c.opts.ClientID,
+		Username:     c.opts.Username,
+		Password:     c.opts.Password,
+		CleanSession: c.opts.CleanSession,
+		KeepAlive:    uint16(c.opts.KeepAlive / time.Second),
+	}
+	if will := c.opts.Will; will != nil {
+		connect.WillTopic = will.Topic
+		connect.WillMessage = will.Payload
+		connect.WillQoS = will.QoS
+		connect.WillRetain = will.Retain
+	}
+
+	r := bufio.NewReader(conn)
+	code, err := handshake(conn, r, connect)
+	if err == nil && code != 0 {
+		err = &ConnectError{Code: code}
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if !stop() {
+		// The deadline was set just before the context ended
+		conn.Close()
+		return ctx.Err()
+	}
+
+	c.conn, c.r, c.lastSent = conn, r, time.Now()
+	c.opts.Logger.Info("mqtt: connected", "broker", c.addr, "client_id", c.opts.ClientID)
+	return nil
+}
+
+func handshake(conn net.Conn, r *bufio.Reader, connect *packet.Connect) (byte, error) {
+	if err := packet.Write(conn, connect.Encode()); err != nil {
+		return 0, err
+	}
+
+	p, err := packet.Read(r)
+	if err != nil {
+		return 0, err
+	}
+	if p.Type != packet.CONNACK {
+		return 0, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", p.Type)
+	}
+	return packet.DecodeConnack(p)
+}
+
+// reconnect connects with exponential backoff until it succeeds, ctx is
+// done, the client is closed or the broker refuses the connection for good.
+// c.mu must be held.
+func (c *Client) reconnect(ctx context.Context) error {
+	delay := c.opts.ReconnectDelay
+	for {
+		err := c.connect(ctx)
+		if err == nil {
+			return nil
+		}
+		var connErr *ConnectError
+		if errors.As(err, &connErr) && !connErr.Temporary() {
+			return err
+		}
+		c.opts.Logger.Warn("mqtt: reconnect failed", "broker", c.addr, "error", err, "retry_in", delay)
+
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, c.opts.MaxReconnectDelay)
+	}
+}
+
+// sleep waits for d unless ctx is done or the client is closed first.
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrClosed
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// disconnect drops a broken connection. c.mu must be held.
+func (c *Client) disconnect(err error) {
+	if c.conn == nil {
+		return
+	}
+	c.opts.Logger.Warn("mqtt: connection lost", "broker", c.addr, "error", err)
+	c.conn.Close()
+	c.conn, c.r = nil, nil
+}
+
+// Publish sends a message. With QoS 1 it returns once the broker has
+// acknowledged the message. If the connection is lost the client
+// reconnects and sends the message again, with the reconnect backoff in
+// between, up to Options.PublishAttempts times or until ctx is done; the
+// last error is returned. A *ConnectError that is not Temporary is
+// returned right away.
+func (c *Client) Publish(ctx context.Context, msg *Message) error {
+	if msg.QoS > 1 {
+		return fmt.Errorf("mqtt: QoS %d is not supported", msg.QoS)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	pub := &packet.Publish{Topic: msg.Topic, Payload: msg.Payload, QoS: msg.QoS, Retain: msg.Retain}
+	if pub.QoS > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		pub.ID = c.packetID
+	}
+
+	delay := c.opts.ReconnectDelay
+	for attempt := 1; ; attempt++ {
+		if c.conn == nil {
+			if err := c.reconnect(ctx); err != nil {
+				return err
+			}
+		}
+
+		err := c.send(ctx, pub)
+		if err == nil {
+			return nil
+		}
+		c.disconnect(err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt == c.opts.PublishAttempts {
+			return fmt.Errorf("mqtt: publishing to %s failed after %d attempts: %w", msg.Topic, attempt, err)
+		}
+
+		// A broker that accepts the connection but drops the message would
+		// otherwise be hammered without a pause
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, c.opts.MaxReconnectDelay)
+
+		// Tell the broker it may have seen this message before
+		pub.Dup = pub.QoS > 0
+	}
+}
+
+// send writes a PUBLISH packet and waits for its PUBACK. c.mu must be held.
+func (c *Client) send(ctx context.Context, pub *packet.Publish) error {
+	conn := c.conn
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	conn.SetDeadline(time.Now().Add(c.opts.ConnectTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := packet.Write(conn, pub.Encode()); err != nil {
+		return err
+	}
+	c.lastSent = time.Now()
+
+	if pub.QoS == 0 {
+		return nil
+	}
+	return c.await(packet.PUBACK, pub.ID)
+}
+
+// await reads packets until one of the given type, with the given packet
+// identifier for PUBACK, arrives. c.mu must be held.
+func (c *Client) await(typ byte, id uint16) error {
+	for {
+		p, err := packet.Read(c.r)
+		if err != nil {
+			return err
+		}
+		if p.Type != typ {
+			continue
+		}
+		if typ != packet.PUBACK {
+			return nil
+		}
+		if ackID, err := packet.DecodeID(p); err != nil || ackID == id {
+			return err
+		}
+	}
+}
+
+// keepAlive pings the broker when nothing has been sent for half the keep
+// alive interval, and reconnects a lost connection so the will message is
+// cleared even when nothing is being published.
+func (c *Client) keepAlive() {
+	interval := c.opts.KeepAlive / 2
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		select {
+		case <-c.done:
+			// Closed while waiting for the lock
+			c.mu.Unlock()
+			return
+		default:
+		}
+
+		switch {
+		case c.conn == nil:
+			if err := c.connect(context.Background()); err != nil {
+				c.opts.Logger.Warn("mqtt: reconnect failed", "broker", c.addr, "error", err)
+			}
+		case time.Since(c.lastSent) >= interval:
+			if err := c.ping(); err != nil {
+				c.disconnect(err)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// ping sends PINGREQ and waits for PINGRESP. c.mu must be held.
+func (c *Client) ping() error {
+	c.conn.SetDeadline(time.Now().Add(c.opts.ConnectTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := packet.Write(c.conn, &packet.Packet{Type: packet.PINGREQ}); err != nil {
+		return err
+	}
+	c.lastSent = time.Now()
+	return c.await(packet.PINGRESP, 0)
+}
+
+// Close sends DISCONNECT, so the broker discards the will message, and
+// closes the connection.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.conn == nil {
+			return
+		}
+		c.conn.SetDeadline(time.Now().Add(time.Second))
+		packet.Write(c.conn, &packet.Packet{Type: packet.DISCONNECT})
+		err = c.conn.Close()
+		c.conn, c.r = nil, nil
+	})
+	return err
+}
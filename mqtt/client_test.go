@@ -0,0 +1,218 @@
+package mqtt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/mqtt"
+	"github.com/MaikelH/onntrackclient/mqtt/mqtttest"
+)
+
+func TestClient_Publish(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{ClientID: "test"})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	messages := []*mqtt.Message{
+		{Topic: "onntrack/1/position", Payload: []byte(`{"lat":52.1}`), QoS: 1},
+		{Topic: "onntrack/1/status", Payload: []byte("online"), Retain: true},
+	}
+	for _, msg := range messages {
+		if err := client.Publish(context.Background(), msg); err != nil {
+			t.Fatalf("Publish returned unexpected error: %v", err)
+		}
+	}
+
+	got := broker.WaitMessages(2, time.Second)
+	if len(got) != 2 {
+		t.Fatalf("broker received %d messages, want 2", len(got))
+	}
+	if got[0].Topic != "onntrack/1/position" || string(got[0].Payload) != `{"lat":52.1}` || got[0].QoS != 1 {
+		t.Errorf("message = %+v, want the position with QoS 1", got[0])
+	}
+	if got[1].ClientID != "test" || !got[1].Retain {
+		t.Errorf("message = %+v, want a retained message from client test", got[1])
+	}
+
+	if err := client.Publish(context.Background(), &mqtt.Message{Topic: "x", QoS: 2}); err == nil {
+		t.Error("Publish with QoS 2 expected error, got nil")
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{ReconnectDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	// The broker drops the connection instead of acknowledging, so the
+	// message is sent again on a new connection
+	broker.DropNextPublishes(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Publish(ctx, &mqtt.Message{Topic: "onntrack/1/alarm", Payload: []byte("sos"), QoS: 1}); err != nil {
+		t.Fatalf("Publish returned unexpected error: %v", err)
+	}
+
+	got := broker.Messages()
+	if len(got) != 1 || !got[0].Dup {
+		t.Errorf("broker received %+v, want the message once with the DUP flag", got)
+	}
+	if broker.Connects() != 2 {
+		t.Errorf("Connects = %d, want 2", broker.Connects())
+	}
+
+	// A connection lost while idle is restored by the next publish
+	broker.DropConnections()
+	if err := client.Publish(ctx, &mqtt.Message{Topic: "onntrack/1/alarm", Payload: []byte("sos"), QoS: 1}); err != nil {
+		t.Fatalf("Publish returned unexpected error: %v", err)
+	}
+	if n := len(broker.Messages()); n != 2 {
+		t.Errorf("broker received %d messages, want 2", n)
+	}
+}
+
+func TestClient_Publish_Dropped(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{ReconnectDelay: 20 * time.Millisecond, PublishAttempts: 3})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	// The broker accepts every connection but drops every message, so
+	// publishing gives up after three attempts with a pause before each
+	// resend
+	broker.DropNextPublishes(100)
+
+	start := time.Now()
+	err = client.Publish(context.Background(), &mqtt.Message{Topic: "onntrack/1/alarm", QoS: 1})
+	if err == nil {
+		t.Fatal("Publish expected error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("Publish gave up after %v, want at least 60ms of backoff", elapsed)
+	}
+	if broker.Connects() != 3 {
+		t.Errorf("Connects = %d, want 3", broker.Connects())
+	}
+}
+
+func TestClient_Publish_Canceled(t *testing.T) {
+	broker := mqtttest.NewBroker()
+
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{ReconnectDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	// With the broker gone, publishing keeps retrying until the context ends
+	broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = client.Publish(ctx, &mqtt.Message{Topic: "onntrack/1/alarm", QoS: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClient_Auth(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	broker.Username, broker.Password = "bridge", "secret"
+	defer broker.Close()
+
+	_, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{Username: "bridge", Password: "wrong"})
+	var connErr *mqtt.ConnectError
+	if !errors.As(err, &connErr) || connErr.Code != 4 {
+		t.Errorf("Dial error = %v, want a bad credentials ConnectError", err)
+	}
+
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{Username: "bridge", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	client.Close()
+}
+
+func TestClient_Reconnect_Refused(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{ReconnectDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	// An unavailable broker is retried until the context ends
+	broker.RefuseConnects(3)
+	broker.DropConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = client.Publish(ctx, &mqtt.Message{Topic: "onntrack/1/alarm", QoS: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Rejected credentials are not
+	broker.RefuseConnects(5)
+	start := time.Now()
+	err = client.Publish(context.Background(), &mqtt.Message{Topic: "onntrack/1/alarm", QoS: 1})
+	var connErr *mqtt.ConnectError
+	if !errors.As(err, &connErr) || connErr.Code != 5 {
+		t.Errorf("Publish error = %v, want a not authorized ConnectError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Publish took %v to give up, want it to fail right away", elapsed)
+	}
+}
+
+func TestClient_Will(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	will := &mqtt.Message{Topic: "onntrack/bridge/status", Payload: []byte("offline"), QoS: 1, Retain: true}
+
+	// Closing the client cleanly discards the will
+	client, err := mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{Will: will})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+	if n := len(broker.Messages()); n != 0 {
+		t.Errorf("broker received %d messages after a clean close, want 0", n)
+	}
+
+	// A lost connection publishes it
+	client, err = mqtt.Dial(context.Background(), broker.Addr, &mqtt.Options{Will: will, ReconnectDelay: time.Hour})
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer client.Close()
+	broker.DropConnections()
+
+	got := broker.WaitMessages(1, time.Second)
+	if len(got) != 1 || string(got[0].Payload) != "offline" {
+		t.Errorf("broker received %+v, want the will", got)
+	}
+	if _, ok := broker.Retained()["onntrack/bridge/status"]; !ok {
+		t.Error("will was not retained")
+	}
+}
@@ -0,0 +1,307 @@
+// Package packet encodes and decodes the MQTT 3.1.1 control packets used by
+// the mqtt package and its test broker.
+package packet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types.
+const (
+	CONNECT    byte = 1
+	CONNACK    byte = 2
+	PUBLISH    byte = 3
+	PUBACK     byte = 4
+	PINGREQ    byte = 12
+	PINGRESP   byte = 13
+	DISCONNECT byte = 14
+)
+
+// maxRemainingLength is the largest remaining length MQTT can encode.
+const maxRemainingLength = 268435455
+
+// ErrMalformed is returned for packets that cannot be decoded.
+var ErrMalformed = errors.New("mqtt: malformed packet")
+
+// Packet is a raw control packet: the type and flags of the fixed header
+// and everything after the remaining length.
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// Read reads one packet.
+func Read(r *bufio.Reader) (*Packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, ErrMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return &Packet{Type: first >> 4, Flags: first & 0x0f, Body: body}, nil
+}
+
+// Write writes one packet in a single call to w.
+func Write(w io.Writer, p *Packet) error {
+	if len(p.Body) > maxRemainingLength {
+		return fmt.Errorf("mqtt: packet of %d bytes is too large", len(p.Body))
+	}
+
+	buf := make([]byte, 0, len(p.Body)+5)
+	buf = append(buf, p.Type<<4|p.Flags&0x0f)
+	length := len(p.Body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	buf = append(buf, p.Body...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// Connect is a CONNECT packet.
+type Connect struct {
+	ClientID     string
+	Username     string
+	Password     string
+	CleanSession bool
+	KeepAlive    uint16
+
+	// The will message is published by the broker when the client
+	// disconnects without a DISCONNECT packet. It is set when WillTopic
+	// is not empty.
+	WillTopic   string
+	WillMessage []byte
+	WillQoS     byte
+	WillRetain  bool
+}
+
+// Encode returns the packet.
+func (c *Connect) Encode() *Packet {
+	var flags byte
+	if c.CleanSession {
+		flags |= 0x02
+	}
+	if c.WillTopic != "" {
+		flags |= 0x04 | c.WillQoS<<3
+		if c.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if c.Password != "" {
+		flags |= 0x40
+	}
+	if c.Username != "" {
+		flags |= 0x80
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, c.KeepAlive)
+	body = appendString(body, c.ClientID)
+	if c.WillTopic != "" {
+		body = appendString(body, c.WillTopic)
+		body = appendBytes(body, c.WillMessage)
+	}
+	if c.Username != "" {
+		body = appendString(body, c.Username)
+	}
+	if c.Password != "" {
+		body = appendString(body, c.Password)
+	}
+
+	return &Packet{Type: CONNECT, Body: body}
+}
+
+// DecodeConnect decodes a CONNECT packet.
+func DecodeConnect(p *Packet) (*Connect, error) {
+	d := decoder{b: p.Body}
+	if d.string() != "MQTT" || d.byte() != 4 {
+		return nil, errors.New("mqtt: unsupported protocol version")
+	}
+	flags := d.byte()
+
+	c := &Connect{CleanSession: flags&0x02 != 0, KeepAlive: d.uint16()}
+	c.ClientID = d.string()
+	if flags&0x04 != 0 {
+		c.WillTopic = d.string()
+		c.WillMessage = d.bytes()
+		c.WillQoS = flags >> 3 & 0x03
+		c.WillRetain = flags&0x20 != 0
+	}
+	if flags&0x80 != 0 {
+		c.Username = d.string()
+	}
+	if flags&0x40 != 0 {
+		c.Password = d.string()
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return c, nil
+}
+
+// Publish is a PUBLISH packet.
+type Publish struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+	Dup     bool
+
+	// ID is the packet identifier, only used for QoS 1 and 2.
+	ID uint16
+}
+
+// Encode returns the packet.
+func (p *Publish) Encode() *Packet {
+	flags := p.QoS << 1
+	if p.Dup {
+		flags |= 0x08
+	}
+	if p.Retain {
+		flags |= 0x01
+	}
+
+	body := appendString(make([]byte, 0, len(p.Topic)+len(p.Payload)+4), p.Topic)
+	if p.QoS > 0 {
+		body = binary.BigEndian.AppendUint16(body, p.ID)
+	}
+	body = append(body, p.Payload...)
+
+	return &Packet{Type: PUBLISH, Flags: flags, Body: body}
+}
+
+// DecodePublish decodes a PUBLISH packet.
+func DecodePublish(p *Packet) (*Publish, error) {
+	d := decoder{b: p.Body}
+	pub := &Publish{
+		QoS:    p.Flags >> 1 & 0x03,
+		Retain: p.Flags&0x01 != 0,
+		Dup:    p.Flags&0x08 != 0,
+		Topic:  d.string(),
+	}
+	if pub.QoS > 0 {
+		pub.ID = d.uint16()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	pub.Payload = d.b
+	return pub, nil
+}
+
+// Connack returns a CONNACK packet with the given return code.
+func Connack(sessionPresent bool, code byte) *Packet {
+	var flags byte
+	if sessionPresent {
+		flags = 1
+	}
+	return &Packet{Type: CONNACK, Body: []byte{flags, code}}
+}
+
+// DecodeConnack returns the return code of a CONNACK packet.
+func DecodeConnack(p *Packet) (byte, error) {
+	if len(p.Body) != 2 {
+		return 0, ErrMalformed
+	}
+	return p.Body[1], nil
+}
+
+// Puback returns a PUBACK packet for the given packet identifier.
+func Puback(id uint16) *Packet {
+	return &Packet{Type: PUBACK, Body: binary.BigEndian.AppendUint16(nil, id)}
+}
+
+// DecodeID returns the packet identifier of a PUBACK packet.
+func DecodeID(p *Packet) (uint16, error) {
+	if len(p.Body) < 2 {
+		return 0, ErrMalformed
+	}
+	return binary.BigEndian.Uint16(p.Body), nil
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads fields from a packet body; after the first error all reads
+// return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.b) < 1 {
+		d.err = ErrMalformed
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.b) < 2 {
+		d.err = ErrMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.b)
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := int(d.uint16())
+	if d.err != nil || len(d.b) < n {
+		d.err = ErrMalformed
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
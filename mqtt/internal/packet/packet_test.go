@@ -0,0 +1,70 @@
+package packet
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		var buf bytes.Buffer
+		in := &Packet{Type: PUBLISH, Flags: 0x03, Body: bytes.Repeat([]byte{'x'}, size)}
+		if err := Write(&buf, in); err != nil {
+			t.Fatalf("Write returned unexpected error: %v", err)
+		}
+
+		out, err := Read(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("Read returned unexpected error: %v", err)
+		}
+		if out.Type != in.Type || out.Flags != in.Flags || len(out.Body) != size {
+			t.Errorf("Read = type %d, flags %d, %d bytes, want type %d, flags %d, %d bytes",
+				out.Type, out.Flags, len(out.Body), in.Type, in.Flags, size)
+		}
+	}
+
+	// A remaining length longer than four bytes is malformed
+	if _, err := Read(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}))); err != ErrMalformed {
+		t.Errorf("Read error = %v, want %v", err, ErrMalformed)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	in := &Connect{
+		ClientID:     "bridge",
+		Username:     "user",
+		Password:     "secret",
+		CleanSession: true,
+		KeepAlive:    60,
+		WillTopic:    "bridge/status",
+		WillMessage:  []byte("offline"),
+		WillQoS:      1,
+		WillRetain:   true,
+	}
+
+	out, err := DecodeConnect(in.Encode())
+	if err != nil {
+		t.Fatalf("DecodeConnect returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("DecodeConnect = %+v, want %+v", out, in)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	in := &Publish{Topic: "onntrack/1/position", Payload: []byte("{}"), QoS: 1, Retain: true, Dup: true, ID: 513}
+
+	out, err := DecodePublish(in.Encode())
+	if err != nil {
+		t.Fatalf("DecodePublish returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("DecodePublish = %+v, want %+v", out, in)
+	}
+
+	if _, err := DecodePublish(&Packet{Type: PUBLISH, Body: []byte{0, 9, 'a'}}); err != ErrMalformed {
+		t.Errorf("DecodePublish error = %v, want %v", err, ErrMalformed)
+	}
+}
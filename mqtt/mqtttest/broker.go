@@ -0,0 +1,281 @@
+// Package mqtttest provides an in-process MQTT broker for tests.
+//
+// The broker accepts connections, acknowledges QoS 1 messages and records
+// everything published to it, including will messages of clients that go
+// away without disconnecting. It does not deliver messages to subscribers.
+package mqtttest
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/mqtt/internal/packet"
+)
+
+// Message is a message received by the broker.
+type Message struct {
+	ClientID string
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retain   bool
+	Dup      bool
+}
+
+// Broker is an MQTT broker listening on a loopback address.
+type Broker struct {
+	// Addr is the host:port the broker listens on.
+	Addr string
+
+	// Username and Password, when set, are required from clients.
+	Username string
+	Password string
+
+	ln net.Listener
+
+	mu       sync.Mutex
+	changed  chan struct{}
+	conns    map[net.Conn]struct{}
+	connects int
+	messages []Message
+	retained map[string]Message
+	dropNext int
+	refuse   byte
+}
+
+// NewBroker starts a broker. Call Close when done.
+func NewBroker() *Broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mqtttest: failed to listen: " + err.Error())
+	}
+
+	b := &Broker{
+		Addr:     ln.Addr().String(),
+		ln:       ln,
+		changed:  make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+		retained: make(map[string]Message),
+	}
+	go b.serve()
+	return b
+}
+
+// Close stops the broker and closes all connections.
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.DropConnections()
+}
+
+// Connects returns the number of accepted connections, counting
+// reconnects.
+func (b *Broker) Connects() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connects
+}
+
+// Messages returns the messages received so far, in order.
+func (b *Broker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// Retained returns the last retained message for each topic. An empty
+// retained message clears the topic.
+func (b *Broker) Retained() map[string]Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	retained := make(map[string]Message, len(b.retained))
+	for topic, msg := range b.retained {
+		retained[topic] = msg
+	}
+	return retained
+}
+
+// WaitMessages waits until at least n messages have been received and
+// returns them. It returns what was received so far after the timeout.
+func (b *Broker) WaitMessages(n int, timeout time.Duration) []Message {
+	deadline := time.After(timeout)
+	for {
+		b.mu.Lock()
+		if len(b.messages) >= n {
+			messages := append([]Message(nil), b.messages...)
+			b.mu.Unlock()
+			return messages
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return b.Messages()
+		}
+	}
+}
+
+// DropConnections closes all client connections without a DISCONNECT, as
+// if the network failed.
+func (b *Broker) DropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for conn := range b.conns {
+		conn.Close()
+	}
+}
+
+// DropNextPublishes makes the broker close the connection instead of
+// acknowledging the next n messages. Dropped messages are not recorded.
+func (b *Broker) DropNextPublishes(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropNext = n
+}
+
+// RefuseConnects makes the broker refuse new connections with the given
+// CONNACK return code. Code 0 accepts them again.
+func (b *Broker) RefuseConnects(code byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refuse = code
+}
+
+func (b *Broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		b.conns[conn] = struct{}{}
+		b.mu.Unlock()
+
+		go b.handle(conn)
+	}
+}
+
+func (b *Broker) handle(conn net.Conn) {
+	var connect *packet.Connect
+	graceful := false
+
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+
+		// Publish the will when a client goes away without DISCONNECT
+		if connect != nil && connect.WillTopic != "" && !graceful {
+			b.record(&packet.Publish{
+				Topic:   connect.WillTopic,
+				Payload: connect.WillMessage,
+				QoS:     connect.WillQoS,
+				Retain:  connect.WillRetain,
+			}, connect.ClientID)
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	p, err := packet.Read(r)
+	if err != nil || p.Type != packet.CONNECT {
+		return
+	}
+	connect, err = packet.DecodeConnect(p)
+	if err != nil {
+		packet.Write(conn, packet.Connack(false, 1))
+		return
+	}
+	b.mu.Lock()
+	refuse := b.refuse
+	b.mu.Unlock()
+	if refuse != 0 {
+		packet.Write(conn, packet.Connack(false, refuse))
+		connect = nil
+		return
+	}
+	if b.Username != "" && (connect.Username != b.Username || connect.Password != b.Password) {
+		packet.Write(conn, packet.Connack(false, 4))
+		connect = nil
+		return
+	}
+	if err := packet.Write(conn, packet.Connack(false, 0)); err != nil {
+		return
+	}
+	b.update(func() { b.connects++ })
+
+	for {
+		p, err := packet.Read(r)
+		if err != nil {
+			return
+		}
+
+		switch p.Type {
+		case packet.PUBLISH:
+			pub, err := packet.DecodePublish(p)
+			if err != nil {
+				return
+			}
+
+			b.mu.Lock()
+			drop := b.dropNext > 0
+			if drop {
+				b.dropNext--
+			}
+			b.mu.Unlock()
+			if drop {
+				return
+			}
+			b.record(pub, connect.ClientID)
+
+			if pub.QoS > 0 {
+				if err := packet.Write(conn, packet.Puback(pub.ID)); err != nil {
+					return
+				}
+			}
+		case packet.PINGREQ:
+			if err := packet.Write(conn, &packet.Packet{Type: packet.PINGRESP}); err != nil {
+				return
+			}
+		case packet.DISCONNECT:
+			graceful = true
+			return
+		}
+	}
+}
+
+// record stores a received message.
+func (b *Broker) record(pub *packet.Publish, clientID string) {
+	msg := Message{
+		ClientID: clientID,
+		Topic:    pub.Topic,
+		Payload:  append([]byte(nil), pub.Payload...),
+		QoS:      pub.QoS,
+		Retain:   pub.Retain,
+		Dup:      pub.Dup,
+	}
+
+	b.update(func() {
+		b.messages = append(b.messages, msg)
+		switch {
+		case msg.Retain && len(msg.Payload) == 0:
+			delete(b.retained, msg.Topic)
+		case msg.Retain:
+			b.retained[msg.Topic] = msg
+		}
+	})
+}
+
+// update runs fn with the lock held and wakes up WaitMessages.
+func (b *Broker) update(fn func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fn()
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
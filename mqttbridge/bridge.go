@@ -0,0 +1,215 @@
+// Package mqttbridge publishes the positions and alarms of Onntrack devices
+// to an MQTT broker.
+//
+// The bridge polls the platform through an onntrackclient.Client and
+// publishes every new position and alarm as JSON with QoS 1:
+//
+//	mq, err := mqtt.Dial(ctx, "localhost:1883", nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	bridge := &mqttbridge.Bridge{Client: client, Publisher: mq}
+//	err = bridge.Run(ctx)
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/mqtt"
+)
+
+// Default topics. {imei} is replaced by the device IMEI, or the device ID
+// when the platform does not report one, {device} by the device ID and
+// {type} by the alarm type.
+const (
+	DefaultPositionTopic = "onntrack/{imei}/position"
+	DefaultAlarmTopic    = "onntrack/{imei}/alarm"
+)
+
+// DefaultInterval is the polling interval used when none is set.
+const DefaultInterval = 30 * time.Second
+
+// Publisher publishes MQTT messages. It is implemented by *mqtt.Client.
+type Publisher interface {
+	Publish(ctx context.Context, msg *mqtt.Message) error
+}
+
+// Bridge polls the platform and publishes new positions and alarms. A
+// Bridge must not be copied or polled from several goroutines at once.
+type Bridge struct {
+	Client    *onntrackclient.Client
+	Publisher Publisher
+
+	// Topics for positions and alarms; see DefaultPositionTopic and
+	// DefaultAlarmTopic.
+	PositionTopic string
+	AlarmTopic    string
+
+	// Group limits the bridge to the devices in a group.
+	Group string
+
+	// Interval is the time between polls. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// Reauthenticate, if set, is called when the platform rejects the
+	// session, after which the poll is retried once.
+	Reauthenticate func(ctx context.Context) error
+
+	// HomeAssistant, if set, announces the devices to Home Assistant
+	// through MQTT discovery and publishes their state.
+	HomeAssistant *HomeAssistant
+
+	// Logger receives poll failures. Nothing is logged when it is nil.
+	Logger *slog.Logger
+
+	// lastPosition is the time of the last published position per device.
+	lastPosition map[string]time.Time
+	alarms       *onntrackclient.AlarmPoller
+
+	// announced is the announced name, type and IMEI per device.
+	announced map[string]string
+
+	// stateTopics is the Home Assistant state topic per device, as used in
+	// its discovery configs.
+	stateTopics map[string]string
+}
+
+// Run polls every Interval until ctx is done. Failed polls are logged and
+// retried at the next interval; positions and alarms that could not be
+// published are published then.
+func (b *Bridge) Run(ctx context.Context) error {
+	interval := b.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := b.Poll(ctx)
+		if err != nil && b.Reauthenticate != nil && onntrackclient.IsAuthError(err) {
+			if err = b.Reauthenticate(ctx); err == nil {
+				err = b.Poll(ctx)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			b.logger().Warn("mqttbridge: poll failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the latest positions and new alarms once and publishes the
+// ones that have not been published yet. The first poll publishes the
+// latest position of every device but only alarms raised from then on.
+func (b *Bridge) Poll(ctx context.Context) error {
+	now := time.Now()
+	if b.lastPosition == nil {
+		b.lastPosition = make(map[string]time.Time)
+		b.alarms = &onntrackclient.AlarmPoller{Client: b.Client, Since: now}
+		b.announced = make(map[string]string)
+		b.stateTopics = make(map[string]string)
+	}
+
+	var ids []string
+	if b.Group != "" || b.HomeAssistant != nil {
+		devices, _, err := b.Client.Devices.ListAll(ctx, &onntrackclient.DeviceListOptions{Group: b.Group})
+		if err != nil {
+			return err
+		}
+		if len(devices) == 0 {
+			return nil
+		}
+		for _, d := range devices {
+			ids = append(ids, d.ID)
+		}
+		if b.HomeAssistant != nil {
+			if err := b.announce(ctx, devices); err != nil {
+				return err
+			}
+		}
+	}
+
+	positions, _, err := b.Client.Positions.Latest(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	for _, p := range positions {
+		if last, ok := b.lastPosition[p.DeviceID]; ok && !p.Time.After(last) {
+			continue
+		}
+		if err := b.publish(ctx, b.positionTopic(p), p); err != nil {
+			return err
+		}
+		if b.HomeAssistant != nil {
+			if err := b.publishState(ctx, p); err != nil {
+				return err
+			}
+		}
+		b.lastPosition[p.DeviceID] = p.Time.Time
+	}
+
+	// Alarms that fail to publish are published by the next poll
+	return b.alarms.Poll(ctx, now, ids, func(a *onntrackclient.Alarm) error {
+		return b.publish(ctx, b.alarmTopic(a), a)
+	})
+}
+
+func (b *Bridge) publish(ctx context.Context, topic string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Publisher.Publish(ctx, &mqtt.Message{Topic: topic, Payload: payload, QoS: 1})
+}
+
+func (b *Bridge) positionTopic(p *onntrackclient.Position) string {
+	topic := b.PositionTopic
+	if topic == "" {
+		topic = DefaultPositionTopic
+	}
+	return expandTopic(topic, p.DeviceID, p.IMEI, "")
+}
+
+func (b *Bridge) alarmTopic(a *onntrackclient.Alarm) string {
+	topic := b.AlarmTopic
+	if topic == "" {
+		topic = DefaultAlarmTopic
+	}
+	return expandTopic(topic, a.DeviceID, a.IMEI, a.Type)
+}
+
+// expandTopic fills in the placeholders of a topic. Values are stripped of
+// the MQTT wildcard and level separator characters.
+func expandTopic(topic, deviceID, imei, alarmType string) string {
+	if imei == "" {
+		imei = deviceID
+	}
+	return strings.NewReplacer(
+		"{imei}", topicLevel(imei),
+		"{device}", topicLevel(deviceID),
+		"{type}", topicLevel(alarmType),
+	).Replace(topic)
+}
+
+func topicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+func (b *Bridge) logger() *slog.Logger {
+	if b.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return b.Logger
+}
@@ -0,0 +1,226 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/mqtt"
+	"github.com/MaikelH/onntrackclient/mqtt/mqtttest"
+)
+
+// platform serves positions and alarms that tests can change between polls.
+type platform struct {
+	mu        sync.Mutex
+	positions string
+	alarms    string
+}
+
+func (p *platform) set(positions, alarms string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.positions, p.alarms = positions, alarms
+}
+
+func (p *platform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/positions/latest":
+		w.Write([]byte(`{"ok": true, "data": ` + p.positions + `}`))
+	case "/alarms":
+		w.Write([]byte(`{"ok": true, "data": ` + p.alarms + `}`))
+	case "/devices":
+		w.Write([]byte(`{"ok": true, "data": [{"id": "1"}]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBridge_Poll(t *testing.T) {
+	backend := &platform{}
+	backend.set(`[
+		{"deviceId": "1", "imei": "490154203237518", "lat": 52.1, "lng": 4.1, "gpsTime": "2024-05-01 12:00:00"},
+		{"deviceId": "2", "lat": 52.2, "lng": 4.2, "gpsTime": "2024-05-01 12:00:00"}
+	]`, `[]`)
+
+	// Create a test server
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	mq, err := mqtt.Dial(context.Background(), broker.Addr, nil)
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer mq.Close()
+
+	bridge := &Bridge{Client: client, Publisher: mq, AlarmTopic: "fleet/{device}/alarm/{type}"}
+
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+
+	// Device 1 moved, device 2 did not, and two alarms were raised
+	backend.set(`[
+		{"deviceId": "1", "imei": "490154203237518", "lat": 52.3, "lng": 4.3, "gpsTime": "2024-05-01 12:00:30"},
+		{"deviceId": "2", "lat": 52.2, "lng": 4.2, "gpsTime": "2024-05-01 12:00:00"}
+	]`, `[
+		{"id": "alarm-2", "deviceId": "1", "imei": "490154203237518", "alarmType": "overspeed"},
+		{"id": "alarm-1", "deviceId": "2", "alarmType": "sos"}
+	]`)
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+
+	// Nothing changed
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+
+	got := broker.Messages()
+	wantTopics := []string{
+		"onntrack/490154203237518/position",
+		"onntrack/2/position",
+		"onntrack/490154203237518/position",
+		"fleet/2/alarm/sos",
+		"fleet/1/alarm/overspeed",
+	}
+	if len(got) != len(wantTopics) {
+		t.Fatalf("broker received %d messages, want %d: %+v", len(got), len(wantTopics), got)
+	}
+	for i, msg := range got {
+		if msg.Topic != wantTopics[i] {
+			t.Errorf("message %d topic = %v, want %v", i, msg.Topic, wantTopics[i])
+		}
+		if msg.QoS != 1 {
+			t.Errorf("message %d QoS = %d, want 1", i, msg.QoS)
+		}
+	}
+
+	var position onntrackclient.Position
+	if err := json.Unmarshal(got[2].Payload, &position); err != nil {
+		t.Fatalf("position payload is not JSON: %v", err)
+	}
+	if position.Lat != 52.3 || position.Time.Second() != 30 {
+		t.Errorf("position = %+v, want the new position", position)
+	}
+}
+
+func TestBridge_Run_Reauthenticate(t *testing.T) {
+	// Create a test server that only accepts a fresh token
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true, "data": []}`))
+	}))
+	defer server.Close()
+
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL), onntrackclient.WithAPIKey("expired"))
+	mq, err := mqtt.Dial(context.Background(), broker.Addr, nil)
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer mq.Close()
+
+	reauthenticated := make(chan struct{})
+	bridge := &Bridge{
+		Client:    client,
+		Publisher: mq,
+		Interval:  time.Hour,
+		Reauthenticate: func(ctx context.Context) error {
+			client.APIKey = "fresh"
+			close(reauthenticated)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- bridge.Run(ctx) }()
+
+	select {
+	case <-reauthenticated:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not reauthenticate")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned unexpected error: %v", err)
+	}
+}
+
+func TestBridge_Poll_Group(t *testing.T) {
+	// Create a test server with 101 devices in the group, over two pages
+	var latestIDs string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices":
+			if got := r.URL.Query().Get("group"); got != "vans" {
+				t.Errorf("Expected group 'vans', got '%s'", got)
+			}
+			var devices []map[string]any
+			if r.URL.Query().Get("page") == "1" {
+				for i := 1; i <= 100; i++ {
+					devices = append(devices, map[string]any{"id": strconv.Itoa(i)})
+				}
+			} else {
+				devices = append(devices, map[string]any{"id": "101"})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": devices})
+		case "/positions/latest":
+			latestIDs = r.URL.Query().Get("deviceIds")
+			w.Write([]byte(`{"ok": true, "data": []}`))
+		case "/alarms":
+			w.Write([]byte(`{"ok": true, "data": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	mq, err := mqtt.Dial(context.Background(), broker.Addr, nil)
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer mq.Close()
+
+	bridge := &Bridge{Client: client, Publisher: mq, Group: "vans"}
+
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	if ids := strings.Split(latestIDs, ","); len(ids) != 101 || ids[100] != "101" {
+		t.Errorf("Latest requested %d devices, want all 101", len(ids))
+	}
+}
+
+func TestExpandTopic(t *testing.T) {
+	got := expandTopic("onntrack/{imei}/{device}/{type}", "dev/1", "", "geo#fence")
+	if want := "onntrack/dev_1/dev_1/geo_fence"; got != want {
+		t.Errorf("expandTopic = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,269 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+	"github.com/MaikelH/onntrackclient/mqtt"
+)
+
+// Defaults for HomeAssistant.
+const (
+	DefaultDiscoveryPrefix   = "homeassistant"
+	DefaultStateTopic        = "onntrack/{imei}/state"
+	DefaultAvailabilityTopic = "onntrack/bridge/status"
+)
+
+// Availability payloads published to the availability topic.
+const (
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+// HomeAssistant makes the bridge announce every device to Home Assistant
+// through MQTT discovery, as a device tracker with battery, speed, ACC and
+// last update sensors, and keep their state up to date.
+//
+// Set the will of the MQTT connection to PayloadOffline on the
+// availability topic, retained, so the entities become unavailable when
+// the bridge goes away:
+//
+//	will := &mqtt.Message{Topic: mqttbridge.DefaultAvailabilityTopic, Payload: []byte(mqttbridge.PayloadOffline), QoS: 1, Retain: true}
+type HomeAssistant struct {
+	// DiscoveryPrefix is the discovery prefix configured in Home
+	// Assistant. Defaults to DefaultDiscoveryPrefix.
+	DiscoveryPrefix string
+
+	// StateTopic receives the state of each device as JSON, with the same
+	// placeholders as the position topic. Defaults to DefaultStateTopic.
+	StateTopic string
+
+	// AvailabilityTopic is where the bridge publishes PayloadOnline.
+	// Defaults to DefaultAvailabilityTopic.
+	AvailabilityTopic string
+}
+
+// haDevice is the device block of a discovery config, which groups the
+// entities of one tracker in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+}
+
+// haConfig is a discovery config for one entity.
+type haConfig struct {
+	Name                string   `json:"name"`
+	UniqueID            string   `json:"unique_id"`
+	StateTopic          string   `json:"state_topic,omitempty"`
+	JSONAttributesTopic string   `json:"json_attributes_topic,omitempty"`
+	ValueTemplate       string   `json:"value_template,omitempty"`
+	DeviceClass         string   `json:"device_class,omitempty"`
+	StateClass          string   `json:"state_class,omitempty"`
+	UnitOfMeasurement   string   `json:"unit_of_measurement,omitempty"`
+	PayloadOn           string   `json:"payload_on,omitempty"`
+	PayloadOff          string   `json:"payload_off,omitempty"`
+	SourceType          string   `json:"source_type,omitempty"`
+	AvailabilityTopic   string   `json:"availability_topic"`
+	Device              haDevice `json:"device"`
+}
+
+// haState is the JSON published to the state topic. The device tracker
+// reads its location from the latitude and longitude attributes. Battery
+// and LastUpdate are left out when the position has none, so Home
+// Assistant shows them as unknown.
+type haState struct {
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Battery    *int    `json:"battery,omitempty"`
+	Speed      float64 `json:"speed"`
+	ACC        string  `json:"acc"`
+	LastUpdate string  `json:"last_update,omitempty"`
+}
+
+func (ha *HomeAssistant) discoveryPrefix() string {
+	if ha.DiscoveryPrefix == "" {
+		return DefaultDiscoveryPrefix
+	}
+	return ha.DiscoveryPrefix
+}
+
+func (ha *HomeAssistant) stateTopic(deviceID, imei string) string {
+	topic := ha.StateTopic
+	if topic == "" {
+		topic = DefaultStateTopic
+	}
+	return expandTopic(topic, deviceID, imei, "")
+}
+
+func (ha *HomeAssistant) availabilityTopic() string {
+	if ha.AvailabilityTopic == "" {
+		return DefaultAvailabilityTopic
+	}
+	return ha.AvailabilityTopic
+}
+
+// configs returns the discovery configs of a device by config topic. The
+// entities read the state of the device from stateTopic.
+func (ha *HomeAssistant) configs(d *onntrackclient.Device, stateTopic string) map[string]*haConfig {
+	id := d.IMEI
+	if id == "" {
+		id = d.ID
+	}
+	objectID := "onntrack_" + topicLevel(id)
+
+	name := d.Name
+	if name == "" {
+		name = id
+	}
+	device := haDevice{
+		Identifiers:  []string{objectID},
+		Name:         name,
+		Manufacturer: "Onntrack",
+		Model:        d.Type,
+		SerialNumber: d.IMEI,
+	}
+
+	entity := func(name, suffix string) *haConfig {
+		return &haConfig{
+			Name:              name,
+			UniqueID:          objectID + suffix,
+			AvailabilityTopic: ha.availabilityTopic(),
+			Device:            device,
+		}
+	}
+
+	tracker := entity("Location", "")
+	tracker.JSONAttributesTopic = stateTopic
+	tracker.SourceType = "gps"
+
+	battery := entity("Battery", "_battery")
+	battery.StateTopic = stateTopic
+	battery.ValueTemplate = "{{ value_json.battery | default(None) }}"
+	battery.DeviceClass = "battery"
+	battery.StateClass = "measurement"
+	battery.UnitOfMeasurement = "%"
+
+	speed := entity("Speed", "_speed")
+	speed.StateTopic = stateTopic
+	speed.ValueTemplate = "{{ value_json.speed }}"
+	speed.DeviceClass = "speed"
+	speed.StateClass = "measurement"
+	speed.UnitOfMeasurement = "km/h"
+
+	acc := entity("ACC", "_acc")
+	acc.StateTopic = stateTopic
+	acc.ValueTemplate = "{{ value_json.acc }}"
+	acc.DeviceClass = "power"
+	acc.PayloadOn, acc.PayloadOff = "ON", "OFF"
+
+	lastUpdate := entity("Last update", "_last_update")
+	lastUpdate.StateTopic = stateTopic
+	lastUpdate.ValueTemplate = "{{ value_json.last_update | default(None) }}"
+	lastUpdate.DeviceClass = "timestamp"
+
+	prefix := ha.discoveryPrefix()
+	return map[string]*haConfig{
+		prefix + "/device_tracker/" + objectID + "/config":     tracker,
+		prefix + "/sensor/" + objectID + "_battery/config":     battery,
+		prefix + "/sensor/" + objectID + "_speed/config":       speed,
+		prefix + "/binary_sensor/" + objectID + "_acc/config":  acc,
+		prefix + "/sensor/" + objectID + "_last_update/config": lastUpdate,
+	}
+}
+
+// state returns the state of a device in a position, in WGS-84.
+func (ha *HomeAssistant) state(p *onntrackclient.Position) (*haState, error) {
+	lat, lng, err := geo.Convert(p.Lat, p.Lng, p.Datum, geo.WGS84)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := "OFF"
+	if p.ACC {
+		acc = "ON"
+	}
+
+	state := &haState{
+		Latitude:  lat,
+		Longitude: lng,
+		Battery:   p.Battery,
+		Speed:     p.Speed,
+		ACC:       acc,
+	}
+	if !p.Time.IsZero() {
+		state.LastUpdate = p.Time.UTC().Format(time.RFC3339)
+	}
+	return state, nil
+}
+
+// announce publishes the availability of the bridge and the discovery
+// configs of devices that are new or changed since they were announced.
+// The availability is published at every poll, since the will may have
+// replaced it when the connection to the broker was lost.
+func (b *Bridge) announce(ctx context.Context, devices []*onntrackclient.Device) error {
+	ha := b.HomeAssistant
+
+	if err := b.Publisher.Publish(ctx, &mqtt.Message{
+		Topic:   ha.availabilityTopic(),
+		Payload: []byte(PayloadOnline),
+		QoS:     1,
+		Retain:  true,
+	}); err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		stateTopic := ha.stateTopic(d.ID, d.IMEI)
+		b.stateTopics[d.ID] = stateTopic
+
+		announced := d.Name + "\x00" + d.Type + "\x00" + d.IMEI
+		if b.announced[d.ID] == announced {
+			continue
+		}
+
+		for topic, config := range ha.configs(d, stateTopic) {
+			payload, err := json.Marshal(config)
+			if err != nil {
+				return err
+			}
+			if err := b.Publisher.Publish(ctx, &mqtt.Message{Topic: topic, Payload: payload, QoS: 1, Retain: true}); err != nil {
+				return err
+			}
+		}
+		b.announced[d.ID] = announced
+	}
+
+	return nil
+}
+
+// publishState publishes the state of a device in a new position, on the
+// state topic its discovery configs were announced with.
+func (b *Bridge) publishState(ctx context.Context, p *onntrackclient.Position) error {
+	topic, ok := b.stateTopics[p.DeviceID]
+	if !ok {
+		// No entities of the device read a state
+		return nil
+	}
+
+	state, err := b.HomeAssistant.state(p)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return b.Publisher.Publish(ctx, &mqtt.Message{
+		Topic:   topic,
+		Payload: payload,
+		QoS:     1,
+		Retain:  true,
+	})
+}
@@ -0,0 +1,173 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+	"github.com/MaikelH/onntrackclient/mqtt"
+	"github.com/MaikelH/onntrackclient/mqtt/mqtttest"
+)
+
+func TestBridge_Poll_HomeAssistant(t *testing.T) {
+	var mu sync.Mutex
+	devices := `{"ok": true, "data": [{"id": "1", "imei": "490154203237518", "name": "Van 1", "type": "GT06N"}]}`
+	positions := `{"ok": true, "data": [{"deviceId": "1", "lat": 52.1, "lng": 4.1, "speed": 42.5,
+		"battery": 80, "accStatus": "1", "gpsTime": "2024-05-01 12:00:00"}]}`
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices":
+			w.Write([]byte(devices))
+		case "/positions/latest":
+			w.Write([]byte(positions))
+		default:
+			w.Write([]byte(`{"ok": true, "data": []}`))
+		}
+	}))
+	defer server.Close()
+
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	mq, err := mqtt.Dial(context.Background(), broker.Addr, nil)
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %v", err)
+	}
+	defer mq.Close()
+
+	bridge := &Bridge{Client: client, Publisher: mq, HomeAssistant: &HomeAssistant{}}
+	for range 2 {
+		if err := bridge.Poll(context.Background()); err != nil {
+			t.Fatalf("Poll returned unexpected error: %v", err)
+		}
+	}
+
+	// An unchanged device is announced once
+	retained := broker.Retained()
+	configTopics := []string{
+		"homeassistant/device_tracker/onntrack_490154203237518/config",
+		"homeassistant/sensor/onntrack_490154203237518_battery/config",
+		"homeassistant/sensor/onntrack_490154203237518_speed/config",
+		"homeassistant/binary_sensor/onntrack_490154203237518_acc/config",
+		"homeassistant/sensor/onntrack_490154203237518_last_update/config",
+	}
+	for _, topic := range configTopics {
+		if _, ok := retained[topic]; !ok {
+			t.Errorf("no retained config on %v", topic)
+		}
+	}
+	configs := 0
+	for _, msg := range broker.Messages() {
+		if msg.Topic == configTopics[0] {
+			configs++
+		}
+	}
+	if configs != 1 {
+		t.Errorf("device tracker announced %d times, want 1", configs)
+	}
+
+	var tracker map[string]any
+	if err := json.Unmarshal(retained[configTopics[0]].Payload, &tracker); err != nil {
+		t.Fatalf("config payload is not JSON: %v", err)
+	}
+	if tracker["json_attributes_topic"] != "onntrack/490154203237518/state" {
+		t.Errorf("json_attributes_topic = %v, want the state topic", tracker["json_attributes_topic"])
+	}
+	if tracker["availability_topic"] != DefaultAvailabilityTopic {
+		t.Errorf("availability_topic = %v, want %v", tracker["availability_topic"], DefaultAvailabilityTopic)
+	}
+	device := tracker["device"].(map[string]any)
+	if device["name"] != "Van 1" || device["model"] != "GT06N" {
+		t.Errorf("device = %v, want name Van 1 and model GT06N", device)
+	}
+
+	if got := string(retained[DefaultAvailabilityTopic].Payload); got != PayloadOnline {
+		t.Errorf("availability = %v, want %v", got, PayloadOnline)
+	}
+
+	// The position has no IMEI; the state topic uses the one of the device
+	var state haState
+	if err := json.Unmarshal(retained["onntrack/490154203237518/state"].Payload, &state); err != nil {
+		t.Fatalf("state payload is not JSON: %v", err)
+	}
+	battery := 80
+	want := haState{Latitude: 52.1, Longitude: 4.1, Battery: &battery, Speed: 42.5, ACC: "ON", LastUpdate: "2024-05-01T12:00:00Z"}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("state = %+v, want %+v", state, want)
+	}
+
+	// A renamed device is announced again
+	mu.Lock()
+	devices = `{"ok": true, "data": [{"id": "1", "imei": "490154203237518", "name": "Van 2", "type": "GT06N"}]}`
+	mu.Unlock()
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	if err := json.Unmarshal(broker.Retained()[configTopics[0]].Payload, &tracker); err != nil {
+		t.Fatalf("config payload is not JSON: %v", err)
+	}
+	if name := tracker["device"].(map[string]any)["name"]; name != "Van 2" {
+		t.Errorf("device name = %v, want Van 2", name)
+	}
+
+	// A position with another IMEI updates the state the entities read
+	mu.Lock()
+	positions = `{"ok": true, "data": [{"deviceId": "1", "imei": "352099001761481", "lat": 52.2, "lng": 4.2,
+		"gpsTime": "2024-05-01 12:01:00"}]}`
+	mu.Unlock()
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	retained = broker.Retained()
+	if _, ok := retained["onntrack/352099001761481/state"]; ok {
+		t.Error("state published on the topic of the position IMEI")
+	}
+	if err := json.Unmarshal(retained["onntrack/490154203237518/state"].Payload, &state); err != nil {
+		t.Fatalf("state payload is not JSON: %v", err)
+	}
+	if state.Latitude != 52.2 {
+		t.Errorf("Latitude = %v, want 52.2", state.Latitude)
+	}
+}
+
+func TestHomeAssistant_State(t *testing.T) {
+	ha := &HomeAssistant{}
+	flat := 0
+	at := onntrackclient.Timestamp{Time: time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))}
+
+	tests := []struct {
+		p    *onntrackclient.Position
+		want string
+	}{
+		// A flat battery is reported; a missing one and a missing time are not
+		{&onntrackclient.Position{Lat: 52.1, Lng: 4.1, Datum: geo.WGS84, Battery: &flat, Time: at},
+			`{"latitude":52.1,"longitude":4.1,"battery":0,"speed":0,"acc":"OFF","last_update":"2024-05-01T12:00:00Z"}`},
+		{&onntrackclient.Position{Lat: 52.1, Lng: 4.1, Datum: geo.WGS84},
+			`{"latitude":52.1,"longitude":4.1,"speed":0,"acc":"OFF"}`},
+	}
+
+	for _, tt := range tests {
+		state, err := ha.state(tt.p)
+		if err != nil {
+			t.Fatalf("state returned unexpected error: %v", err)
+		}
+		data, _ := json.Marshal(state)
+		if string(data) != tt.want {
+			t.Errorf("state = %s, want %s", data, tt.want)
+		}
+	}
+}
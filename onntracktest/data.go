@@ -0,0 +1,392 @@
+package onntracktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// AddDevice adds a device and returns a copy of it as stored. A device
+// without an ID is given one.
+func (s *Server) AddDevice(d *onntrackclient.Device) *onntrackclient.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	device := *d
+	if device.ID == "" {
+		device.ID = s.newID()
+	}
+	s.devices = append(s.devices, &device)
+
+	stored := device
+	return &stored
+}
+
+// Device returns a copy of a device, or nil if there is no such device.
+func (s *Server) Device(id string) *onntrackclient.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.device(id); d != nil {
+		device := *d
+		return &device
+	}
+	return nil
+}
+
+// AddPosition adds a position to the history of its device. The position
+// with the latest time is the latest position of the device.
+func (s *Server) AddPosition(p *onntrackclient.Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position := *p
+	if position.IMEI == "" {
+		if d := s.device(position.DeviceID); d != nil {
+			position.IMEI = d.IMEI
+		}
+	}
+
+	history := s.positions[position.DeviceID]
+	i, _ := slices.BinarySearchFunc(history, position.Time.Time, func(p *onntrackclient.Position, t time.Time) int {
+		if p.Time.After(t) {
+			return 1
+		}
+		return -1
+	})
+	s.positions[position.DeviceID] = slices.Insert(history, i, &position)
+}
+
+// AddAlarm adds an alarm. An alarm without an ID is given one.
+func (s *Server) AddAlarm(a *onntrackclient.Alarm) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alarm := *a
+	if alarm.ID == "" {
+		alarm.ID = "alarm-" + s.newID()
+	}
+	if alarm.IMEI == "" {
+		if d := s.device(alarm.DeviceID); d != nil {
+			alarm.IMEI = d.IMEI
+		}
+	}
+	s.alarms = append(s.alarms, &alarm)
+}
+
+// newID returns the next free ID. The caller must hold s.mu.
+func (s *Server) newID() string {
+	for {
+		id := strconv.Itoa(s.nextID)
+		s.nextID++
+		if s.device(id) == nil {
+			return id
+		}
+	}
+}
+
+// device returns the stored device with an ID. The caller must hold s.mu.
+func (s *Server) device(id string) *onntrackclient.Device {
+	for _, d := range s.devices {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := []*onntrackclient.Device{}
+	for _, d := range s.devices {
+		if status := q.Get("status"); status != "" && d.Status != status {
+			continue
+		}
+		if group := q.Get("group"); group != "" && d.Group != group {
+			continue
+		}
+		devices = append(devices, d)
+	}
+
+	writeData(w, paginate(devices, q, "page", "per_page"))
+}
+
+func (s *Server) getDevice(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.device(id)
+	if d == nil {
+		writeError(w, http.StatusOK, CodeNotFound, "device not found")
+		return
+	}
+	writeData(w, d)
+}
+
+func (s *Server) createDevice(w http.ResponseWriter, body []byte) {
+	var req onntrackclient.DeviceCreateRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.IMEI == "" {
+		writeError(w, http.StatusOK, CodeInvalidRequest, "imei is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.devices {
+		if d.IMEI == req.IMEI {
+			writeError(w, http.StatusOK, CodeInvalidRequest, "device already exists")
+			return
+		}
+	}
+
+	d := &onntrackclient.Device{
+		ID:    s.newID(),
+		Name:  req.Name,
+		Type:  req.Type,
+		IMEI:  req.IMEI,
+		Group: req.Group,
+		SIM:   req.SIM,
+		ICCID: req.ICCID,
+	}
+	s.devices = append(s.devices, d)
+	writeData(w, d)
+}
+
+func (s *Server) updateDevice(w http.ResponseWriter, id string, body []byte) {
+	var req onntrackclient.DeviceUpdateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusOK, CodeInvalidRequest, "invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.device(id)
+	if d == nil {
+		writeError(w, http.StatusOK, CodeNotFound, "device not found")
+		return
+	}
+
+	// Only the fields that are set are changed
+	for _, f := range []struct{ dst, src *string }{
+		{&d.Name, &req.Name},
+		{&d.Type, &req.Type},
+		{&d.Status, &req.Status},
+		{&d.Group, &req.Group},
+		{&d.SIM, &req.SIM},
+		{&d.ICCID, &req.ICCID},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	writeData(w, d)
+}
+
+func (s *Server) deleteDevice(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.devices, func(d *onntrackclient.Device) bool { return d.ID == id })
+	if i < 0 {
+		writeError(w, http.StatusOK, CodeNotFound, "device not found")
+		return
+	}
+	s.devices = slices.Delete(s.devices, i, i+1)
+	delete(s.positions, id)
+	writeData(w, nil)
+}
+
+// wirePosition is a position as the platform reports it.
+type wirePosition struct {
+	DeviceID  string  `json:"deviceId"`
+	IMEI      string  `json:"imei,omitempty"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	Speed     float64 `json:"speed"`
+	Course    float64 `json:"course"`
+	Altitude  float64 `json:"altitude"`
+	Battery   *int    `json:"battery,omitempty"`
+	ACCStatus string  `json:"accStatus"`
+	GPSTime   string  `json:"gpsTime"`
+	MapType   string  `json:"mapType"`
+}
+
+func toWirePosition(p *onntrackclient.Position) *wirePosition {
+	acc := "0"
+	if p.ACC {
+		acc = "1"
+	}
+	return &wirePosition{
+		DeviceID:  p.DeviceID,
+		IMEI:      p.IMEI,
+		Lat:       p.Lat,
+		Lng:       p.Lng,
+		Speed:     p.Speed,
+		Course:    p.Course,
+		Altitude:  p.Altitude,
+		Battery:   p.Battery,
+		ACCStatus: acc,
+		GPSTime:   p.Time.UTC().Format(onntrackclient.TimeLayout),
+		MapType:   string(p.Datum),
+	}
+}
+
+func (s *Server) latestPositions(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	if v := r.URL.Query().Get("deviceIds"); v != "" {
+		ids = strings.Split(v, ",")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ids == nil {
+		for id := range s.positions {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+	}
+
+	latest := []*wirePosition{}
+	for _, id := range ids {
+		if history := s.positions[id]; len(history) > 0 {
+			latest = append(latest, toWirePosition(history[len(history)-1]))
+		}
+	}
+	writeData(w, latest)
+}
+
+func (s *Server) positionHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := timeRange(q)
+	if err != nil || q.Get("deviceId") == "" {
+		writeError(w, http.StatusOK, CodeInvalidRequest, "invalid query")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := []*wirePosition{}
+	for _, p := range s.positions[q.Get("deviceId")] {
+		if inRange(p.Time.Time, from, to) {
+			history = append(history, toWirePosition(p))
+		}
+	}
+	writeData(w, paginate(history, q, "page", "pageSize"))
+}
+
+// wireAlarm is an alarm as the platform reports it.
+type wireAlarm struct {
+	ID        string  `json:"id"`
+	DeviceID  string  `json:"deviceId"`
+	IMEI      string  `json:"imei,omitempty"`
+	AlarmType string  `json:"alarmType"`
+	AlarmName string  `json:"alarmName"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	MapType   string  `json:"mapType"`
+	AlarmTime string  `json:"alarmTime"`
+}
+
+func (s *Server) listAlarms(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := timeRange(q)
+	if err != nil {
+		writeError(w, http.StatusOK, CodeInvalidRequest, "invalid query")
+		return
+	}
+	var ids []string
+	if v := q.Get("deviceIds"); v != "" {
+		ids = strings.Split(v, ",")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []*onntrackclient.Alarm
+	for _, a := range s.alarms {
+		if ids != nil && !slices.Contains(ids, a.DeviceID) {
+			continue
+		}
+		if t := q.Get("alarmType"); t != "" && a.Type != t {
+			continue
+		}
+		if !inRange(a.Time.Time, from, to) {
+			continue
+		}
+		matches = append(matches, a)
+	}
+
+	// Alarms are listed newest first
+	slices.SortStableFunc(matches, func(a, b *onntrackclient.Alarm) int {
+		return b.Time.Compare(a.Time.Time)
+	})
+
+	alarms := []*wireAlarm{}
+	for _, a := range matches {
+		alarms = append(alarms, &wireAlarm{
+			ID:        a.ID,
+			DeviceID:  a.DeviceID,
+			IMEI:      a.IMEI,
+			AlarmType: a.Type,
+			AlarmName: a.Name,
+			Lat:       a.Lat,
+			Lng:       a.Lng,
+			MapType:   string(a.Datum),
+			AlarmTime: a.Time.UTC().Format(onntrackclient.TimeLayout),
+		})
+	}
+	writeData(w, paginate(alarms, q, "page", "pageSize"))
+}
+
+// timeRange parses the startTime and endTime query parameters.
+func timeRange(q url.Values) (from, to time.Time, err error) {
+	if v := q.Get("startTime"); v != "" {
+		if from, err = time.Parse(onntrackclient.TimeLayout, v); err != nil {
+			return
+		}
+	}
+	if v := q.Get("endTime"); v != "" {
+		to, err = time.Parse(onntrackclient.TimeLayout, v)
+	}
+	return
+}
+
+// inRange reports whether t is at or after from and before to. Zero times
+// leave the range open.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// paginate returns the requested page of items. Without a page size all
+// items are returned.
+func paginate[T any](items []T, q url.Values, pageKey, sizeKey string) []T {
+	size, _ := strconv.Atoi(q.Get(sizeKey))
+	if size <= 0 {
+		return items
+	}
+	page, _ := strconv.Atoi(q.Get(pageKey))
+	if page < 1 {
+		page = 1
+	}
+
+	start := (page - 1) * size
+	if start >= len(items) {
+		return items[:0]
+	}
+	return items[start:min(start+size, len(items))]
+}
@@ -0,0 +1,101 @@
+package onntracktest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// Metrics is an in-memory onntrackclient.Metrics that keeps every
+// observation. Its zero value is ready to use.
+type Metrics struct {
+	mu       sync.Mutex
+	requests []onntrackclient.RequestInfo
+}
+
+// ObserveRequest implements onntrackclient.Metrics.
+func (m *Metrics) ObserveRequest(_ context.Context, info onntrackclient.RequestInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, info)
+}
+
+// Requests returns the observed requests, oldest first.
+func (m *Metrics) Requests() []onntrackclient.RequestInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]onntrackclient.RequestInfo(nil), m.requests...)
+}
+
+// Endpoint returns the observed requests with the given method and endpoint
+// template.
+func (m *Metrics) Endpoint(method, endpoint string) []onntrackclient.RequestInfo {
+	var matches []onntrackclient.RequestInfo
+	for _, info := range m.Requests() {
+		if info.Method == method && info.Endpoint == endpoint {
+			matches = append(matches, info)
+		}
+	}
+	return matches
+}
+
+// Span is a span recorded by Tracer.
+type Span struct {
+	Endpoint string
+	Method   string
+
+	// Info is the outcome the span was ended with. It is the zero value
+	// while the span is open.
+	Info  onntrackclient.RequestInfo
+	Ended bool
+
+	tracer *Tracer
+}
+
+// End implements onntrackclient.Span.
+func (s *Span) End(info onntrackclient.RequestInfo) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.Info, s.Ended = info, true
+}
+
+// Tracer is an in-memory onntrackclient.Tracer that keeps every span. Its
+// zero value is ready to use.
+type Tracer struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// spanKey is the context key of the span of a request.
+type spanKey struct{}
+
+// StartSpan implements onntrackclient.Tracer. The span can be retrieved
+// from the returned context with SpanFromContext.
+func (t *Tracer) StartSpan(ctx context.Context, endpoint, method string) (context.Context, onntrackclient.Span) {
+	span := &Span{Endpoint: endpoint, Method: method, tracer: t}
+
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Spans returns copies of the spans started so far, oldest first.
+func (t *Tracer) Spans() []Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]Span, len(t.spans))
+	for i, s := range t.spans {
+		spans[i] = *s
+	}
+	return spans
+}
+
+// SpanFromContext returns the span a Tracer started for a request, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
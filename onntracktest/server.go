@@ -0,0 +1,418 @@
+// Package onntracktest provides an in-process fake of the Onntrack platform
+// for tests.
+//
+// The fake keeps accounts, devices, positions and alarms in memory and
+// serves them in the platform's response envelope. Faults such as latency,
+// server errors and expired sessions can be injected, and every request is
+// recorded for assertions:
+//
+//	srv := onntracktest.NewServer()
+//	defer srv.Close()
+//	srv.AddDevice(&onntrackclient.Device{ID: "1", IMEI: "490154203237518"})
+//
+//	client := srv.Client()
+//	devices, _, err := client.Devices.List(ctx, nil)
+//	srv.AssertCalled(t, http.MethodGet, "devices", 1)
+package onntracktest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// Default credentials of the account every Server starts with.
+const (
+	DefaultAccount  = "test@example.com"
+	DefaultPassword = "password"
+)
+
+// Codes the fake returns in the envelope of failed requests.
+const (
+	CodeBadCredentials  = 1001
+	CodeCaptchaRequired = 1002
+	CodeNotFound        = 1004
+	CodeInvalidRequest  = 1005
+	CodeTokenExpired    = 4010
+	CodeServerError     = 5000
+)
+
+// TokenTTL is how long tokens issued by the fake are valid.
+const TokenTTL = time.Hour
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+
+	// Path is the path relative to the API root, such as "devices/1".
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Fault makes a Server misbehave.
+type Fault struct {
+	// Path limits the fault to requests for this path relative to the API
+	// root, such as "devices" or "positions/latest". Empty matches all
+	// requests.
+	Path string
+
+	// Latency delays the response.
+	Latency time.Duration
+
+	// Status, if set, is returned instead of the normal response, with an
+	// error envelope.
+	Status int
+
+	// Times is the number of requests the fault applies to. Zero applies
+	// it until ClearFaults is called.
+	Times int
+}
+
+// Server is a fake Onntrack platform. Its methods are safe for concurrent
+// use.
+type Server struct {
+	// URL is the API root of the server, ending in a slash.
+	URL string
+
+	server *httptest.Server
+
+	mu        sync.Mutex
+	accounts  map[string]string
+	captcha   string
+	loginCode int
+	loginMsg  string
+	tokens    map[string]time.Time
+	devices   []*onntrackclient.Device
+	nextID    int
+	positions map[string][]*onntrackclient.Position
+	alarms    []*onntrackclient.Alarm
+	faults    []*Fault
+	requests  []*Request
+	etags     bool
+}
+
+// NewServer starts a fake platform with the account DefaultAccount.
+func NewServer() *Server {
+	s := &Server{
+		accounts:  map[string]string{DefaultAccount: DefaultPassword},
+		tokens:    make(map[string]time.Time),
+		nextID:    1,
+		positions: make(map[string][]*onntrackclient.Position),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL + "/"
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a client for the server, logged in to DefaultAccount.
+func (s *Server) Client(options ...onntrackclient.ClientOption) *onntrackclient.Client {
+	options = append([]onntrackclient.ClientOption{
+		onntrackclient.WithBaseURL(s.URL),
+		onntrackclient.WithAPIKey(s.IssueToken(DefaultAccount)),
+	}, options...)
+
+	client, err := onntrackclient.NewClient(options...)
+	if err != nil {
+		panic("onntracktest: " + err.Error())
+	}
+	return client
+}
+
+// AddAccount adds an account that can log in, or changes its password.
+func (s *Server) AddAccount(account, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[account] = password
+}
+
+// RequireCaptcha makes logins fail with CodeCaptchaRequired unless the
+// request carries code as its ValidCode. An empty code turns the check off.
+func (s *Server) RequireCaptcha(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.captcha = code
+}
+
+// FailLogins makes every login fail with the given code and message, even
+// with valid credentials. A zero code makes logins work again.
+func (s *Server) FailLogins(code int, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginCode, s.loginMsg = code, msg
+}
+
+// IssueToken returns a valid token for an account, as if it had logged in.
+// Tokens are unsigned JWTs with the account as subject.
+func (s *Server) IssueToken(account string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueToken(account)
+}
+
+func (s *Server) issueToken(account string) string {
+	expires := time.Now().Add(TokenTTL)
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+
+	claims, _ := json.Marshal(map[string]any{"sub": account, "exp": expires.Unix(), "jti": hex.EncodeToString(nonce)})
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims) + "."
+	s.tokens[token] = expires
+	return token
+}
+
+// ExpireTokens invalidates every token issued so far. Requests with them
+// fail with 401 Unauthorized and CodeTokenExpired until the client logs in
+// again.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.tokens)
+}
+
+// EnableETags makes GET responses carry an ETag and answers requests
+// whose If-None-Match header holds the current ETag with 304 Not Modified.
+func (s *Server) EnableETags() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags = true
+}
+
+// AddFault injects a fault.
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received so far, oldest first.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// Count returns how many requests were received with the given method and
+// path relative to the API root.
+func (s *Server) Count(method, path string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Method == method && r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// AssertCalled reports a test error unless the server received exactly
+// times requests with the given method and path.
+func (s *Server) AssertCalled(t testing.TB, method, path string, times int) {
+	t.Helper()
+	if n := s.Count(method, path); n != times {
+		t.Errorf("%s %s was called %d times, want %d", method, path, n, times)
+	}
+}
+
+// ResetRequests forgets the requests received so far.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// envelope is the platform's response envelope.
+type envelope struct {
+	OK   bool   `json:"ok"`
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data"`
+}
+
+func writeData(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&envelope{OK: true, Data: data})
+}
+
+// writeError writes an error envelope. Errors the platform reports in the
+// envelope use status 200.
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&envelope{Code: code, Msg: msg})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, &Request{
+		Method: r.Method,
+		Path:   path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	latency, status := s.fault(path)
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		writeError(w, status, CodeServerError, http.StatusText(status))
+		return
+	}
+
+	if path == "homepage/login" && r.Method == http.MethodPost {
+		s.login(w, body)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, CodeTokenExpired, "token expired")
+		return
+	}
+
+	s.mu.Lock()
+	etags := s.etags
+	s.mu.Unlock()
+	if !etags || r.Method != http.MethodGet {
+		s.route(w, r, path, body)
+		return
+	}
+
+	// The ETag is a hash of the response
+	rec := httptest.NewRecorder()
+	s.route(rec, r, path, body)
+	sum := sha256.Sum256(rec.Body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	maps.Copy(w.Header(), rec.Header())
+	w.Header().Set("ETag", etag)
+	if rec.Code == http.StatusOK && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+// fault returns the latency and status of the faults matching a path and
+// uses them up. The caller must hold s.mu.
+func (s *Server) fault(path string) (time.Duration, int) {
+	var latency time.Duration
+	status := 0
+	kept := s.faults[:0]
+	for _, f := range s.faults {
+		if f.Path == "" || f.Path == path {
+			latency += f.Latency
+			if status == 0 {
+				status = f.Status
+			}
+			if f.Times > 0 {
+				f.Times--
+				if f.Times == 0 {
+					continue
+				}
+			}
+		}
+		kept = append(kept, f)
+	}
+	s.faults = kept
+	return latency, status
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[token]
+	return ok && time.Now().Before(expires)
+}
+
+func (s *Server) login(w http.ResponseWriter, body []byte) {
+	var req onntrackclient.LoginRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusOK, CodeInvalidRequest, "invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch password, ok := s.accounts[req.Account]; {
+	case s.loginCode != 0:
+		writeError(w, http.StatusOK, s.loginCode, s.loginMsg)
+	case s.captcha != "" && req.ValidCode != s.captcha:
+		writeError(w, http.StatusOK, CodeCaptchaRequired, "verification code required")
+	case !ok || password != req.Password:
+		writeError(w, http.StatusOK, CodeBadCredentials, "incorrect account or password")
+	default:
+		writeData(w, map[string]any{"token": s.issueToken(req.Account), "upgradeTips": false})
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	switch {
+	case path == "devices" && r.Method == http.MethodGet:
+		s.listDevices(w, r)
+	case path == "devices" && r.Method == http.MethodPost:
+		s.createDevice(w, body)
+	case strings.HasPrefix(path, "devices/"):
+		id := strings.TrimPrefix(path, "devices/")
+		switch r.Method {
+		case http.MethodGet:
+			s.getDevice(w, id)
+		case http.MethodPut:
+			s.updateDevice(w, id, body)
+		case http.MethodDelete:
+			s.deleteDevice(w, id)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, CodeInvalidRequest, "method not allowed")
+		}
+	case path == "positions/latest" && r.Method == http.MethodGet:
+		s.latestPositions(w, r)
+	case path == "positions/history" && r.Method == http.MethodGet:
+		s.positionHistory(w, r)
+	case path == "alarms" && r.Method == http.MethodGet:
+		s.listAlarms(w, r)
+	default:
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("no such endpoint: %s %s", r.Method, path))
+	}
+}
@@ -0,0 +1,195 @@
+package onntracktest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+)
+
+func TestServer_Login(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(srv.URL))
+	login := func(password, captcha string) *onntrackclient.LoginResponse {
+		t.Helper()
+		loginResp, _, err := client.Auth.Login(context.Background(), &onntrackclient.LoginRequest{
+			Account:   onntracktest.DefaultAccount,
+			Password:  password,
+			ValidCode: captcha,
+		})
+		if err != nil {
+			t.Fatalf("Login returned unexpected error: %v", err)
+		}
+		return loginResp
+	}
+
+	if resp := login("wrong", ""); resp.OK || resp.Code != onntracktest.CodeBadCredentials {
+		t.Errorf("Login with a wrong password = %+v, want code %d", resp, onntracktest.CodeBadCredentials)
+	}
+
+	srv.RequireCaptcha("1234")
+	if resp := login(onntracktest.DefaultPassword, ""); resp.OK || resp.Code != onntracktest.CodeCaptchaRequired {
+		t.Errorf("Login without captcha = %+v, want code %d", resp, onntracktest.CodeCaptchaRequired)
+	}
+	if resp := login(onntracktest.DefaultPassword, "1234"); !resp.OK || resp.Data.Token == "" {
+		t.Errorf("Login with captcha = %+v, want a token", resp)
+	}
+	srv.RequireCaptcha("")
+
+	srv.FailLogins(9999, "maintenance")
+	if resp := login(onntracktest.DefaultPassword, ""); resp.OK || resp.Msg != "maintenance" {
+		t.Errorf("Login during failure = %+v, want maintenance", resp)
+	}
+	srv.FailLogins(0, "")
+
+	// The token of a successful login is accepted
+	if resp := login(onntracktest.DefaultPassword, ""); !resp.OK {
+		t.Fatalf("Login = %+v, want ok", resp)
+	}
+	if _, _, err := client.Devices.List(context.Background(), nil); err != nil {
+		t.Errorf("List after login returned unexpected error: %v", err)
+	}
+
+	srv.AssertCalled(t, http.MethodPost, "homepage/login", 5)
+}
+
+func TestServer_Devices(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{Name: "Van 1", IMEI: "490154203237518", Group: "Delivery", Status: "active"})
+
+	client := srv.Client()
+	ctx := context.Background()
+
+	created, _, err := client.Devices.Create(ctx, &onntrackclient.DeviceCreateRequest{Name: "Van 2", IMEI: "352099001761481"})
+	if err != nil {
+		t.Fatalf("Create returned unexpected error: %v", err)
+	}
+	if created.ID == "" || created.Name != "Van 2" {
+		t.Errorf("Create = %+v, want Van 2 with an ID", created)
+	}
+
+	// A duplicate IMEI is rejected in the envelope
+	_, _, err = client.Devices.Create(ctx, &onntrackclient.DeviceCreateRequest{Name: "Copy", IMEI: "352099001761481"})
+	var errResp *onntrackclient.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Code != "1005" {
+		t.Errorf("Create of a duplicate returned %v, want code 1005", err)
+	}
+
+	if _, _, err := client.Devices.Update(ctx, created.ID, &onntrackclient.DeviceUpdateRequest{Group: "Delivery"}); err != nil {
+		t.Fatalf("Update returned unexpected error: %v", err)
+	}
+	if d := srv.Device(created.ID); d.Group != "Delivery" || d.Name != "Van 2" {
+		t.Errorf("updated device = %+v, want group Delivery and the old name", d)
+	}
+
+	devices, _, err := client.Devices.List(ctx, &onntrackclient.DeviceListOptions{Group: "Delivery"})
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Errorf("List returned %d devices, want 2", len(devices))
+	}
+
+	if _, err := client.Devices.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Delete returned unexpected error: %v", err)
+	}
+	if _, _, err := client.Devices.Get(ctx, created.ID); err == nil {
+		t.Error("Get of a deleted device expected error, got nil")
+	}
+}
+
+func TestServer_PositionsAndAlarms(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	srv.AddDevice(&onntrackclient.Device{ID: "1", IMEI: "490154203237518"})
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 4; i >= 0; i-- {
+		srv.AddPosition(&onntrackclient.Position{DeviceID: "1", Lat: 52 + float64(i)/10, Lng: 4, ACC: i%2 == 0,
+			Time: onntrackclient.Timestamp{Time: start.Add(time.Duration(i) * time.Minute)}})
+	}
+	srv.AddAlarm(&onntrackclient.Alarm{DeviceID: "1", Type: "sos", Time: onntrackclient.Timestamp{Time: start}})
+	srv.AddAlarm(&onntrackclient.Alarm{DeviceID: "1", Type: "overspeed", Time: onntrackclient.Timestamp{Time: start.Add(time.Minute)}})
+
+	client := srv.Client()
+	ctx := context.Background()
+
+	latest, _, err := client.Positions.Latest(ctx)
+	if err != nil {
+		t.Fatalf("Latest returned unexpected error: %v", err)
+	}
+	if len(latest) != 1 || !latest[0].Time.Equal(start.Add(4*time.Minute)) || latest[0].IMEI != "490154203237518" || !latest[0].ACC {
+		t.Errorf("Latest = %+v, want the position at 12:04", latest)
+	}
+
+	var history []*onntrackclient.Position
+	opts := &onntrackclient.HistoryOptions{From: start.Add(time.Minute), PerPage: 2}
+	err = client.Positions.WalkHistory(ctx, "1", opts, func(page []*onntrackclient.Position) error {
+		history = append(history, page...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkHistory returned unexpected error: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("WalkHistory returned %d positions, want 4", len(history))
+	}
+	if !history[0].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("first position at %v, want 12:01", history[0].Time)
+	}
+	srv.AssertCalled(t, http.MethodGet, "positions/history", 3)
+
+	alarms, _, err := client.Alarms.List(ctx, &onntrackclient.AlarmListOptions{DeviceIDs: []string{"1"}})
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	if len(alarms) != 2 || alarms[0].Type != "overspeed" {
+		t.Errorf("List = %+v, want overspeed first", alarms)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	srv := onntracktest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	// A server error for the next request only
+	srv.AddFault(onntracktest.Fault{Path: "devices", Status: http.StatusBadGateway, Times: 1})
+	_, resp, err := client.Devices.List(ctx, nil)
+	if err == nil || resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("List during fault = %v, %v, want 502", resp, err)
+	}
+	if _, _, err := client.Devices.List(ctx, nil); err != nil {
+		t.Errorf("List after fault returned unexpected error: %v", err)
+	}
+
+	// Latency runs into the client's deadline
+	srv.AddFault(onntracktest.Fault{Latency: time.Second})
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := client.Devices.List(timeout, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("List with latency returned %v, want deadline exceeded", err)
+	}
+	srv.ClearFaults()
+
+	// Expired tokens are rejected with 401
+	srv.ExpireTokens()
+	_, resp, err = client.Devices.List(ctx, nil)
+	var errResp *onntrackclient.ErrorResponse
+	if !errors.As(err, &errResp) || resp.StatusCode != http.StatusUnauthorized || errResp.Message != "token expired" {
+		t.Errorf("List with an expired token = %v, want 401 token expired", err)
+	}
+
+	requests := srv.Requests()
+	if last := requests[len(requests)-1]; last.Header.Get("Authorization") == "" {
+		t.Error("recorded request has no Authorization header")
+	}
+}
@@ -0,0 +1,239 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+// PositionsService handles communication with the position related
+// methods of the Onntrack API.
+type PositionsService service
+
+// Position represents a location reported by a device.
+type Position struct {
+	DeviceID string  `json:"deviceId"`
+	IMEI     string  `json:"imei"`
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+
+	// Speed in km/h
+	Speed float64 `json:"speed"`
+
+	// Course in degrees clockwise from north
+	Course float64 `json:"course"`
+
+	// Altitude in metres
+	Altitude float64 `json:"altitude"`
+
+	// Battery charge in percent, nil when the device does not report it
+	Battery *int `json:"battery,omitempty"`
+
+	// ACC is whether the ignition is on, false when the device does not
+	// report it
+	ACC bool `json:"acc"`
+
+	// Time is when the device recorded the position.
+	Time Timestamp `json:"gpsTime"`
+
+	// Datum is the datum Lat and Lng are expressed in.
+	Datum geo.Datum `json:"datum"`
+
+	// Address is filled in when the client has a ReverseGeocoder.
+	Address string `json:"address,omitempty"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The platform
+// reports the datum as a map type; positions without one are WGS-84. The
+// ignition state is reported as accStatus, as a number, string or boolean.
+func (p *Position) UnmarshalJSON(data []byte) error {
+	type alias Position
+	aux := struct {
+		*alias
+		MapType   string          `json:"mapType"`
+		ACCStatus json.RawMessage `json:"accStatus"`
+	}{alias: (*alias)(p)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if p.Datum == "" {
+		p.Datum = datumForMapType(aux.MapType)
+	}
+
+	switch strings.Trim(string(aux.ACCStatus), `"`) {
+	case "1", "true", "on", "ON":
+		p.ACC = true
+	}
+
+	return nil
+}
+
+// datumForMapType returns the datum of coordinates the platform returns for
+// the given map type. Unknown map types are taken to be WGS-84, the datum of
+// the raw GPS fix, so they do not fail the whole response.
+func datumForMapType(mapType string) geo.Datum {
+	switch strings.ToUpper(mapType) {
+	case "GOOGLE", "AMAP", "GCJ02":
+		return geo.GCJ02
+	case "BAIDU", "BD09":
+		return geo.BD09
+	default:
+		return geo.WGS84
+	}
+}
+
+// WithPositionDatum returns a ClientOption that converts all returned
+// positions to the given datum. Use geo.WGS84 to draw positions on
+// OpenStreetMap and other maps outside China.
+func WithPositionDatum(datum geo.Datum) ClientOption {
+	return func(c *Client) error {
+		if !datum.Valid() {
+			return fmt.Errorf("unknown datum %q", datum)
+		}
+		c.positionDatum = datum
+		return nil
+	}
+}
+
+// convertPositions converts positions to the datum configured with
+// WithPositionDatum, if any.
+func (c *Client) convertPositions(positions []*Position) error {
+	if c.positionDatum == "" {
+		return nil
+	}
+
+	for _, p := range positions {
+		lat, lng, err := geo.Convert(p.Lat, p.Lng, p.Datum, c.positionDatum)
+		if err != nil {
+			return err
+		}
+		p.Lat, p.Lng, p.Datum = lat, lng, c.positionDatum
+	}
+
+	return nil
+}
+
+// Latest returns the most recent position of each of the given devices, or
+// of all devices if none are given.
+//
+// Endpoint: positions/latest
+func (s *PositionsService) Latest(ctx context.Context, deviceIDs ...string) ([]*Position, *http.Response, error) {
+	u := "positions/latest"
+	if len(deviceIDs) > 0 {
+		params := url.Values{}
+		params.Set("deviceIds", strings.Join(deviceIDs, ","))
+		u += "?" + params.Encode()
+	}
+
+	return s.list(ctx, u)
+}
+
+// HistoryOptions specifies the optional parameters to the
+// PositionsService.History method.
+type HistoryOptions struct {
+	// Only return positions recorded at or after From
+	From time.Time
+
+	// Only return positions recorded before To
+	To time.Time
+
+	// Page number for pagination
+	Page int
+
+	// Number of results per page
+	PerPage int
+}
+
+// History returns the positions recorded by a device, oldest first.
+//
+// Endpoint: positions/history
+func (s *PositionsService) History(ctx context.Context, deviceID string, opts *HistoryOptions) ([]*Position, *http.Response, error) {
+	params := url.Values{}
+	params.Set("deviceId", deviceID)
+	if opts != nil {
+		if !opts.From.IsZero() {
+			params.Set("startTime", opts.From.UTC().Format(TimeLayout))
+		}
+		if !opts.To.IsZero() {
+			params.Set("endTime", opts.To.UTC().Format(TimeLayout))
+		}
+		if opts.Page > 0 {
+			params.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PerPage > 0 {
+			params.Set("pageSize", strconv.Itoa(opts.PerPage))
+		}
+	}
+	u := "positions/history?" + params.Encode()
+
+	return s.list(ctx, u)
+}
+
+// historyPageSize is the page size WalkHistory uses when none is given.
+const historyPageSize = 500
+
+// WalkHistory pages through the positions recorded by a device, oldest
+// first, and calls fn with each page. It stops after the last page or when
+// fn returns an error, which is then returned. The Page option is used as
+// the first page to fetch.
+func (s *PositionsService) WalkHistory(ctx context.Context, deviceID string, opts *HistoryOptions, fn func(page []*Position) error) error {
+	pageOpts := HistoryOptions{Page: 1, PerPage: historyPageSize}
+	if opts != nil {
+		pageOpts.From, pageOpts.To = opts.From, opts.To
+		if opts.Page > 0 {
+			pageOpts.Page = opts.Page
+		}
+		if opts.PerPage > 0 {
+			pageOpts.PerPage = opts.PerPage
+		}
+	}
+
+	for {
+		positions, _, err := s.History(ctx, deviceID, &pageOpts)
+		if err != nil {
+			return err
+		}
+		if len(positions) > 0 {
+			if err := fn(positions); err != nil {
+				return err
+			}
+		}
+		if len(positions) < pageOpts.PerPage {
+			return nil
+		}
+		pageOpts.Page++
+	}
+}
+
+func (s *PositionsService) list(ctx context.Context, u string) ([]*Position, *http.Response, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var positions []*Position
+	resp, err := s.client.doData(req, &positions)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if err := s.client.convertPositions(positions); err != nil {
+		return nil, resp, err
+	}
+
+	if err := s.client.FillAddresses(ctx, positions); err != nil {
+		return nil, resp, err
+	}
+
+	return positions, resp, nil
+}
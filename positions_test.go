@@ -0,0 +1,202 @@
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+func TestPositionsService_Latest(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/positions/latest" {
+			t.Errorf("Expected request to '/positions/latest', got '%s'", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("deviceIds"); got != "device-1,device-2" {
+			t.Errorf("Expected deviceIds 'device-1,device-2', got '%s'", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": true, "code": 0, "data": [
+			{"deviceId": "device-1", "lat": 52.3676, "lng": 4.9041, "speed": 50, "gpsTime": "2024-05-01 12:00:00"},
+			{"deviceId": "device-2", "lat": 39.908741, "lng": 116.397426, "mapType": "GOOGLE"}
+		]}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	positions, _, err := client.Positions.Latest(context.Background(), "device-1", "device-2")
+	if err != nil {
+		t.Fatalf("Latest returned unexpected error: %v", err)
+	}
+
+	if len(positions) != 2 {
+		t.Fatalf("Latest returned %d positions, want 2", len(positions))
+	}
+	if positions[0].Datum != geo.WGS84 {
+		t.Errorf("Position Datum = %v, want %v", positions[0].Datum, geo.WGS84)
+	}
+	if positions[1].Datum != geo.GCJ02 {
+		t.Errorf("Position Datum = %v, want %v", positions[1].Datum, geo.GCJ02)
+	}
+	if want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC); !positions[0].Time.Equal(want) {
+		t.Errorf("Position Time = %v, want %v", positions[0].Time, want)
+	}
+}
+
+func TestPositionsService_History(t *testing.T) {
+	bdLat, bdLng := geo.WGS84ToBD09(39.90734, 116.39118)
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/positions/history" {
+			t.Errorf("Expected request to '/positions/history', got '%s'", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if got := query.Get("deviceId"); got != "device-1" {
+			t.Errorf("Expected deviceId 'device-1', got '%s'", got)
+		}
+		if got := query.Get("startTime"); got != "2024-05-01 00:00:00" {
+			t.Errorf("Expected startTime '2024-05-01 00:00:00', got '%s'", got)
+		}
+		if got := query.Get("page"); got != "2" {
+			t.Errorf("Expected page '2', got '%s'", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"ok": true, "code": 0, "data": [
+			{"deviceId": "device-1", "lat": %v, "lng": %v, "mapType": "BAIDU"}
+		]}`, bdLat, bdLng)
+	}))
+	defer server.Close()
+
+	// Create a client that normalises positions to WGS-84
+	client, _ := NewClient(WithBaseURL(server.URL), WithPositionDatum(geo.WGS84))
+
+	positions, _, err := client.Positions.History(context.Background(), "device-1", &HistoryOptions{
+		From: time.Date(2024, 5, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Page: 2,
+	})
+	if err != nil {
+		t.Fatalf("History returned unexpected error: %v", err)
+	}
+
+	if len(positions) != 1 {
+		t.Fatalf("History returned %d positions, want 1", len(positions))
+	}
+	if positions[0].Datum != geo.WGS84 {
+		t.Errorf("Position Datum = %v, want %v", positions[0].Datum, geo.WGS84)
+	}
+	if math.Abs(positions[0].Lat-39.90734) > 1e-8 || math.Abs(positions[0].Lng-116.39118) > 1e-8 {
+		t.Errorf("Position = %v, %v, want %v, %v", positions[0].Lat, positions[0].Lng, 39.90734, 116.39118)
+	}
+}
+
+func TestPositionsService_WalkHistory(t *testing.T) {
+	// Create a test server with 5 positions, served 2 per page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("pageSize"); got != "2" {
+			t.Errorf("Expected pageSize '2', got '%s'", got)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+		var points []string
+		for i := (page - 1) * 2; i < page*2 && i < 5; i++ {
+			points = append(points, fmt.Sprintf(`{"deviceId": "device-1", "lat": %d}`, i))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"ok": true, "code": 0, "data": [%s]}`, strings.Join(points, ","))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	var pages, total int
+	err := client.Positions.WalkHistory(context.Background(), "device-1", &HistoryOptions{PerPage: 2}, func(page []*Position) error {
+		for _, p := range page {
+			if int(p.Lat) != total {
+				t.Errorf("Position Lat = %v, want %v", p.Lat, total)
+			}
+			total++
+		}
+		pages++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkHistory returned unexpected error: %v", err)
+	}
+
+	if pages != 3 || total != 5 {
+		t.Errorf("WalkHistory visited %d pages and %d positions, want 3 and 5", pages, total)
+	}
+}
+
+func TestWithPositionDatum_Unknown(t *testing.T) {
+	if _, err := NewClient(WithPositionDatum("ED50")); err == nil {
+		t.Error("NewClient with unknown datum expected error, got nil")
+	}
+}
+
+func TestPosition_UnmarshalJSON_MapType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want geo.Datum
+	}{
+		{`{}`, geo.WGS84},
+		{`{"mapType": "GPS"}`, geo.WGS84},
+		{`{"mapType": "amap"}`, geo.GCJ02},
+		{`{"mapType": "BAIDU"}`, geo.BD09},
+		{`{"mapType": "OSM"}`, geo.WGS84},
+	}
+
+	for _, tt := range tests {
+		var p Position
+		if err := json.Unmarshal([]byte(tt.in), &p); err != nil {
+			t.Fatalf("Unmarshal(%s) returned unexpected error: %v", tt.in, err)
+		}
+		if p.Datum != tt.want {
+			t.Errorf("Unmarshal(%s) Datum = %v, want %v", tt.in, p.Datum, tt.want)
+		}
+	}
+}
+
+func TestPosition_UnmarshalJSON_ACC(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{`{"accStatus": 1}`, true},
+		{`{"accStatus": "1"}`, true},
+		{`{"accStatus": true}`, true},
+		{`{"accStatus": 0}`, false},
+		{`{"accStatus": "0"}`, false},
+		{`{"acc": true}`, true},
+		{`{}`, false},
+	}
+
+	for _, tt := range tests {
+		var p Position
+		if err := json.Unmarshal([]byte(tt.in), &p); err != nil {
+			t.Fatalf("Unmarshal(%s) returned unexpected error: %v", tt.in, err)
+		}
+		if p.ACC != tt.want {
+			t.Errorf("Unmarshal(%s) ACC = %v, want %v", tt.in, p.ACC, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Package recorder records traffic with the platform to cassette files and
+// replays it, so integration tests can run without a network.
+//
+// Record a cassette once against the real platform:
+//
+//	rec, err := recorder.Open("testdata/devices.json", recorder.Record)
+//	client, err := onntrackclient.NewClient(onntrackclient.WithHTTPClient(rec.Client()))
+//	...
+//	err = rec.Close() // writes the cassette
+//
+// and open the same cassette in Replay mode in CI. Authorization headers,
+// passwords and tokens are redacted before anything is written, so
+// cassettes can be committed.
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/MaikelH/onntrackclient/internal/redact"
+)
+
+// Mode selects whether a Recorder records or replays.
+type Mode int
+
+const (
+	// Replay answers requests from the cassette without a network.
+	Replay Mode = iota
+
+	// Record sends requests to the platform and records them.
+	Record
+)
+
+// String returns "replay" or "record".
+func (m Mode) String() string {
+	if m == Record {
+		return "record"
+	}
+	return "replay"
+}
+
+// ErrNoMatch is returned in Replay mode for requests the cassette holds no
+// unused interaction for.
+var ErrNoMatch = errors.New("recorder: no recorded interaction matches the request")
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request with its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request. The host is not recorded, so a cassette
+// replays against any base URL.
+type Request struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  url.Values  `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Recorder is an http.RoundTripper that records to or replays from a
+// cassette file. Its methods are safe for concurrent use.
+type Recorder struct {
+	// Transport sends requests in Record mode. http.DefaultTransport is
+	// used when it is nil.
+	Transport http.RoundTripper
+
+	// Keys are JSON keys whose values are redacted from bodies in addition
+	// to the password and token.
+	Keys []string
+
+	path string
+	mode Mode
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// Open returns a recorder for the cassette at path. In Replay mode the
+// cassette must exist; in Record mode it is written by Close.
+func Open(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode}
+	if mode == Record {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("recorder: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("recorder: invalid cassette %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Mode returns the mode the recorder was opened in.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client that sends its requests through the
+// recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Close writes the cassette in Record mode. It does nothing in Replay mode.
+func (r *Recorder) Close() error {
+	if r.mode != Record {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&r.cassette); err != nil {
+		return fmt.Errorf("recorder: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("recorder: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("recorder: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("recorder: %w", err)
+	}
+	return nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.mode == Record {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	header := redact.Header(resp.Header, redact.Headers)
+	header.Del("Content-Length")
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  req.URL.Query(),
+			Header: redact.Header(req.Header, redact.Headers),
+			Body:   string(redact.JSON(body, r.keys())),
+		},
+		Response: Response{
+			Status: resp.StatusCode,
+			Header: header,
+			Body:   string(redact.JSON(respBody, r.keys())),
+		},
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	query := req.URL.Query().Encode()
+	normalized := r.normalize(body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || in.Request.Method != req.Method || in.Request.Path != req.URL.Path {
+			continue
+		}
+		if in.Request.Query.Encode() != query || r.normalize([]byte(in.Request.Body)) != normalized {
+			continue
+		}
+		r.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s %s", ErrNoMatch, req.Method, req.URL.RequestURI(), normalized)
+}
+
+// normalize returns a body in a form that compares equal to the recorded
+// body of the same request: secrets are redacted, and JSON is re-encoded
+// with sorted keys and without insignificant whitespace.
+func (r *Recorder) normalize(body []byte) string {
+	body = redact.JSON(body, r.keys())
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return string(bytes.TrimSpace(body))
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	return string(normalized)
+}
+
+func (r *Recorder) keys() []string {
+	return append(append([]string(nil), redact.Keys...), r.Keys...)
+}
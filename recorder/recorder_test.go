@@ -0,0 +1,104 @@
+package recorder_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/onntracktest"
+	"github.com/MaikelH/onntrackclient/recorder"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "devices.json")
+	ctx := context.Background()
+
+	// Record against a fake platform
+	srv := onntracktest.NewServer()
+	srv.AddAccount("fleet@example.com", "s3cret-pass")
+	srv.AddDevice(&onntrackclient.Device{ID: "1", Name: "Van 1", IMEI: "490154203237518", Status: "active"})
+
+	rec, err := recorder.Open(path, recorder.Record)
+	if err != nil {
+		t.Fatalf("Open returned unexpected error: %v", err)
+	}
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(srv.URL), onntrackclient.WithHTTPClient(rec.Client()))
+	loginResp, _, err := client.Auth.Login(ctx, &onntrackclient.LoginRequest{
+		Account:  "fleet@example.com",
+		Password: "s3cret-pass",
+	})
+	if err != nil || !loginResp.OK {
+		t.Fatalf("Login = %+v, %v, want ok", loginResp, err)
+	}
+	token := loginResp.Data.Token
+	if _, _, err := client.Devices.List(ctx, &onntrackclient.DeviceListOptions{Status: "active"}); err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	if _, _, err := client.Devices.Get(ctx, "1"); err != nil {
+		t.Fatalf("Get returned unexpected error: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close returned unexpected error: %v", err)
+	}
+	srv.Close()
+
+	// Secrets are not written to the cassette
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cassette: %v", err)
+	}
+	for _, secret := range []string{"s3cret-pass", token} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains secret %q", secret)
+		}
+	}
+	if !strings.Contains(string(data), "REDACTED") {
+		t.Error("cassette contains no redacted values")
+	}
+
+	// Replay without a server, on another host
+	rec, err = recorder.Open(path, recorder.Replay)
+	if err != nil {
+		t.Fatalf("Open returned unexpected error: %v", err)
+	}
+	client, _ = onntrackclient.NewClient(onntrackclient.WithBaseURL("http://replay.invalid/"), onntrackclient.WithHTTPClient(rec.Client()))
+
+	// The password differs from the recorded one, but it is redacted on both
+	// sides.
+	loginResp, _, err = client.Auth.Login(ctx, &onntrackclient.LoginRequest{
+		Account:  "fleet@example.com",
+		Password: "another password",
+	})
+	if err != nil || !loginResp.OK {
+		t.Fatalf("replayed Login = %+v, %v, want ok", loginResp, err)
+	}
+	devices, resp, err := client.Devices.List(ctx, &onntrackclient.DeviceListOptions{Status: "active"})
+	if err != nil {
+		t.Fatalf("replayed List returned unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(devices) != 1 || devices[0].Name != "Van 1" {
+		t.Errorf("replayed List = %d, %+v, want Van 1", resp.StatusCode, devices)
+	}
+
+	// Each interaction is replayed once, and other requests fail
+	if _, _, err := client.Devices.Get(ctx, "1"); err != nil {
+		t.Fatalf("replayed Get returned unexpected error: %v", err)
+	}
+	if _, _, err := client.Devices.Get(ctx, "1"); !errors.Is(err, recorder.ErrNoMatch) {
+		t.Errorf("second Get returned %v, want ErrNoMatch", err)
+	}
+	if _, _, err := client.Devices.List(ctx, &onntrackclient.DeviceListOptions{Status: "inactive"}); !errors.Is(err, recorder.ErrNoMatch) {
+		t.Errorf("List with another query returned %v, want ErrNoMatch", err)
+	}
+}
+
+func TestOpen_MissingCassette(t *testing.T) {
+	if _, err := recorder.Open(filepath.Join(t.TempDir(), "missing.json"), recorder.Replay); err == nil {
+		t.Error("Open of a missing cassette expected error, got nil")
+	}
+}
@@ -0,0 +1,110 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SharesService handles communication with the live-tracking share link
+// related methods of the Onntrack API.
+type SharesService service
+
+// ShareLink represents a time-limited link that shows the live location of
+// one or more devices to people without an account.
+type ShareLink struct {
+	ID        string    `json:"id"`
+	DeviceIDs []string  `json:"deviceIds"`
+	URL       *url.URL  `json:"-"`
+	CreatedAt Timestamp `json:"createTime"`
+	ExpiresAt Timestamp `json:"expireTime"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *ShareLink) UnmarshalJSON(data []byte) error {
+	type alias ShareLink
+	aux := struct {
+		*alias
+		URL string `json:"url"`
+	}{alias: (*alias)(l)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.URL != "" {
+		u, err := url.Parse(aux.URL)
+		if err != nil {
+			return fmt.Errorf("invalid share url: %w", err)
+		}
+		l.URL = u
+	}
+
+	return nil
+}
+
+// ShareCreateRequest represents a request to create a share link.
+type ShareCreateRequest struct {
+	// DeviceIDs are the devices whose live location is shared.
+	DeviceIDs []string `json:"deviceIds"`
+
+	// ExpiresAt is when the link stops working.
+	ExpiresAt Timestamp `json:"expireTime"`
+}
+
+// Create a new share link.
+//
+// Endpoint: share
+func (s *SharesService) Create(ctx context.Context, shareReq *ShareCreateRequest) (*ShareLink, *http.Response, error) {
+	u := "share"
+
+	req, err := s.client.NewRequest(ctx, http.MethodPost, u, shareReq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	link := new(ShareLink)
+	resp, err := s.client.doData(req, link)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return link, resp, nil
+}
+
+// List the share links that have not been revoked.
+//
+// Endpoint: share
+func (s *SharesService) List(ctx context.Context) ([]*ShareLink, *http.Response, error) {
+	u := "share"
+
+	req, err := s.client.NewRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var links []*ShareLink
+	resp, err := s.client.doData(req, &links)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return links, resp, nil
+}
+
+// Revoke a share link before it expires.
+//
+// Endpoint: share/{id}
+func (s *SharesService) Revoke(ctx context.Context, shareID string) (*http.Response, error) {
+	u := fmt.Sprintf("share/%s", shareID)
+
+	req, err := s.client.NewRequest(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.doData(req, nil)
+}
@@ -0,0 +1,97 @@
+package onntrackclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSharesService_Create(t *testing.T) {
+	expiresAt := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/share" {
+			t.Errorf("Expected request to '/share', got '%s'", r.URL.Path)
+		}
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST request, got '%s'", r.Method)
+		}
+
+		// Decode request body
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if body["expireTime"] != "2024-05-01 18:00:00" {
+			t.Errorf("Expected expireTime '2024-05-01 18:00:00', got '%v'", body["expireTime"])
+		}
+
+		// Return a mock response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": true, "code": 0, "msg": "", "data": {
+			"id": "share-1",
+			"deviceIds": ["device-1"],
+			"url": "https://platform.onntrack.nl/share/abc123",
+			"createTime": "2024-05-01 14:00:00",
+			"expireTime": "2024-05-01 18:00:00"
+		}}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	link, _, err := client.Shares.Create(context.Background(), &ShareCreateRequest{
+		DeviceIDs: []string{"device-1"},
+		ExpiresAt: Timestamp{expiresAt},
+	})
+	if err != nil {
+		t.Fatalf("Create returned unexpected error: %v", err)
+	}
+
+	if link.ID != "share-1" {
+		t.Errorf("ShareLink ID = %v, want %v", link.ID, "share-1")
+	}
+	if link.URL == nil || link.URL.Path != "/share/abc123" {
+		t.Errorf("ShareLink URL = %v, want path %v", link.URL, "/share/abc123")
+	}
+	if !link.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ShareLink ExpiresAt = %v, want %v", link.ExpiresAt, expiresAt)
+	}
+}
+
+func TestSharesService_Revoke(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/share/share-1" {
+			t.Errorf("Expected request to '/share/share-1', got '%s'", r.URL.Path)
+		}
+		if r.Method != http.MethodDelete {
+			t.Errorf("Expected DELETE request, got '%s'", r.Method)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": false, "code": 404, "msg": "share not found", "data": null}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client, _ := NewClient(WithBaseURL(server.URL))
+
+	_, err := client.Shares.Revoke(context.Background(), "share-1")
+
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) {
+		t.Fatalf("Revoke error = %v, want *ErrorResponse", err)
+	}
+	if errResp.Code != "404" || errResp.Message != "share not found" {
+		t.Errorf("Revoke error = %v %v, want %v %v", errResp.Code, errResp.Message, "404", "share not found")
+	}
+}
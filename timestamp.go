@@ -0,0 +1,71 @@
+// Package onntrackclient provides a client for the Onntrack tracking dashboard REST API.
+package onntrackclient
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeLayout is the layout the platform uses for date-time strings.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Timestamp represents a point in time returned by the platform.
+// It decodes the platform's "2006-01-02 15:04:05" strings, RFC 3339 strings
+// and Unix timestamps in milliseconds. Empty strings and null decode to the
+// zero time.
+type Timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	// Numbers are Unix timestamps in milliseconds
+	if len(data) > 0 && data[0] != '"' {
+		ms, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %s", data)
+		}
+		t.Time = time.UnixMilli(ms).UTC()
+		return nil
+	}
+
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s", data)
+	}
+	parsed, err := parseTime(s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface. Times are written in
+// UTC, since the layout has no zone.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Quote(t.UTC().Format(TimeLayout))), nil
+}
+
+// parseTime parses a date-time string in one of the formats used by the platform.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{TimeLayout, time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
@@ -0,0 +1,63 @@
+package onntrackclient
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestamp_UnmarshalJSON(t *testing.T) {
+	want := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{`"2024-03-01 08:30:00"`, want},
+		{`"2024-03-01T08:30:00Z"`, want},
+		{`1709281800000`, want},
+		{`""`, time.Time{}},
+		{`null`, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(tt.in), &ts); err != nil {
+			t.Errorf("Unmarshal(%s) returned unexpected error: %v", tt.in, err)
+			continue
+		}
+		if !ts.Equal(tt.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.in, ts.Time, tt.want)
+		}
+	}
+
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(`"yesterday"`), &ts); err == nil {
+		t.Error("Unmarshal(\"yesterday\") expected error, got nil")
+	}
+}
+
+func TestTimestamp_MarshalJSON(t *testing.T) {
+	amsterdam := time.FixedZone("CEST", 2*60*60)
+	in := Timestamp{time.Date(2024, 3, 1, 10, 30, 0, 0, amsterdam)}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal returned unexpected error: %v", err)
+	}
+	if want := `"2024-03-01 08:30:00"`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var out Timestamp
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal returned unexpected error: %v", err)
+	}
+	if !out.Equal(in.Time) {
+		t.Errorf("round trip = %v, want %v", out.Time, in.Time)
+	}
+
+	if data, _ := json.Marshal(Timestamp{}); string(data) != "null" {
+		t.Errorf("Marshal of the zero time = %s, want null", data)
+	}
+}
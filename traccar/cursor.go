@@ -0,0 +1,95 @@
+package traccar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Mark is where the cursor of a device stands: the time of its last
+// forwarded position and the coordinates of every position forwarded at
+// that time, which tell apart positions that share it.
+type Mark struct {
+	Time      time.Time    `json:"time"`
+	Positions [][2]float64 `json:"positions,omitempty"`
+}
+
+// Cursor stores the mark of every device.
+type Cursor interface {
+	// Load returns the stored marks by device ID. A cursor that has never
+	// been saved is empty.
+	Load() (map[string]Mark, error)
+
+	// Save replaces the stored marks.
+	Save(last map[string]Mark) error
+}
+
+// FileCursor stores the cursor as a JSON object in a file. The file is
+// replaced atomically, so a crash never leaves a partial cursor behind.
+type FileCursor struct {
+	Path string
+}
+
+// Load implements Cursor. Files that only hold a time per device, as
+// written by earlier versions, load as marks without positions.
+func (c *FileCursor) Load() (map[string]Mark, error) {
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]Mark{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]Mark, len(raw))
+	for id, v := range raw {
+		var mark Mark
+		if len(v) > 0 && v[0] == '"' {
+			err = json.Unmarshal(v, &mark.Time)
+		} else {
+			err = json.Unmarshal(v, &mark)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("device %s: %w", id, err)
+		}
+		last[id] = mark
+	}
+	return last, nil
+}
+
+// Save implements Cursor.
+func (c *FileCursor) Save(last map[string]Mark) error {
+	data, err := json.MarshalIndent(last, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), filepath.Base(c.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.Path)
+}
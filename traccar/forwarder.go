@@ -0,0 +1,320 @@
+// Package traccar forwards the positions of Onntrack devices to a Traccar
+// server using the OsmAnd protocol.
+//
+// Each device is identified in Traccar by its IMEI, or by its Onntrack
+// device ID when the platform does not report an IMEI. The time of the last
+// forwarded position of every device, and the positions forwarded at that
+// time, are kept in a Cursor, so restarts do not forward positions again and
+// the gaps left by downtime are filled from the position history.
+// Forwarding is at least once: a position sent just before a crash, when the
+// cursor was not saved yet, is sent again after the restart. Positions
+// without a time are not forwarded.
+//
+//	fwd := &traccar.Forwarder{
+//		Client:    client,
+//		ServerURL: "http://traccar.example.com:5055",
+//		Cursor:    &traccar.FileCursor{Path: "traccar-cursor.json"},
+//	}
+//	err := fwd.Run(ctx)
+package traccar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+	"github.com/MaikelH/onntrackclient/geo"
+)
+
+// DefaultInterval is the polling interval used when none is set.
+const DefaultInterval = 30 * time.Second
+
+// knotsPerKmh converts km/h, as reported by the platform, to knots, as
+// expected by the OsmAnd protocol.
+const knotsPerKmh = 1 / 1.852
+
+// Forwarder polls the platform and forwards new positions to Traccar. A
+// Forwarder must not be copied or polled from several goroutines at once.
+type Forwarder struct {
+	Client *onntrackclient.Client
+
+	// ServerURL is the address of the Traccar OsmAnd listener, usually on
+	// port 5055.
+	ServerURL string
+
+	// HTTPClient sends the positions to Traccar. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Cursor stores the last forwarded positions per device. Without one,
+	// nothing is remembered across restarts.
+	Cursor Cursor
+
+	// Group limits the forwarder to the devices in a group.
+	Group string
+
+	// Interval is the time between polls. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// Reauthenticate, if set, is called when the platform rejects the
+	// session, after which the poll is retried once.
+	Reauthenticate func(ctx context.Context) error
+
+	// Logger receives poll failures. Nothing is logged when it is nil.
+	Logger *slog.Logger
+
+	// last is the in-memory copy of the cursor.
+	last map[string]Mark
+}
+
+// Run polls every Interval until ctx is done. Failed polls are logged and
+// retried at the next interval.
+func (f *Forwarder) Run(ctx context.Context) error {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := f.Poll(ctx)
+		if err != nil && f.Reauthenticate != nil && onntrackclient.IsAuthError(err) {
+			if err = f.Reauthenticate(ctx); err == nil {
+				_, err = f.Poll(ctx)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			f.logger().Warn("traccar: poll failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll forwards the positions recorded since the last forwarded position of
+// every device and returns how many were forwarded. Devices seen for the
+// first time only have their latest position forwarded.
+//
+// A device that fails is skipped until the next poll; the errors of all
+// devices are joined.
+func (f *Forwarder) Poll(ctx context.Context) (int, error) {
+	if f.last == nil {
+		last := make(map[string]Mark)
+		if f.Cursor != nil {
+			loaded, err := f.Cursor.Load()
+			if err != nil {
+				return 0, fmt.Errorf("loading cursor: %w", err)
+			}
+			for id, mark := range loaded {
+				last[id] = mark
+			}
+		}
+		f.last = last
+	}
+
+	var ids []string
+	if f.Group != "" {
+		devices, _, err := f.Client.Devices.ListAll(ctx, &onntrackclient.DeviceListOptions{Group: f.Group})
+		if err != nil {
+			return 0, err
+		}
+		if len(devices) == 0 {
+			return 0, nil
+		}
+		for _, d := range devices {
+			ids = append(ids, d.ID)
+		}
+	}
+
+	latest, _, err := f.Client.Positions.Latest(ctx, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	forwarded := 0
+	var errs []error
+	for _, p := range latest {
+		n, err := f.forwardDevice(ctx, p)
+		forwarded += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", p.DeviceID, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if forwarded > 0 && f.Cursor != nil {
+		if err := f.Cursor.Save(f.last); err != nil {
+			errs = append(errs, fmt.Errorf("saving cursor: %w", err))
+		}
+	}
+
+	return forwarded, errors.Join(errs...)
+}
+
+// forwardDevice forwards the positions of one device that are newer than
+// its cursor, given its latest position.
+func (f *Forwarder) forwardDevice(ctx context.Context, latest *onntrackclient.Position) (int, error) {
+	last, ok := f.last[latest.DeviceID]
+	if !ok {
+		return f.forwardNew(ctx, []*onntrackclient.Position{latest})
+	}
+	if f.forwarded(latest) {
+		return 0, nil
+	}
+
+	// Fill the gap since the last forwarded position from the history
+	forwarded := 0
+	err := f.Client.Positions.WalkHistory(ctx, latest.DeviceID, &onntrackclient.HistoryOptions{From: last.Time}, func(page []*onntrackclient.Position) error {
+		// History entries do not always repeat the device identifiers
+		for _, p := range page {
+			if p.DeviceID == "" {
+				p.DeviceID = latest.DeviceID
+			}
+			if p.IMEI == "" {
+				p.IMEI = latest.IMEI
+			}
+		}
+
+		n, err := f.forwardNew(ctx, page)
+		forwarded += n
+		if err == nil && n > 0 && f.Cursor != nil {
+			err = f.Cursor.Save(f.last)
+		}
+		return err
+	})
+	if err != nil {
+		return forwarded, err
+	}
+
+	// The history can lag behind the latest position
+	n, err := f.forwardNew(ctx, []*onntrackclient.Position{latest})
+	return forwarded + n, err
+}
+
+// forwardNew forwards the positions, oldest first, that were not forwarded
+// before and advances the cursor. Positions without a time are skipped, as
+// Traccar would place them in year 1. It stops at the first failure.
+func (f *Forwarder) forwardNew(ctx context.Context, positions []*onntrackclient.Position) (int, error) {
+	forwarded := 0
+	for _, p := range positions {
+		if p.Time.IsZero() {
+			f.logger().Debug("traccar: skipping position without a time", "device", p.DeviceID)
+			continue
+		}
+		if f.forwarded(p) {
+			continue
+		}
+		if err := f.send(ctx, p); err != nil {
+			return forwarded, err
+		}
+
+		mark, ok := f.last[p.DeviceID]
+		if !ok || p.Time.After(mark.Time) {
+			mark = Mark{Time: p.Time.Time}
+		}
+		mark.Positions = append(mark.Positions, [2]float64{p.Lat, p.Lng})
+		f.last[p.DeviceID] = mark
+		forwarded++
+	}
+	return forwarded, nil
+}
+
+// forwarded reports whether a position is at or before the cursor of its
+// device. Positions at the cursor time are told apart by their coordinates.
+// A mark without positions, as loaded from an older cursor file, counts
+// all positions at its time as forwarded.
+func (f *Forwarder) forwarded(p *onntrackclient.Position) bool {
+	mark, ok := f.last[p.DeviceID]
+	if !ok || p.Time.After(mark.Time) {
+		return false
+	}
+	if p.Time.Before(mark.Time) {
+		return true
+	}
+	return mark.Positions == nil || slices.Contains(mark.Positions, [2]float64{p.Lat, p.Lng})
+}
+
+// send forwards one position.
+func (f *Forwarder) send(ctx context.Context, p *onntrackclient.Position) error {
+	u, err := url.Parse(f.ServerURL)
+	if err != nil {
+		return fmt.Errorf("invalid Traccar server URL: %w", err)
+	}
+	params, err := osmAndParams(p)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	httpClient := f.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("traccar: %s returned %s", u.Host, resp.Status)
+	}
+	return nil
+}
+
+// osmAndParams returns the OsmAnd query parameters for a position.
+// Coordinates are converted to WGS-84 and speed to knots.
+func osmAndParams(p *onntrackclient.Position) (url.Values, error) {
+	lat, lng, err := geo.Convert(p.Lat, p.Lng, p.Datum, geo.WGS84)
+	if err != nil {
+		return nil, err
+	}
+
+	id := p.IMEI
+	if id == "" {
+		id = p.DeviceID
+	}
+
+	params := url.Values{}
+	params.Set("id", id)
+	params.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	params.Set("lon", strconv.FormatFloat(lng, 'f', -1, 64))
+	params.Set("timestamp", strconv.FormatInt(p.Time.Unix(), 10))
+	params.Set("speed", strconv.FormatFloat(p.Speed*knotsPerKmh, 'f', 2, 64))
+	params.Set("bearing", strconv.FormatFloat(p.Course, 'f', -1, 64))
+	params.Set("altitude", strconv.FormatFloat(p.Altitude, 'f', -1, 64))
+	if p.Battery != nil {
+		params.Set("batt", strconv.Itoa(*p.Battery))
+	}
+
+	return params, nil
+}
+
+func (f *Forwarder) logger() *slog.Logger {
+	if f.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return f.Logger
+}
@@ -0,0 +1,258 @@
+package traccar
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaikelH/onntrackclient"
+)
+
+// platform serves the position history of device 1; the latest position is
+// the last one.
+type platform struct {
+	mu      sync.Mutex
+	history []map[string]any
+}
+
+func (p *platform) add(gpsTime string, lat float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.history = append(p.history, map[string]any{
+		"deviceId": "1", "imei": "490154203237518", "lat": lat, "lng": 4.1,
+		"speed": 18.52, "course": 90, "battery": 75, "gpsTime": gpsTime,
+	})
+}
+
+func (p *platform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var data []map[string]any
+	switch r.URL.Path {
+	case "/positions/latest":
+		data = p.history[len(p.history)-1:]
+	case "/positions/history":
+		// History entries leave out the IMEI, and the start time is inclusive
+		from := r.URL.Query().Get("startTime")
+		for _, pos := range p.history {
+			if pos["gpsTime"].(string) >= from {
+				data = append(data, map[string]any{"lat": pos["lat"], "lng": pos["lng"], "gpsTime": pos["gpsTime"]})
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": data})
+}
+
+// traccarServer records the OsmAnd requests it receives.
+type traccarServer struct {
+	mu       sync.Mutex
+	received []url.Values
+	fail     bool
+}
+
+func (s *traccarServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.received = append(s.received, r.URL.Query())
+}
+
+func TestForwarder_Poll(t *testing.T) {
+	backend := &platform{}
+	backend.add("2024-05-01 12:00:00", 52.1)
+
+	// Create test servers for the platform and Traccar
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	traccar := &traccarServer{}
+	traccarHTTP := httptest.NewServer(traccar)
+	defer traccarHTTP.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	cursor := &FileCursor{Path: filepath.Join(t.TempDir(), "cursor.json")}
+	newForwarder := func() *Forwarder {
+		return &Forwarder{Client: client, ServerURL: traccarHTTP.URL, Cursor: cursor}
+	}
+
+	fwd := newForwarder()
+	poll := func(want int) {
+		t.Helper()
+		n, err := fwd.Poll(context.Background())
+		if err != nil {
+			t.Fatalf("Poll returned unexpected error: %v", err)
+		}
+		if n != want {
+			t.Errorf("Poll forwarded %d positions, want %d", n, want)
+		}
+	}
+
+	// A new device only has its latest position forwarded
+	poll(1)
+
+	// The positions recorded since are forwarded from the history, once
+	backend.add("2024-05-01 12:00:30", 52.2)
+	backend.add("2024-05-01 12:00:30", 52.2)
+	backend.add("2024-05-01 12:01:00", 52.3)
+	poll(2)
+	poll(0)
+
+	// The cursor survives a restart
+	fwd = newForwarder()
+	poll(0)
+
+	// A failed send is retried at the next poll
+	backend.add("2024-05-01 12:01:30", 52.4)
+	traccar.fail = true
+	if _, err := fwd.Poll(context.Background()); err == nil {
+		t.Error("Poll with a failing Traccar server expected error, got nil")
+	}
+	traccar.fail = false
+	poll(1)
+
+	// Positions that share a time are told apart by their coordinates, also
+	// after a restart
+	backend.add("2024-05-01 12:02:00", 52.5)
+	poll(1)
+	fwd = newForwarder()
+	backend.add("2024-05-01 12:02:00", 52.6)
+	poll(1)
+	poll(0)
+
+	if len(traccar.received) != 6 {
+		t.Fatalf("Traccar received %d positions, want 6", len(traccar.received))
+	}
+	wantTimes := []string{"1714564800", "1714564830", "1714564860", "1714564890", "1714564920", "1714564920"}
+	for i, params := range traccar.received {
+		if params.Get("id") != "490154203237518" {
+			t.Errorf("position %d id = %v, want the IMEI", i, params.Get("id"))
+		}
+		if params.Get("timestamp") != wantTimes[i] {
+			t.Errorf("position %d timestamp = %v, want %v", i, params.Get("timestamp"), wantTimes[i])
+		}
+	}
+
+	first := traccar.received[0]
+	for key, want := range map[string]string{"lat": "52.1", "lon": "4.1", "speed": "10.00", "bearing": "90", "batt": "75"} {
+		if got := first.Get(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	last, err := cursor.Load()
+	if err != nil {
+		t.Fatalf("Load returned unexpected error: %v", err)
+	}
+	want := Mark{Time: time.Date(2024, 5, 1, 12, 2, 0, 0, time.UTC), Positions: [][2]float64{{52.5, 4.1}, {52.6, 4.1}}}
+	if got := last["1"]; !got.Time.Equal(want.Time) || !slices.Equal(got.Positions, want.Positions) {
+		t.Errorf("cursor = %+v, want %+v", got, want)
+	}
+}
+
+func TestForwarder_Poll_NoTime(t *testing.T) {
+	backend := &platform{}
+	backend.add("", 52.1)
+
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	traccar := &traccarServer{}
+	traccarHTTP := httptest.NewServer(traccar)
+	defer traccarHTTP.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	fwd := &Forwarder{Client: client, ServerURL: traccarHTTP.URL}
+
+	// A position without a time is not forwarded as one from year 1
+	n, err := fwd.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	if n != 0 || len(traccar.received) != 0 {
+		t.Errorf("Poll forwarded %d positions, want none", n)
+	}
+}
+
+func TestForwarder_Poll_Group(t *testing.T) {
+	// Create a test server with 101 devices in the group, over two pages
+	var latestIDs string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices":
+			if got := r.URL.Query().Get("group"); got != "vans" {
+				t.Errorf("Expected group 'vans', got '%s'", got)
+			}
+			var devices []map[string]any
+			if r.URL.Query().Get("page") == "1" {
+				for i := 1; i <= 100; i++ {
+					devices = append(devices, map[string]any{"id": strconv.Itoa(i)})
+				}
+			} else {
+				devices = append(devices, map[string]any{"id": "101"})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "data": devices})
+		case "/positions/latest":
+			latestIDs = r.URL.Query().Get("deviceIds")
+			w.Write([]byte(`{"ok": true, "data": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := onntrackclient.NewClient(onntrackclient.WithBaseURL(server.URL))
+	fwd := &Forwarder{Client: client, ServerURL: "http://traccar.invalid:5055", Group: "vans"}
+
+	if _, err := fwd.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned unexpected error: %v", err)
+	}
+	if ids := strings.Split(latestIDs, ","); len(ids) != 101 || ids[100] != "101" {
+		t.Errorf("Latest requested %d devices, want all 101", len(ids))
+	}
+}
+
+func TestFileCursor_TimesOnly(t *testing.T) {
+	// Cursor files of earlier versions hold only a time per device
+	path := filepath.Join(t.TempDir(), "cursor.json")
+	if err := os.WriteFile(path, []byte(`{"1": "2024-05-01T12:00:00Z"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile returned unexpected error: %v", err)
+	}
+
+	last, err := (&FileCursor{Path: path}).Load()
+	if err != nil {
+		t.Fatalf("Load returned unexpected error: %v", err)
+	}
+	if want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC); !last["1"].Time.Equal(want) || last["1"].Positions != nil {
+		t.Errorf("Load = %+v, want a mark at %v without positions", last["1"], want)
+	}
+}
+
+func TestFileCursor_Missing(t *testing.T) {
+	cursor := &FileCursor{Path: filepath.Join(t.TempDir(), "missing.json")}
+
+	last, err := cursor.Load()
+	if err != nil {
+		t.Fatalf("Load returned unexpected error: %v", err)
+	}
+	if len(last) != 0 {
+		t.Errorf("Load = %v, want an empty cursor", last)
+	}
+}